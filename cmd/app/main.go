@@ -5,6 +5,7 @@ import (
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/plugins/migratecmd"
 	"github.com/supotsu-no-ochaya/backend/internal/hooks"
+	"github.com/supotsu-no-ochaya/backend/internal/printing"
 	"github.com/supotsu-no-ochaya/backend/internal/routes"
 	_ "github.com/supotsu-no-ochaya/backend/migrations"
 	"log"
@@ -16,13 +17,26 @@ func main() {
 	migratecmd.MustRegister(app, app.RootCmd, migratecmd.Config{})
 
 	app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+		// refuse to start with a schema the status hooks cannot work with
+		if err := hooks.CheckStatusSchema(app); err != nil {
+			return err
+		}
+
 		routes.RegisterAPIRoutes(e, app)
 		return e.Next()
 	})
 
 	hooks.RegisterOrderHooks(app)
+	hooks.RegisterTableHooks(app)
 	hooks.RegisterOrderItemHooks(app)
+	hooks.RegisterKitchenTicketHooks(app)
 	hooks.RegisterProductHooks(app)
+	hooks.RegisterStockHooks(app)
+	hooks.RegisterMenuItemHooks(app)
+	hooks.RegisterPaymentHooks(app)
+	hooks.RegisterCashSessionHooks(app)
+	hooks.RegisterZReportHooks(app)
+	printing.RegisterSpooler(app)
 
 	if err := app.Start(); err != nil {
 		log.Fatal(err)
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/supotsu-no-ochaya/backend/internal/hooks"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+const (
+	cashResultBalanced = "balanced"
+	cashResultOver     = "over"
+	cashResultShort    = "short"
+)
+
+// CashSessionReport is a cash session with its cash payments. For open sessions the cash totals and the
+// expected amount are the ones so far, for closed sessions they are the ones stored when closing it.
+type CashSessionReport struct {
+	model.CashSession
+	Payments []string `json:"payments"`
+	// Result is "over" or "short" if the counted amount differs from the expected one, "balanced" otherwise.
+	// It is empty while the session is open.
+	Result string `json:"result"`
+}
+
+// OpenCashSessionRequest is the body of OpenCashSessionHandler.
+type OpenCashSessionRequest struct {
+	// Waiter defaults to the authenticated user.
+	Waiter       string `json:"waiter"`
+	OpeningFloat int    `json:"opening_float"`
+}
+
+// CloseCashSessionRequest is the body of CloseCashSessionHandler.
+type CloseCashSessionRequest struct {
+	CountedAmount *int `json:"counted_amount"`
+}
+
+// OpenCashSessionHandler returns an Echo handler function opening a cash session with the opening float.
+// Cash payments of the orders of the waiter are attached to it until it is closed.
+func OpenCashSessionHandler(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		var body OpenCashSessionRequest
+		if err := e.BindBody(&body); err != nil {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid body"})
+		}
+		if body.Waiter == "" && e.Auth != nil && !e.Auth.IsSuperuser() {
+			body.Waiter = e.Auth.Id
+		}
+		if body.Waiter == "" {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": "Missing 'waiter'"})
+		}
+		allowed, err := mayManageCashSession(app, e.Auth, body.Waiter)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		if !allowed {
+			return e.JSON(http.StatusForbidden, echo.Map{"error": "Only the Kuechenchef may open the cash session of another waiter"})
+		}
+
+		openSession, err := hooks.FindOpenCashSession(app, body.Waiter)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		if openSession != nil {
+			return e.JSON(http.StatusConflict, echo.Map{"error": "The waiter already has an open cash session", "id": openSession.Id})
+		}
+
+		collection, err := app.FindCollectionByNameOrId(model.CashSessionCollection)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		record := core.NewRecord(collection)
+		record.Set("waiter", body.Waiter)
+		record.Set("opening_float", body.OpeningFloat)
+		if err := app.Save(record); err != nil {
+			return saveErrorJSON(e, err)
+		}
+
+		report, err := fetchCashSessionReport(app, record)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		return e.JSON(http.StatusOK, report)
+	}
+}
+
+// CashSessionHandler returns an Echo handler function returning the CashSessionReport
+// of the cash session with the path parameter 'id'.
+func CashSessionHandler(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		record, err := app.FindRecordById(model.CashSessionCollection, e.Request.PathValue("id"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, echo.Map{"error": "Cash session not found"})
+		}
+
+		report, err := fetchCashSessionReport(app, record)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		return e.JSON(http.StatusOK, report)
+	}
+}
+
+// CloseCashSessionHandler returns an Echo handler function closing the cash session with the path parameter 'id'
+// with the counted amount. The cash totals, the expected amount and the difference are stored with the session.
+func CloseCashSessionHandler(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		var body CloseCashSessionRequest
+		if err := e.BindBody(&body); err != nil || body.CountedAmount == nil {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": "Missing 'counted_amount'"})
+		}
+
+		var report CashSessionReport
+		status := http.StatusOK
+		// no cash payment can be attached between summing up the payments and closing the session
+		err := app.RunInTransaction(func(txApp core.App) error {
+			record, err := txApp.FindRecordById(model.CashSessionCollection, e.Request.PathValue("id"))
+			if err != nil {
+				status = http.StatusNotFound
+				return errors.New("Cash session not found")
+			}
+			allowed, err := mayManageCashSession(txApp, e.Auth, record.GetString("waiter"))
+			if err != nil {
+				status = http.StatusInternalServerError
+				return err
+			}
+			if !allowed {
+				status = http.StatusForbidden
+				return errors.New("Only the Kuechenchef may close the cash session of another waiter")
+			}
+			if !model.CashSessionFromRecord(record).IsOpen() {
+				status = http.StatusConflict
+				return errors.New("Cash session is already closed")
+			}
+
+			report, err = fetchCashSessionReport(txApp, record)
+			if err != nil {
+				status = http.StatusInternalServerError
+				return err
+			}
+			difference := float64(*body.CountedAmount) - report.ExpectedAmount
+
+			record.Set("closed", types.NowDateTime())
+			record.Set("cash_total", report.CashTotal)
+			record.Set("cash_tips", report.CashTips)
+			record.Set("expected_amount", report.ExpectedAmount)
+			record.Set("counted_amount", *body.CountedAmount)
+			record.Set("difference", difference)
+			if err := txApp.Save(record); err != nil {
+				status = http.StatusInternalServerError
+				return err
+			}
+
+			report.CashSession = model.CashSessionFromRecord(record)
+			report.Result = cashResult(difference)
+			return nil
+		})
+		if err != nil {
+			return e.JSON(status, echo.Map{"error": err.Error()})
+		}
+		return e.JSON(http.StatusOK, report)
+	}
+}
+
+// mayManageCashSession reports whether the authenticated user may open or close a cash session of the waiter.
+// Waiters only manage their own sessions, the Kuechenchef and superusers the ones of every waiter.
+func mayManageCashSession(app core.App, auth *core.Record, waiter string) (bool, error) {
+	if auth != nil && auth.Id == waiter {
+		return true, nil
+	}
+	role, superuser, err := hooks.AuthRole(app, auth)
+	if err != nil {
+		return false, err
+	}
+	return superuser || role == model.RoleKuechenchef, nil
+}
+
+// fetchCashSessionReport collects the cash payments of the session. For open sessions the cash totals
+// and the expected amount are calculated from them.
+func fetchCashSessionReport(app core.App, record *core.Record) (CashSessionReport, error) {
+	report := CashSessionReport{
+		CashSession: model.CashSessionFromRecord(record),
+		Payments:    []string{},
+	}
+
+	paymentRecords := []*core.Record{}
+	err := app.RecordQuery(model.PaymentCollection).
+		AndWhere(dbx.HashExp{"cash_session": record.Id}).
+		OrderBy("created ASC", "id ASC").
+		All(&paymentRecords)
+	if err != nil {
+		return report, err
+	}
+	for _, paymentRecord := range paymentRecords {
+		report.Payments = append(report.Payments, paymentRecord.Id)
+	}
+
+	if !report.IsOpen() {
+		report.Result = cashResult(report.Difference)
+		return report, nil
+	}
+
+	for _, paymentRecord := range paymentRecords {
+		payment := model.PaymentFromRecord(paymentRecord)
+		report.CashTotal += payment.TotalAmount
+		report.CashTips += payment.TipAmount
+	}
+	report.ExpectedAmount = report.OpeningFloat + report.CashTotal + report.CashTips
+	return report, nil
+}
+
+func cashResult(difference float64) string {
+	switch {
+	case difference > 0:
+		return cashResultOver
+	case difference < 0:
+		return cashResultShort
+	}
+	return cashResultBalanced
+}
+
+// saveErrorJSON answers a failed save with 400 for validation errors and 500 otherwise.
+func saveErrorJSON(e *core.RequestEvent, err error) error {
+	var validationErrors validation.Errors
+	if errors.As(err, &validationErrors) {
+		return e.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+}
@@ -0,0 +1,245 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/supotsu-no-ochaya/backend/internal/hooks"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+const (
+	// testCashWaiter is the waiter of testDeliveredOrder
+	testCashWaiter  = "u805e7e223v6521"
+	testCashSession = "cashsession0001"
+)
+
+// newCashTestApp returns the test data with an open cash session of testCashWaiter (float 5000)
+// and a cash payment of 100 with a tip of 50 attached to it.
+func newCashTestApp(tb testing.TB) (*tests.TestApp, *core.Record) {
+	tb.Helper()
+	app, err := tests.NewTestApp(testDataDir)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	hooks.RegisterOrderHooks(app)
+	hooks.RegisterOrderItemHooks(app)
+	hooks.RegisterPaymentHooks(app)
+	hooks.RegisterCashSessionHooks(app)
+
+	sessions, err := app.FindCollectionByNameOrId(model.CashSessionCollection)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	session := core.NewRecord(sessions)
+	session.Id = testCashSession
+	session.Set("waiter", testCashWaiter)
+	session.Set("opening_float", 5000)
+	if err := app.Save(session); err != nil {
+		tb.Fatal(err)
+	}
+
+	payments, err := app.FindCollectionByNameOrId(model.PaymentCollection)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	payment := core.NewRecord(payments)
+	payment.Set("order_items", []string{"e5cxx50q2ln939x"})
+	payment.Set("tip_amount", 50)
+	payment.Set("payment_option", "3gie4k61or17sfk")
+	if err := app.Save(payment); err != nil {
+		tb.Fatal(err)
+	}
+	return app, session
+}
+
+func TestCashSessionReport(t *testing.T) {
+	app, session := newCashTestApp(t)
+	t.Cleanup(app.Cleanup)
+
+	report, err := fetchCashSessionReport(app, session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.CashTotal != 100 || report.CashTips != 50 || report.ExpectedAmount != 5150 || len(report.Payments) != 1 || report.Result != "" {
+		t.Errorf("unexpected report of the open session %+v", report)
+	}
+
+	// only closed sessions are exported
+	start, end := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	exported, err := fetchClosedCashSessions(app, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 0 {
+		t.Errorf("expected no closed cash sessions, got %+v", exported)
+	}
+
+	session.Set("closed", time.Now())
+	session.Set("difference", -30)
+	if err := app.Save(session); err != nil {
+		t.Fatal(err)
+	}
+	exported, err = fetchClosedCashSessions(app, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 1 || exported[0].Id != testCashSession || exported[0].Difference != -30 {
+		t.Errorf("expected the closed cash session to be exported, got %+v", exported)
+	}
+	report, err = fetchCashSessionReport(app, session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Result != "short" {
+		t.Errorf("expected the closed session to be short, got %+v", report)
+	}
+}
+
+func TestCloseCashSession(t *testing.T) {
+	user, err := newTestApp(t).FindRecordById(model.UserCollection, testCashWaiter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := user.NewAuthToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{"Authorization": token}
+
+	// roleAppFactory gives the waiter the role and registers the routes like routes.RegisterAPIRoutes
+	roleAppFactory := func(role string) func(t testing.TB) *tests.TestApp {
+		return func(t testing.TB) *tests.TestApp {
+			app, _ := newCashTestApp(t)
+			setUserRole(t, app, testCashWaiter, role)
+			app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+				e.Router.POST("/api/cash-sessions", OpenCashSessionHandler(e.App)).Bind(apis.RequireAuth(), RequireCapability(model.CapTakePayments))
+				e.Router.POST("/api/cash-sessions/{id}/close", CloseCashSessionHandler(e.App)).Bind(apis.RequireAuth(), RequireCapability(model.CapTakePayments))
+				return e.Next()
+			})
+			return app
+		}
+	}
+	appFactory := roleAppFactory(model.RoleKellner)
+	// otherWaiterSession gives the open session to another waiter
+	otherWaiterSession := func(t testing.TB) *tests.TestApp {
+		app := appFactory(t)
+		session, err := app.FindRecordById(model.CashSessionCollection, testCashSession)
+		if err != nil {
+			t.Fatal(err)
+		}
+		session.Set("waiter", "1p1725ql8j7u632")
+		if err := app.Save(session); err != nil {
+			t.Fatal(err)
+		}
+		return app
+	}
+	scenarios := []tests.ApiScenario{
+		{
+			Name:            "opening a second session",
+			Method:          http.MethodPost,
+			URL:             "/api/cash-sessions",
+			Body:            strings.NewReader(`{"opening_float":1000}`),
+			Headers:         headers,
+			ExpectedStatus:  409,
+			ExpectedContent: []string{"already has an open cash session"},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "opening a session for another waiter",
+			Method:          http.MethodPost,
+			URL:             "/api/cash-sessions",
+			Body:            strings.NewReader(`{"waiter":"1p1725ql8j7u632","opening_float":1000}`),
+			Headers:         headers,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{"Only the Kuechenchef may open the cash session of another waiter"},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "opening a session for another waiter as the Kuechenchef",
+			Method:          http.MethodPost,
+			URL:             "/api/cash-sessions",
+			Body:            strings.NewReader(`{"waiter":"1p1725ql8j7u632","opening_float":1000}`),
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"waiter":"1p1725ql8j7u632"`, `"opening_float":1000`, `"closed":""`, `"payments":[]`},
+			TestAppFactory:  roleAppFactory(model.RoleKuechenchef),
+		},
+		{
+			Name:            "opening a session as the kitchen",
+			Method:          http.MethodPost,
+			URL:             "/api/cash-sessions",
+			Body:            strings.NewReader(`{"opening_float":1000}`),
+			Headers:         headers,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{"The 'take_payments' permission is required"},
+			TestAppFactory:  roleAppFactory(model.RoleKueche),
+		},
+		{
+			Name:            "closing the session of another waiter",
+			Method:          http.MethodPost,
+			URL:             "/api/cash-sessions/" + testCashSession + "/close",
+			Body:            strings.NewReader(`{"counted_amount":5150}`),
+			Headers:         headers,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{"Only the Kuechenchef may close the cash session of another waiter"},
+			TestAppFactory:  otherWaiterSession,
+		},
+	}
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+
+	closedSession := tests.ApiScenario{
+		Name:            "closing a closed session",
+		Method:          http.MethodPost,
+		URL:             "/api/cash-sessions/" + testCashSession + "/close",
+		Body:            strings.NewReader(`{"counted_amount":5150}`),
+		Headers:         headers,
+		ExpectedStatus:  409,
+		ExpectedContent: []string{"already closed"},
+		TestAppFactory: func(t testing.TB) *tests.TestApp {
+			app := appFactory(t)
+			session, err := app.FindRecordById(model.CashSessionCollection, testCashSession)
+			if err != nil {
+				t.Fatal(err)
+			}
+			session.Set("closed", time.Now())
+			if err := app.Save(session); err != nil {
+				t.Fatal(err)
+			}
+			return app
+		},
+	}
+	closedSession.Test(t)
+
+	closeScenarios := []struct {
+		name     string
+		body     string
+		status   int
+		expected []string
+	}{
+		{"closing without a counted amount", `{}`, 400, []string{"Missing 'counted_amount'"}},
+		{"closing short", `{"counted_amount":5120}`, 200, []string{`"expected_amount":5150`, `"counted_amount":5120`, `"difference":-30`, `"result":"short"`}},
+		{"closing over", `{"counted_amount":5200}`, 200, []string{`"difference":50`, `"result":"over"`}},
+		{"closing balanced", `{"counted_amount":5150}`, 200, []string{`"difference":0`, `"result":"balanced"`}},
+	}
+	for _, s := range closeScenarios {
+		scenario := tests.ApiScenario{
+			Name:            s.name,
+			Method:          http.MethodPost,
+			URL:             "/api/cash-sessions/" + testCashSession + "/close",
+			Body:            strings.NewReader(s.body),
+			Headers:         headers,
+			ExpectedStatus:  s.status,
+			ExpectedContent: s.expected,
+			TestAppFactory:  appFactory,
+		}
+		scenario.Test(t)
+	}
+}
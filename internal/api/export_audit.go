@@ -0,0 +1,30 @@
+package api
+
+import (
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// auditExport records the export of the authenticated user in the "export_audit" collection.
+func auditExport(e *core.RequestEvent, format string, startTime, endTime time.Time) error {
+	collection, err := e.App.FindCollectionByNameOrId(model.ExportAuditCollection)
+	if err != nil {
+		return err
+	}
+
+	record := core.NewRecord(collection)
+	if e.Auth != nil {
+		if e.Auth.IsSuperuser() {
+			record.Set("superuser", e.Auth.Email())
+		} else {
+			record.Set("user", e.Auth.Id)
+		}
+	}
+	record.Set("format", format)
+	record.Set("start", startTime)
+	record.Set("end", endTime)
+	record.Set("ip", e.RealIP())
+	return e.App.Save(record)
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+func TestExportsRequirePermission(t *testing.T) {
+	app := newTestApp(t)
+	user, err := app.FindRecordById(model.UserCollection, "1p1725ql8j7u632")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userToken, err := user.NewAuthToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	superuser, err := app.FindAuthRecordByEmail(core.CollectionNameSuperusers, "admin@admin.admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	superuserToken, err := superuser.NewAuthToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// appFactory gives the user of the token the role and registers the routes like routes.RegisterAPIRoutes
+	appFactory := func(role string) func(t testing.TB) *tests.TestApp {
+		return func(t testing.TB) *tests.TestApp {
+			app, err := tests.NewTestApp(testDataDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			roleRecord, err := app.FindFirstRecordByData(model.UserRoleCollection, "role_name", role)
+			if err != nil {
+				t.Fatal(err)
+			}
+			user, err := app.FindRecordById(model.UserCollection, "1p1725ql8j7u632")
+			if err != nil {
+				t.Fatal(err)
+			}
+			user.Set("role", roleRecord.Id)
+			if err := app.Save(user); err != nil {
+				t.Fatal(err)
+			}
+
+			app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+				e.Router.GET("/api/test", TestHandler(e.App)).Bind(apis.RequireSuperuserAuth())
+				e.Router.GET("/api/export-json", ExportJSONHandler(e.App)).Bind(apis.RequireAuth(), RequireCapability(model.CapExportData))
+				e.Router.GET("/api/export-csv", ExportCSVHandler(e.App)).Bind(apis.RequireAuth(), RequireCapability(model.CapExportData))
+				return e.Next()
+			})
+			return app
+		}
+	}
+	// expectAudit checks the single audit entry written by the export
+	expectAudit := func(format, user, superuser string) func(t testing.TB, app *tests.TestApp, res *http.Response) {
+		return func(t testing.TB, app *tests.TestApp, res *http.Response) {
+			records, err := app.FindAllRecords(model.ExportAuditCollection)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 1 {
+				t.Fatalf("expected 1 audit entry, got %d", len(records))
+			}
+			audit := model.ExportAuditFromRecord(records[0])
+			if audit.Format != format || audit.User != user || audit.Superuser != superuser {
+				t.Errorf("unexpected audit entry %+v", audit)
+			}
+			if audit.Start.String() != "2025-01-01 00:00:00.000Z" || audit.End.String() != "2025-12-31 23:59:59.000Z" {
+				t.Errorf("unexpected audit range %s - %s", audit.Start, audit.End)
+			}
+		}
+	}
+	expectNoAudit := func(t testing.TB, app *tests.TestApp, res *http.Response) {
+		records, err := app.FindAllRecords(model.ExportAuditCollection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 0 {
+			t.Errorf("expected no audit entry, got %d", len(records))
+		}
+	}
+	exportQuery := "?start=2025-01-01T00:00:00Z&end=2025-12-31T23:59:59Z"
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:            "export without authentication",
+			Method:          http.MethodGet,
+			URL:             "/api/export-json" + exportQuery,
+			ExpectedStatus:  401,
+			ExpectedContent: []string{`"data":{}`},
+			TestAppFactory:  appFactory(model.RoleKuechenchef),
+			AfterTestFunc:   expectNoAudit,
+		},
+		{
+			Name:            "export of a Kellner",
+			Method:          http.MethodGet,
+			URL:             "/api/export-json" + exportQuery,
+			Headers:         map[string]string{"Authorization": userToken},
+			ExpectedStatus:  403,
+			ExpectedContent: []string{`"error":"The 'export_data' permission is required"`},
+			TestAppFactory:  appFactory(model.RoleKellner),
+			AfterTestFunc:   expectNoAudit,
+		},
+		{
+			Name:            "json export of the Kuechenchef",
+			Method:          http.MethodGet,
+			URL:             "/api/export-json" + exportQuery,
+			Headers:         map[string]string{"Authorization": userToken},
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"version":2`},
+			TestAppFactory:  appFactory(model.RoleKuechenchef),
+			AfterTestFunc:   expectAudit(model.ExportFormatJSON, "1p1725ql8j7u632", ""),
+		},
+		{
+			Name:            "csv export of a superuser",
+			Method:          http.MethodGet,
+			URL:             "/api/export-csv" + exportQuery,
+			Headers:         map[string]string{"Authorization": superuserToken},
+			ExpectedStatus:  200,
+			ExpectedContent: []string{"orders.csv"},
+			TestAppFactory:  appFactory(model.RoleKellner),
+			AfterTestFunc:   expectAudit(model.ExportFormatCSV, "", "admin@admin.admin"),
+		},
+		{
+			Name:            "export with invalid parameters",
+			Method:          http.MethodGet,
+			URL:             "/api/export-json?start=invalid",
+			Headers:         map[string]string{"Authorization": userToken},
+			ExpectedStatus:  400,
+			ExpectedContent: []string{`"error"`},
+			TestAppFactory:  appFactory(model.RoleKuechenchef),
+			AfterTestFunc:   expectNoAudit,
+		},
+		{
+			Name:            "user dump of the Kuechenchef",
+			Method:          http.MethodGet,
+			URL:             "/api/test",
+			Headers:         map[string]string{"Authorization": userToken},
+			ExpectedStatus:  403,
+			ExpectedContent: []string{`"data":{}`},
+			TestAppFactory:  appFactory(model.RoleKuechenchef),
+		},
+		{
+			Name:            "user dump of a superuser",
+			Method:          http.MethodGet,
+			URL:             "/api/test",
+			Headers:         map[string]string{"Authorization": superuserToken},
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"1p1725ql8j7u632"`},
+			TestAppFactory:  appFactory(model.RoleKellner),
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
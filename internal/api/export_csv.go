@@ -0,0 +1,112 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// ExportCSVHandler returns an Echo handler function that exports the same data as ExportJSONHandler
+// as a zip archive of flat CSV files (orders, order_items, payments, events, products).
+func ExportCSVHandler(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		// Parse and validate query parameters
+		startTime, endTime, err := parseQueryParams(e)
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		if err := auditExport(e, model.ExportFormatCSV, startTime, endTime); err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+
+		spool := newTableSpool(newCSVRowEncoder)
+		defer spool.cleanup()
+
+		if err := writeExportTables(app, startTime, endTime, spool); err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+
+		e.Response.Header().Set("Content-Disposition", `attachment; filename="export.zip"`)
+		e.Response.Header().Set("Content-Type", "application/zip")
+		e.Response.WriteHeader(http.StatusOK)
+
+		if err := writeCSVArchive(e.Response, spool); err != nil {
+			app.Logger().Error("Failed to write CSV export", "error", err)
+			return err
+		}
+		return nil
+	}
+}
+
+// writeCSVArchive writes every spooled table as <table>.csv into a zip archive
+func writeCSVArchive(w io.Writer, spool *tableSpool) error {
+	archive := zip.NewWriter(w)
+	for _, table := range exportTables {
+		entry, err := archive.Create(table.name + ".csv")
+		if err != nil {
+			return err
+		}
+		if err := spool.copyTo(entry, table); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// csvRowEncoder writes rows as CSV, starting with a header of the column names
+type csvRowEncoder struct {
+	writer *csv.Writer
+}
+
+func newCSVRowEncoder(w io.Writer, table exportTable) (rowEncoder, error) {
+	encoder := &csvRowEncoder{writer: csv.NewWriter(w)}
+	if err := encoder.writer.Write(table.columns); err != nil {
+		return nil, err
+	}
+	return encoder, nil
+}
+
+func (c *csvRowEncoder) encode(row []interface{}) error {
+	record := make([]string, len(row))
+	for i, value := range row {
+		record[i] = formatCSVValue(value)
+	}
+	return c.writer.Write(record)
+}
+
+func (c *csvRowEncoder) flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+func formatCSVValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return escapeCSVFormula(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// escapeCSVFormula prefixes text which spreadsheets would evaluate as a formula (e.g. notes starting
+// with "=") with a single quote, so the text is shown as is instead of being executed.
+func escapeCSVFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -1,7 +1,6 @@
 package api
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
@@ -9,14 +8,26 @@ import (
 	"github.com/labstack/echo/v5"
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
 )
 
+// ExportVersion is the version of the export document shape (ExportData and the Export* types).
+// Bump it whenever fields are renamed, removed or change their meaning.
+//
+// Version 2 resolves the station of the products, in version 1 it was the station id.
+const ExportVersion = 2
+
+// ExportData is the document written by ExportJSONHandler.
 type ExportData struct {
-	Filter    FilterData               `json:"filter"`
-	Products  []map[string]interface{} `json:"products"`
-	MenuItems []map[string]interface{} `json:"menu_items"`
-	Orders    []map[string]interface{} `json:"orders"`
-	Payments  []map[string]interface{} `json:"payments"`
+	Version   int              `json:"version"`
+	Filter    FilterData       `json:"filter"`
+	Products  []ExportProduct  `json:"products"`
+	MenuItems []model.MenuItem `json:"menu_items"`
+	Orders    []ExportOrder    `json:"orders"`
+	Payments  []ExportPayment  `json:"payments"`
+	// CashSessions are the closing reports of the cash sessions closed in the export range.
+	CashSessions []model.CashSession `json:"cash_sessions"`
 }
 
 type FilterData struct {
@@ -24,7 +35,46 @@ type FilterData struct {
 	End   time.Time `json:"end"`
 }
 
-// ExportJSONHandler returns an Echo handler function that exports JSON based on start and end datetime
+// ExportProduct is a product with its attributes and station resolved and its events of the export range.
+type ExportProduct struct {
+	model.Product
+	// Attribute replaces the attribute ids of model.Product with the attributes themselves.
+	Attribute []model.ProductAttribute `json:"attribute"`
+	// Station replaces the station id of model.Product with the station itself.
+	// It is null for products without (or with a deleted) station.
+	Station *model.Station `json:"station"`
+	Events  []model.Event  `json:"events,omitempty"`
+}
+
+// ExportOrder is an order with all of its order items and its events of the export range.
+type ExportOrder struct {
+	model.Order
+	OrderItems []ExportOrderItem `json:"order_items"`
+	Events     []model.Event     `json:"events,omitempty"`
+}
+
+// ExportOrderItem is an order item with its menu item resolved and its events of the export range.
+type ExportOrderItem struct {
+	model.OrderItem
+	// MenuItem replaces the menu item id of model.OrderItem with the menu item itself.
+	MenuItem *model.MenuItem `json:"menu_item"`
+	Events   []model.Event   `json:"events,omitempty"`
+}
+
+// ExportPayment is a payment with its payment option resolved and its events of the export range.
+type ExportPayment struct {
+	model.Payment
+	// PaymentOption replaces the payment option id of model.Payment with the payment option itself.
+	// It is null for payments without (or with a deleted) payment option.
+	PaymentOption *model.PaymentOption `json:"payment_option"`
+	Events        []model.Event        `json:"events,omitempty"`
+}
+
+// exportBatchSize is the number of orders and payments fetched (and streamed) at once.
+const exportBatchSize = 200
+
+// ExportJSONHandler returns an Echo handler function that exports JSON based on start and end datetime.
+// Orders and payments are streamed to the client in batches, so the export never has to be held in memory at once.
 func ExportJSONHandler(app core.App) func(e *core.RequestEvent) error {
 	return func(e *core.RequestEvent) error {
 		// Parse and validate query parameters
@@ -32,59 +82,138 @@ func ExportJSONHandler(app core.App) func(e *core.RequestEvent) error {
 		if err != nil {
 			return e.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
 		}
-
-		// Initialize the export data
-		exportData := ExportData{
-			Filter: FilterData{
-				Start: startTime,
-				End:   endTime,
-			},
+		if err := auditExport(e, model.ExportFormatJSON, startTime, endTime); err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 		}
 
-		// Fetch and enrich products
-		products, err := fetchAndEnrichProducts(app)
+		// Products and menu items are small and loaded up front, so failures
+		// can still be answered with a proper error status.
+		loader := newRelationLoader(app)
+		products, err := fetchAndEnrichProducts(app, loader, startTime, endTime)
 		if err != nil {
 			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 		}
-		exportData.Products = products
 
-		// Fetch all menu items
 		menuItems, err := fetchMenuItems(app)
 		if err != nil {
 			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 		}
-		exportData.MenuItems = menuItems
 
-		// Create a productsMap to easily attach product events
-		productsMap := make(map[string]map[string]interface{}, len(products))
-		for _, p := range products {
-			if idVal, ok := p["id"].(string); ok {
-				productsMap[idVal] = p
-			}
+		e.Response.Header().Set("Content-Disposition", `attachment; filename="export.json"`)
+		e.Response.Header().Set("Content-Type", "application/json")
+		e.Response.WriteHeader(http.StatusOK)
+
+		// The status is sent from here on, errors can only abort the stream.
+		stream := newJSONStreamWriter(e.Response)
+		filter := FilterData{
+			Start: startTime,
+			End:   endTime,
+		}
+		if err := streamExportData(app, loader, stream, filter, products, menuItems); err != nil {
+			app.Logger().Error("Failed to stream export data", "error", err)
+			return err
 		}
+		return nil
+	}
+}
 
-		// Fetch orders with order_items
-		orders, ordersMap, orderItemsMap, err := fetchOrdersWithItems(app, startTime, endTime)
-		if err != nil {
-			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+// streamExportData writes the export document in the shape of ExportData,
+// fetching orders and payments batch by batch while writing.
+func streamExportData(
+	app core.App,
+	loader *relationLoader,
+	stream *jsonStreamWriter,
+	filter FilterData,
+	products []ExportProduct,
+	menuItems []model.MenuItem,
+) error {
+	stream.beginObject()
+	stream.field("version", ExportVersion)
+	stream.field("filter", filter)
+	stream.field("products", products)
+	stream.field("menu_items", menuItems)
+
+	stream.beginArrayField("orders")
+	err := forEachOrderBatch(app, loader, filter.Start, filter.End, func(orders []ExportOrder) error {
+		for _, order := range orders {
+			stream.element(order)
 		}
-		exportData.Orders = orders
+		return stream.flush()
+	})
+	if err != nil {
+		return err
+	}
+	stream.endArray()
 
-		// Fetch payments
-		payments, paymentsMap, err := fetchAndEnrichPayments(app, startTime, endTime)
+	stream.beginArrayField("payments")
+	err = forEachPaymentBatch(app, loader, filter.Start, filter.End, func(payments []ExportPayment) error {
+		for _, payment := range payments {
+			stream.element(payment)
+		}
+		return stream.flush()
+	})
+	if err != nil {
+		return err
+	}
+	stream.endArray()
+
+	cashSessions, err := fetchClosedCashSessions(app, filter.Start, filter.End)
+	if err != nil {
+		return err
+	}
+	stream.field("cash_sessions", cashSessions)
+
+	stream.endObject()
+	return stream.flush()
+}
+
+// forEachOrderBatch pages through the orders of the time range and calls fn
+// with every batch, each order carrying its order_items and events.
+func forEachOrderBatch(app core.App, loader *relationLoader, startTime, endTime time.Time, fn func(orders []ExportOrder) error) error {
+	for offset := 0; ; offset += exportBatchSize {
+		orders, err := fetchOrdersWithItems(app, loader, startTime, endTime, exportBatchSize, offset)
 		if err != nil {
-			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+			return err
+		}
+		if len(orders) == 0 {
+			return nil
 		}
-		exportData.Payments = payments
 
-		// Fetch events and assign them to the appropriate objects
-		err = processEventsAndAssign(app, startTime, endTime, ordersMap, orderItemsMap, paymentsMap, productsMap)
+		if err := assignOrderEvents(app, startTime, endTime, orders); err != nil {
+			return err
+		}
+		if err := fn(orders); err != nil {
+			return err
+		}
+
+		if len(orders) < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+// forEachPaymentBatch pages through the payments of the time range and calls fn
+// with every batch, each payment carrying its events.
+func forEachPaymentBatch(app core.App, loader *relationLoader, startTime, endTime time.Time, fn func(payments []ExportPayment) error) error {
+	for offset := 0; ; offset += exportBatchSize {
+		payments, err := fetchAndEnrichPayments(app, loader, startTime, endTime, exportBatchSize, offset)
 		if err != nil {
-			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+			return err
+		}
+		if len(payments) == 0 {
+			return nil
 		}
 
-		// Serialize the export data to JSON with indentation for readability
-		return sendJSONResponse(e, exportData)
+		if err := assignPaymentEvents(app, startTime, endTime, payments); err != nil {
+			return err
+		}
+		if err := fn(payments); err != nil {
+			return err
+		}
+
+		if len(payments) < exportBatchSize {
+			return nil
+		}
 	}
 }
 
@@ -97,6 +226,11 @@ func parseQueryParams(e *core.RequestEvent) (time.Time, time.Time, error) {
 		return time.Time{}, time.Time{}, fmt.Errorf("Missing 'start' or 'end' query parameters")
 	}
 
+	return parseTimeRange(startStr, endStr)
+}
+
+// parseTimeRange parses and validates a range of RFC3339 datetimes
+func parseTimeRange(startStr, endStr string) (time.Time, time.Time, error) {
 	startTime, err := time.Parse(time.RFC3339, startStr)
 	if err != nil {
 		return time.Time{}, time.Time{}, fmt.Errorf("Invalid 'start' datetime format. Use RFC3339 format.")
@@ -114,49 +248,84 @@ func parseQueryParams(e *core.RequestEvent) (time.Time, time.Time, error) {
 	return startTime, endTime, nil
 }
 
-// fetchAndEnrichProducts fetches all products and enriches them with related data
-func fetchAndEnrichProducts(app core.App) ([]map[string]interface{}, error) {
-	productRecords, err := app.FindAllRecords("product")
+// fetchAndEnrichProducts fetches all products, enriches them with their attributes and station and attaches their events
+func fetchAndEnrichProducts(app core.App, loader *relationLoader, startTime, endTime time.Time) ([]ExportProduct, error) {
+	productRecords, err := app.FindAllRecords(model.ProductCollection)
 	if err != nil {
 		return nil, err
 	}
 
-	products := make([]map[string]interface{}, 0, len(productRecords))
+	// Load all referenced attributes and stations at once
 	for _, record := range productRecords {
-		productMap, err := getCleanRecordMap(record)
-		if err != nil {
-			return nil, err
+		loader.add(model.ProductAttributeCollection, record.GetStringSlice("attribute")...)
+		loader.add(model.StationCollection, record.GetString("station"))
+	}
+	if err := loader.load(); err != nil {
+		return nil, err
+	}
+
+	products := make([]ExportProduct, len(productRecords))
+	for i, record := range productRecords {
+		product := model.ProductFromRecord(record)
+
+		attributes := make([]model.ProductAttribute, 0, len(product.Attribute))
+		for _, attributeID := range product.Attribute {
+			// Attributes which do not exist (anymore) are skipped
+			if attributeRecord, ok := loader.get(model.ProductAttributeCollection, attributeID); ok {
+				attributes = append(attributes, model.ProductAttributeFromRecord(attributeRecord))
+			}
 		}
 
-		enrichedProductMap, err := enrichProductData(app, productMap)
-		if err != nil {
-			return nil, err
+		products[i] = ExportProduct{
+			Product:   product,
+			Attribute: attributes,
+		}
+		if stationRecord, ok := loader.get(model.StationCollection, product.Station); ok {
+			station := model.StationFromRecord(stationRecord)
+			products[i].Station = &station
 		}
+	}
 
-		products = append(products, enrichedProductMap)
+	targets := make(map[string]*[]model.Event, len(products))
+	for i := range products {
+		targets[products[i].Id] = &products[i].Events
+	}
+	if err := assignEvents(app, startTime, endTime, "product", "product_id", targets); err != nil {
+		return nil, err
 	}
+
 	return products, nil
 }
 
 // fetchMenuItems fetches all menu items
-func fetchMenuItems(app core.App) ([]map[string]interface{}, error) {
-	menuItemRecords, err := app.FindAllRecords("menu_item")
+func fetchMenuItems(app core.App) ([]model.MenuItem, error) {
+	menuItemRecords, err := app.FindAllRecords(model.MenuItemCollection)
 	if err != nil {
 		return nil, err
 	}
 
-	menuItems := make([]map[string]interface{}, 0, len(menuItemRecords))
-	for _, record := range menuItemRecords {
-		itemMap, err := getCleanRecordMap(record)
-		if err != nil {
-			return nil, err
-		}
-		menuItems = append(menuItems, itemMap)
+	menuItems := make([]model.MenuItem, len(menuItemRecords))
+	for i, record := range menuItemRecords {
+		menuItems[i] = model.MenuItemFromRecord(record)
 	}
 
 	return menuItems, nil
 }
 
+// createdRangeFilter is the record filter used to select records within the export range
+const createdRangeFilter = "created >= {:start} && created <= {:end}"
+
+// createdRangeParams returns the parameters for createdRangeFilter.
+// The times are formatted like PocketBase stores them, so they compare correctly as text.
+func createdRangeParams(startTime, endTime time.Time) dbx.Params {
+	start, _ := types.ParseDateTime(startTime)
+	end, _ := types.ParseDateTime(endTime)
+	return dbx.Params{
+		"start": start.String(),
+		"end":   end.String(),
+	}
+}
+
 func stringSliceToInterfaceSlice(strings []string) []interface{} {
 	interfaces := make([]interface{}, len(strings))
 	for i, v := range strings {
@@ -165,288 +334,177 @@ func stringSliceToInterfaceSlice(strings []string) []interface{} {
 	return interfaces
 }
 
-// fetchOrdersWithItems fetches orders and their associated order_items
-func fetchOrdersWithItems(app core.App, startTime, endTime time.Time) ([]map[string]interface{}, map[string]map[string]interface{}, map[string]map[string]interface{}, error) {
-	filter := "created >= {:start} && created <= {:end}"
-	params := dbx.Params{
-		"start": startTime,
-		"end":   endTime,
-	}
-	orderRecords, err := app.FindRecordsByFilter("order", filter, "", 0, 0, params)
+// fetchOrdersWithItems fetches one page of orders and their associated order_items
+func fetchOrdersWithItems(app core.App, loader *relationLoader, startTime, endTime time.Time, limit, offset int) ([]ExportOrder, error) {
+	orderRecords, err := app.FindRecordsByFilter(model.OrderCollection, createdRangeFilter, "created,id", limit, offset, createdRangeParams(startTime, endTime))
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
 
-	orders := make([]map[string]interface{}, 0, len(orderRecords))
-	ordersMap := make(map[string]map[string]interface{})
-
 	// Collect order IDs
 	orderIDs := make([]string, len(orderRecords))
 	for i, record := range orderRecords {
 		orderIDs[i] = record.Id
 	}
 
-	// Convert orderIDs to []interface{}
-	orderIDsInterface := stringSliceToInterfaceSlice(orderIDs)
-
 	// Fetch order_items associated with the orders
-	orderItemRecords, err := app.FindAllRecords("order_item", dbx.In("order", orderIDsInterface...))
+	orderItemRecords, err := app.FindAllRecords(model.OrderItemCollection, dbx.In("order", stringSliceToInterfaceSlice(orderIDs)...))
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
 
-	// Create maps for easy lookup
-	orderItemsByOrderID := make(map[string][]map[string]interface{})
-	orderItemsMap := make(map[string]map[string]interface{})
+	// Load all referenced menu items at once
+	for _, record := range orderItemRecords {
+		loader.add(model.MenuItemCollection, record.GetString("menu_item"))
+	}
+	if err := loader.load(); err != nil {
+		return nil, err
+	}
 
+	orderItemsByOrderID := make(map[string][]ExportOrderItem)
 	for _, record := range orderItemRecords {
-		orderItemMap, err := getCleanRecordMap(record)
-		if err != nil {
-			return nil, nil, nil, err
-		}
+		orderItem := ExportOrderItem{OrderItem: model.OrderItemFromRecord(record)}
 
 		// Enrich "menu_item"
-		if menuItemID, ok := orderItemMap["menu_item"].(string); ok && menuItemID != "" {
-			menuItemRecord, err := app.FindRecordById("menu_item", menuItemID)
+		if orderItem.OrderItem.MenuItem != "" {
+			menuItemRecord, err := loader.mustGet(model.MenuItemCollection, orderItem.OrderItem.MenuItem)
 			if err != nil {
-				return nil, nil, nil, err
-			}
-			menuItemMap, err := getCleanRecordMap(menuItemRecord)
-			if err != nil {
-				return nil, nil, nil, err
+				return nil, err
 			}
-			orderItemMap["menu_item"] = menuItemMap
+			menuItem := model.MenuItemFromRecord(menuItemRecord)
+			orderItem.MenuItem = &menuItem
 		}
 
-		orderItemID := record.Id
-		orderItemsMap[orderItemID] = orderItemMap
-
-		orderID := record.GetString("order")
-		orderItemsByOrderID[orderID] = append(orderItemsByOrderID[orderID], orderItemMap)
+		orderItemsByOrderID[orderItem.Order] = append(orderItemsByOrderID[orderItem.Order], orderItem)
 	}
 
 	// Attach order_items to orders
-	for _, record := range orderRecords {
-		orderMap, err := getCleanRecordMap(record)
-		if err != nil {
-			return nil, nil, nil, err
+	orders := make([]ExportOrder, len(orderRecords))
+	for i, record := range orderRecords {
+		orderItems := orderItemsByOrderID[record.Id]
+		if orderItems == nil {
+			orderItems = []ExportOrderItem{}
 		}
-
-		orderID := record.Id
-		if items, ok := orderItemsByOrderID[orderID]; ok {
-			orderMap["order_items"] = items
-		} else {
-			orderMap["order_items"] = []map[string]interface{}{}
+		orders[i] = ExportOrder{
+			Order:      model.OrderFromRecord(record),
+			OrderItems: orderItems,
 		}
-
-		orders = append(orders, orderMap)
-		ordersMap[orderID] = orderMap
 	}
 
-	return orders, ordersMap, orderItemsMap, nil
+	return orders, nil
 }
 
-// fetchAndEnrichPayments fetches payments and enriches them with related data
-func fetchAndEnrichPayments(app core.App, startTime, endTime time.Time) ([]map[string]interface{}, map[string]map[string]interface{}, error) {
-	filter := "created >= {:start} && created <= {:end}"
-	params := dbx.Params{
-		"start": startTime,
-		"end":   endTime,
-	}
-	paymentRecords, err := app.FindRecordsByFilter("payment", filter, "", 0, 0, params)
+// fetchAndEnrichPayments fetches one page of payments and enriches them with their payment option
+func fetchAndEnrichPayments(app core.App, loader *relationLoader, startTime, endTime time.Time, limit, offset int) ([]ExportPayment, error) {
+	paymentRecords, err := app.FindRecordsByFilter(model.PaymentCollection, createdRangeFilter, "created,id", limit, offset, createdRangeParams(startTime, endTime))
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	payments := make([]map[string]interface{}, 0, len(paymentRecords))
-	paymentsMap := make(map[string]map[string]interface{})
-
+	// Load all referenced payment options at once
 	for _, record := range paymentRecords {
-		paymentMap, err := getCleanRecordMap(record)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		// Enrich 'payment_option' in payment
-		enrichedPaymentMap, err := enrichPaymentData(app, paymentMap)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		payments = append(payments, enrichedPaymentMap)
-		paymentsMap[record.Id] = enrichedPaymentMap
+		loader.add(model.PaymentOptionCollection, record.GetString("payment_option"))
 	}
-	return payments, paymentsMap, nil
-}
-
-// processEventsAndAssign processes events and assigns them to orders, order_items, or payments
-func processEventsAndAssign(
-	app core.App,
-	startTime, endTime time.Time,
-	ordersMap, orderItemsMap, paymentsMap, productsMap map[string]map[string]interface{},
-) error {
-	filter := "created >= {:start} && created <= {:end}"
-	params := dbx.Params{
-		"start": startTime,
-		"end":   endTime,
-	}
-
-	eventRecords, err := app.FindRecordsByFilter("event", filter, "", 0, 0, params)
-	if err != nil {
-		return err
+	if err := loader.load(); err != nil {
+		return nil, err
 	}
 
-	for _, record := range eventRecords {
-		eventMap, err := getCleanRecordMap(record)
-		if err != nil {
-			return err
-		}
-
-		// Get 'type' and 'content' from event
-		eventType, _ := eventMap["type"].(string)
-		contentRaw, _ := eventMap["content"]
-		content, _ := contentRaw.(map[string]interface{})
-
-		if content == nil {
-			continue // Skip events without content
-		}
+	payments := make([]ExportPayment, len(paymentRecords))
+	for i, record := range paymentRecords {
+		payment := ExportPayment{Payment: model.PaymentFromRecord(record)}
 
-		switch eventType {
-		case "order_item":
-			orderItemID, _ := content["order_item_id"].(string)
-			if orderItem, ok := orderItemsMap[orderItemID]; ok {
-				appendEvent(orderItem, eventMap)
-			}
-		case "order":
-			orderID, _ := content["order_id"].(string)
-			if order, ok := ordersMap[orderID]; ok {
-				appendEvent(order, eventMap)
-			}
-		case "payment":
-			paymentID, _ := content["payment_id"].(string)
-			if payment, ok := paymentsMap[paymentID]; ok {
-				appendEvent(payment, eventMap)
-			}
-		case "product":
-			// Handle product events
-			productID, _ := content["product_id"].(string)
-			if product, ok := productsMap[productID]; ok {
-				appendEvent(product, eventMap)
-			}
-		default:
-			// Unknown type, ignore or handle as needed
+		// Enrich 'payment_option' in payment
+		if paymentOptionRecord, ok := loader.get(model.PaymentOptionCollection, payment.Payment.PaymentOption); ok {
+			paymentOption := model.PaymentOptionFromRecord(paymentOptionRecord)
+			payment.PaymentOption = &paymentOption
 		}
-	}
 
-	return nil
-}
-
-// appendEvent appends an event to the 'events' slice of the object
-func appendEvent(obj map[string]interface{}, eventMap map[string]interface{}) {
-	events, ok := obj["events"].([]interface{})
-	if !ok {
-		events = []interface{}{}
+		payments[i] = payment
 	}
-	events = append(events, eventMap)
-	obj["events"] = events
+	return payments, nil
 }
 
-// sendJSONResponse sends the JSON response as a downloadable file
-func sendJSONResponse(e *core.RequestEvent, data ExportData) error {
-	jsonData, err := json.MarshalIndent(data, "", "  ")
+// fetchClosedCashSessions fetches the cash sessions closed in the time range, the open ones have no closing report yet
+func fetchClosedCashSessions(app core.App, startTime, endTime time.Time) ([]model.CashSession, error) {
+	records, err := app.FindRecordsByFilter(
+		model.CashSessionCollection,
+		"closed != '' && closed >= {:start} && closed <= {:end}",
+		"closed,id",
+		0,
+		0,
+		createdRangeParams(startTime, endTime),
+	)
 	if err != nil {
-		return e.InternalServerError("Failed to serialize export data to JSON", err)
+		return nil, err
 	}
 
-	e.Response.Header().Set("Content-Disposition", `attachment; filename="export.json"`)
-
-	return e.Blob(http.StatusOK, "application/json", jsonData)
+	cashSessions := make([]model.CashSession, len(records))
+	for i, record := range records {
+		cashSessions[i] = model.CashSessionFromRecord(record)
+	}
+	return cashSessions, nil
 }
 
-// getCleanRecordMap converts a Record to a clean map without collection metadata
-func getCleanRecordMap(record *core.Record) (map[string]interface{}, error) {
-	var recordMap map[string]interface{}
-
-	// Marshal the record to JSON
-	jsonBytes, err := json.Marshal(record)
-	if err != nil {
-		return nil, err
+// assignOrderEvents attaches the events of the time range to a batch of orders and their order_items
+func assignOrderEvents(app core.App, startTime, endTime time.Time, orders []ExportOrder) error {
+	orderTargets := make(map[string]*[]model.Event, len(orders))
+	orderItemTargets := make(map[string]*[]model.Event)
+	for i := range orders {
+		orderTargets[orders[i].Id] = &orders[i].Events
+		for j := range orders[i].OrderItems {
+			orderItemTargets[orders[i].OrderItems[j].Id] = &orders[i].OrderItems[j].Events
+		}
 	}
 
-	// Unmarshal the JSON back into a map
-	err = json.Unmarshal(jsonBytes, &recordMap)
-	if err != nil {
-		return nil, err
+	if err := assignEvents(app, startTime, endTime, "order", "order_id", orderTargets); err != nil {
+		return err
 	}
-
-	return cleanRecordMap(recordMap), nil
+	return assignEvents(app, startTime, endTime, "order_item", "order_item_id", orderItemTargets)
 }
 
-// cleanRecordMap removes collection metadata from the record map
-func cleanRecordMap(recordMap map[string]interface{}) map[string]interface{} {
-	delete(recordMap, "collectionId")
-	delete(recordMap, "collectionName")
-	return recordMap
+// assignPaymentEvents attaches the events of the time range to a batch of payments
+func assignPaymentEvents(app core.App, startTime, endTime time.Time, payments []ExportPayment) error {
+	targets := make(map[string]*[]model.Event, len(payments))
+	for i := range payments {
+		targets[payments[i].Id] = &payments[i].Events
+	}
+	return assignEvents(app, startTime, endTime, "payment", "payment_id", targets)
 }
 
-// enrichProductData adds detailed information for attributes, station, and category
-func enrichProductData(app core.App, productMap map[string]interface{}) (map[string]interface{}, error) {
-	// Enrich Attribute
-	if attributes, ok := productMap["attribute"].([]interface{}); ok && len(attributes) > 0 {
-		enrichedAttributes := make([]map[string]interface{}, 0, len(attributes))
-		for _, attrID := range attributes {
-			attrRecord, err := app.FindRecordById("product_attribute", attrID.(string))
-			if err == nil {
-				attrMap, err := getCleanRecordMap(attrRecord)
-				if err != nil {
-					return nil, err
-				}
-				enrichedAttributes = append(enrichedAttributes, attrMap)
-			}
-		}
-		productMap["attribute"] = enrichedAttributes
+// assignEvents fetches the events of the given type whose content references one of the
+// targets (by contentKey, e.g. "order_id") and appends them to the events of that target
+func assignEvents(
+	app core.App,
+	startTime, endTime time.Time,
+	eventType, contentKey string,
+	targets map[string]*[]model.Event,
+) error {
+	if len(targets) == 0 {
+		return nil
 	}
 
-	// Enrich Category
-	if categoryID, ok := productMap["category"].(string); ok {
-		categoryRecord, err := app.FindRecordById("product_categ", categoryID)
-		if err == nil {
-			categoryMap, err := getCleanRecordMap(categoryRecord)
-			if err != nil {
-				return nil, err
-			}
-			productMap["category"] = categoryMap
-		}
+	ids := make([]interface{}, 0, len(targets))
+	for id := range targets {
+		ids = append(ids, id)
 	}
 
-	// Enrich Station
-	if stationID, ok := productMap["station"].(string); ok {
-		stationRecord, err := app.FindRecordById("station", stationID)
-		if err == nil {
-			stationMap, err := getCleanRecordMap(stationRecord)
-			if err != nil {
-				return nil, err
-			}
-			productMap["station"] = stationMap
-		}
+	eventRecords := []*core.Record{}
+	err := app.RecordQuery(model.EventCollection).
+		AndWhere(dbx.NewExp("[[created]] >= {:start} AND [[created]] <= {:end}", createdRangeParams(startTime, endTime))).
+		AndWhere(dbx.HashExp{"type": eventType}).
+		AndWhere(dbx.In("json_extract([[content]], '$."+contentKey+"')", ids...)).
+		OrderBy("created ASC", "id ASC").
+		All(&eventRecords)
+	if err != nil {
+		return err
 	}
 
-	return productMap, nil
-}
-
-// enrichPaymentData enriches 'payment_option' in payment with full details
-func enrichPaymentData(app core.App, paymentMap map[string]interface{}) (map[string]interface{}, error) {
-	// Enrich 'payment_option'
-	if paymentOptionID, ok := paymentMap["payment_option"].(string); ok {
-		paymentOptionRecord, err := app.FindRecordById("payment_option", paymentOptionID)
-		if err == nil {
-			paymentOptionMap, err := getCleanRecordMap(paymentOptionRecord)
-			if err != nil {
-				return nil, err
-			}
-			paymentMap["payment_option"] = paymentOptionMap
+	for _, record := range eventRecords {
+		event := model.EventFromRecord(record)
+		if events, ok := targets[event.ContentString(contentKey)]; ok {
+			*events = append(*events, event)
 		}
 	}
 
-	return paymentMap, nil
+	return nil
 }
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tests"
+	_ "github.com/supotsu-no-ochaya/backend/migrations"
+)
+
+// Run `go test ./internal/api -run TestExportJSONGolden -update` to regenerate the golden files
+// after an intended change of the export shape (remember to bump ExportVersion).
+var updateGolden = flag.Bool("update", false, "update the golden files")
+
+const testDataDir = "../../testdata/v5/pb_data"
+
+var (
+	testExportStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	testExportEnd   = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func newTestApp(tb testing.TB) *tests.TestApp {
+	tb.Helper()
+	app, err := tests.NewTestApp(testDataDir)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(app.Cleanup)
+	return app
+}
+
+func TestExportJSONGolden(t *testing.T) {
+	scenarios := []struct {
+		name       string
+		start, end time.Time
+	}{
+		{"full", testExportStart, testExportEnd},
+		// only the orders of 2025-01-23 and the events created that day
+		{"single_day", time.Date(2025, 1, 23, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 23, 23, 59, 59, 0, time.UTC)},
+		{"empty", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			app := newTestApp(t)
+
+			var buf bytes.Buffer
+			loader := newRelationLoader(app)
+			products, err := fetchAndEnrichProducts(app, loader, s.start, s.end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			menuItems, err := fetchMenuItems(app)
+			if err != nil {
+				t.Fatal(err)
+			}
+			filter := FilterData{Start: s.start, End: s.end}
+			if err := streamExportData(app, loader, newJSONStreamWriter(&buf), filter, products, menuItems); err != nil {
+				t.Fatal(err)
+			}
+
+			// the streamed document has to be valid and match the ExportData type
+			var data ExportData
+			if err := json.Unmarshal(buf.Bytes(), &data); err != nil {
+				t.Fatalf("invalid export document: %v", err)
+			}
+			if data.Version != ExportVersion {
+				t.Errorf("expected version %d, got %d", ExportVersion, data.Version)
+			}
+
+			golden := filepath.Join("testdata", fmt.Sprintf("export_v%d_%s.golden.json", ExportVersion, s.name))
+			if *updateGolden {
+				if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(expected, buf.Bytes()) {
+				t.Errorf("export does not match %s, rerun with -update if the change is intended", golden)
+			}
+		})
+	}
+}
+
+func TestExportProductsResolveStation(t *testing.T) {
+	app := newTestApp(t)
+	product, err := app.FindRecordById("product", "bn6pmb6r44w50m9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	product.Set("station", "w8qc24zj57849cj")
+	if err := app.Save(product); err != nil {
+		t.Fatal(err)
+	}
+
+	products, err := fetchAndEnrichProducts(app, newRelationLoader(app), testExportStart, testExportEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range products {
+		switch {
+		case p.Id == product.Id && (p.Station == nil || p.Station.Id != "w8qc24zj57849cj" || p.Station.Name == ""):
+			t.Errorf("expected the station of %s to be resolved, got %+v", p.Name, p.Station)
+		case p.Id != product.Id && p.Station != nil:
+			t.Errorf("expected no station for %s, got %+v", p.Name, p.Station)
+		}
+	}
+}
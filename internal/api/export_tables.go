@@ -0,0 +1,232 @@
+package api
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// exportTable describes one flat table of the tabular (CSV/XLSX) exports.
+type exportTable struct {
+	name    string
+	columns []string
+}
+
+var (
+	ordersTable = exportTable{
+		name:    "orders",
+		columns: []string{"id", "table", "dining_table", "waiter", "status", "person", "created", "updated"},
+	}
+	orderItemsTable = exportTable{
+		name:    "order_items",
+		columns: []string{"id", "order", "menu_item", "menu_item_name", "price", "status", "notes", "products", "created", "updated"},
+	}
+	paymentsTable = exportTable{
+		name:    "payments",
+		columns: []string{"id", "subtotal_amount", "discount_amount", "total_amount", "tip_amount", "discount_percent", "payment_option", "payment_option_name", "order_items", "person", "cash_session", "created", "updated"},
+	}
+	eventsTable = exportTable{
+		name:    "events",
+		columns: []string{"id", "type", "target_id", "status", "content", "created"},
+	}
+	productsTable = exportTable{
+		name:    "products",
+		columns: []string{"id", "name", "is_available", "type", "station", "attributes", "track_stock", "stock", "created", "updated"},
+	}
+	cashSessionsTable = exportTable{
+		name:    "cash_sessions",
+		columns: []string{"id", "waiter", "opening_float", "cash_total", "cash_tips", "expected_amount", "counted_amount", "difference", "created", "closed"},
+	}
+)
+
+// exportTables lists the tables of the tabular exports in the order they are written.
+var exportTables = []exportTable{ordersTable, orderItemsTable, paymentsTable, eventsTable, productsTable, cashSessionsTable}
+
+// tableWriter receives the rows of the tabular exports.
+// A row holds one value per column of the table, either a string, float64 or bool.
+type tableWriter interface {
+	writeRow(table exportTable, row []interface{}) error
+}
+
+// writeExportTables fetches the same data as the JSON export and writes it as flat rows.
+// The 'start'/'end' range applies exactly like in ExportJSONHandler.
+func writeExportTables(app core.App, startTime, endTime time.Time, w tableWriter) error {
+	loader := newRelationLoader(app)
+
+	products, err := fetchAndEnrichProducts(app, loader, startTime, endTime)
+	if err != nil {
+		return err
+	}
+	for _, product := range products {
+		if err := writeRowWithEvents(w, productsTable, productRow(product), product.Events); err != nil {
+			return err
+		}
+	}
+
+	err = forEachOrderBatch(app, loader, startTime, endTime, func(orders []ExportOrder) error {
+		for _, order := range orders {
+			if err := writeRowWithEvents(w, ordersTable, orderRow(order), order.Events); err != nil {
+				return err
+			}
+
+			for _, orderItem := range order.OrderItems {
+				if err := writeRowWithEvents(w, orderItemsTable, orderItemRow(orderItem), orderItem.Events); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = forEachPaymentBatch(app, loader, startTime, endTime, func(payments []ExportPayment) error {
+		for _, payment := range payments {
+			if err := writeRowWithEvents(w, paymentsTable, paymentRow(payment), payment.Events); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	cashSessions, err := fetchClosedCashSessions(app, startTime, endTime)
+	if err != nil {
+		return err
+	}
+	for _, cashSession := range cashSessions {
+		if err := w.writeRow(cashSessionsTable, cashSessionRow(cashSession)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRowWithEvents writes the row followed by the given events of the same object
+func writeRowWithEvents(w tableWriter, table exportTable, row []interface{}, events []model.Event) error {
+	if err := w.writeRow(table, row); err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		if err := w.writeRow(eventsTable, eventRow(event)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func orderRow(order ExportOrder) []interface{} {
+	return []interface{}{
+		order.Id,
+		order.Table,
+		order.DiningTable,
+		order.Waiter,
+		order.Status,
+		float64(order.Person),
+		order.Created.String(),
+		order.Updated.String(),
+	}
+}
+
+func orderItemRow(orderItem ExportOrderItem) []interface{} {
+	menuItemName := ""
+	if orderItem.MenuItem != nil {
+		menuItemName = orderItem.MenuItem.Name
+	}
+
+	return []interface{}{
+		orderItem.Id,
+		orderItem.Order,
+		orderItem.OrderItem.MenuItem,
+		menuItemName,
+		orderItem.Price,
+		orderItem.Status,
+		orderItem.Notes,
+		strings.Join(orderItem.Products, ";"),
+		orderItem.Created.String(),
+		orderItem.Updated.String(),
+	}
+}
+
+func paymentRow(payment ExportPayment) []interface{} {
+	paymentOptionName := ""
+	if payment.PaymentOption != nil {
+		paymentOptionName = payment.PaymentOption.Name
+	}
+
+	return []interface{}{
+		payment.Id,
+		payment.SubtotalAmount,
+		payment.DiscountAmount,
+		payment.TotalAmount,
+		payment.TipAmount,
+		payment.DiscountPercent,
+		payment.Payment.PaymentOption,
+		paymentOptionName,
+		strings.Join(payment.OrderItems, ";"),
+		float64(payment.Person),
+		payment.CashSession,
+		payment.Created.String(),
+		payment.Updated.String(),
+	}
+}
+
+func cashSessionRow(cashSession model.CashSession) []interface{} {
+	return []interface{}{
+		cashSession.Id,
+		cashSession.Waiter,
+		cashSession.OpeningFloat,
+		cashSession.CashTotal,
+		cashSession.CashTips,
+		cashSession.ExpectedAmount,
+		cashSession.CountedAmount,
+		cashSession.Difference,
+		cashSession.Created.String(),
+		cashSession.Closed.String(),
+	}
+}
+
+func productRow(product ExportProduct) []interface{} {
+	attributeNames := make([]string, 0, len(product.Attribute))
+	for _, attribute := range product.Attribute {
+		attributeNames = append(attributeNames, attribute.Name)
+	}
+
+	return []interface{}{
+		product.Id,
+		product.Name,
+		product.IsAvailable,
+		product.Type,
+		product.Product.Station,
+		strings.Join(attributeNames, ";"),
+		product.TrackStock,
+		float64(product.Stock),
+		product.Created.String(),
+		product.Updated.String(),
+	}
+}
+
+func eventRow(event model.Event) []interface{} {
+	targetID := ""
+	for _, key := range []string{"order_id", "order_item_id", "payment_id", "product_id"} {
+		if id := event.ContentString(key); id != "" {
+			targetID = id
+			break
+		}
+	}
+
+	return []interface{}{
+		event.Id,
+		event.Type,
+		targetID,
+		event.ContentString("status"),
+		event.Content.String(),
+		event.Created.String(),
+	}
+}
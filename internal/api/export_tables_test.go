@@ -0,0 +1,127 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"testing"
+)
+
+func TestCSVArchiveContainsAllTables(t *testing.T) {
+	app := newTestApp(t)
+
+	spool := newTableSpool(newCSVRowEncoder)
+	defer spool.cleanup()
+	if err := writeExportTables(app, testExportStart, testExportEnd, spool); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeCSVArchive(&buf, spool); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedRows := map[string]int{
+		"orders.csv":      4,
+		"order_items.csv": 12,
+		"payments.csv":    1,
+		"products.csv":    36,
+	}
+	if len(archive.File) != len(exportTables) {
+		t.Fatalf("expected %d files, got %d", len(exportTables), len(archive.File))
+	}
+	for _, file := range archive.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		records, err := csv.NewReader(f).ReadAll()
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", file.Name, err)
+		}
+		if len(records) == 0 {
+			t.Fatalf("%s: missing header", file.Name)
+		}
+		if expected, ok := expectedRows[file.Name]; ok && len(records)-1 != expected {
+			t.Errorf("%s: expected %d rows, got %d", file.Name, expected, len(records)-1)
+		}
+	}
+}
+
+func TestCSVEscapesFormulas(t *testing.T) {
+	scenarios := []struct {
+		value    interface{}
+		expected string
+	}{
+		{"=HYPERLINK(\"http://example.com\")", "'=HYPERLINK(\"http://example.com\")"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tx", "'\tx"},
+		{"extra scharf", "extra scharf"},
+		{"a=b", "a=b"},
+		{"", ""},
+		{-1.5, "-1.5"},
+	}
+
+	for _, s := range scenarios {
+		if got := formatCSVValue(s.value); got != s.expected {
+			t.Errorf("%#v: expected %q, got %q", s.value, s.expected, got)
+		}
+	}
+}
+
+func TestXLSXWorkbookHasOneSheetPerTable(t *testing.T) {
+	spool := newTableSpool(newXLSXRowEncoder)
+	defer spool.cleanup()
+	if err := spool.writeRow(ordersTable, []interface{}{"abc", 3.0, "w", "Aufgegeben <&>", 2.0, "", ""}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeXLSXWorkbook(&buf, spool); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{}
+	for _, file := range archive.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(f)
+		f.Close()
+		files[file.Name] = string(content)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet5.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("missing part %s", name)
+		}
+	}
+	sheet := files["xl/worksheets/sheet1.xml"]
+	if !bytes.Contains([]byte(sheet), []byte(`<c r="B2"><v>3</v></c>`)) {
+		t.Errorf("expected numeric cell B2, got %s", sheet)
+	}
+	if !bytes.Contains([]byte(sheet), []byte(`Aufgegeben &lt;&amp;&gt;`)) {
+		t.Errorf("expected escaped string cell, got %s", sheet)
+	}
+}
+
+func TestXLSXColumnName(t *testing.T) {
+	for index, expected := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := xlsxColumnName(index); got != expected {
+			t.Errorf("xlsxColumnName(%d) = %s, want %s", index, got, expected)
+		}
+	}
+}
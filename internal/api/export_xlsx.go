@@ -0,0 +1,187 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// ExportXLSXHandler returns an Echo handler function that exports the same data as ExportCSVHandler
+// as a single XLSX workbook with one sheet per table.
+func ExportXLSXHandler(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		// Parse and validate query parameters
+		startTime, endTime, err := parseQueryParams(e)
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		if err := auditExport(e, model.ExportFormatXLSX, startTime, endTime); err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+
+		spool := newTableSpool(newXLSXRowEncoder)
+		defer spool.cleanup()
+
+		if err := writeExportTables(app, startTime, endTime, spool); err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+
+		e.Response.Header().Set("Content-Disposition", `attachment; filename="export.xlsx"`)
+		e.Response.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		e.Response.WriteHeader(http.StatusOK)
+
+		if err := writeXLSXWorkbook(e.Response, spool); err != nil {
+			app.Logger().Error("Failed to write XLSX export", "error", err)
+			return err
+		}
+		return nil
+	}
+}
+
+// writeXLSXWorkbook writes a minimal SpreadsheetML workbook with one sheet per spooled table.
+// Only the parts required by Excel and LibreOffice are written, strings are stored inline.
+func writeXLSXWorkbook(w io.Writer, spool *tableSpool) error {
+	archive := zip.NewWriter(w)
+
+	var contentTypes, workbook, workbookRels strings.Builder
+	contentTypes.WriteString(xml.Header)
+	contentTypes.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	contentTypes.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	contentTypes.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	contentTypes.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+
+	workbook.WriteString(xml.Header)
+	workbook.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+
+	workbookRels.WriteString(xml.Header)
+	workbookRels.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+
+	for i, table := range exportTables {
+		sheet := i + 1
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, sheet)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(table.name), sheet, sheet)
+		fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, sheet, sheet)
+	}
+
+	contentTypes.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	workbookRels.WriteString(`</Relationships>`)
+
+	rootRels := xml.Header +
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", contentTypes.String()},
+		{"_rels/.rels", rootRels},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", workbookRels.String()},
+	}
+	for _, part := range parts {
+		entry, err := archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(entry, part.content); err != nil {
+			return err
+		}
+	}
+
+	for i, table := range exportTables {
+		entry, err := archive.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1))
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(entry, xml.Header+`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); err != nil {
+			return err
+		}
+		if err := spool.copyTo(entry, table); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(entry, `</sheetData></worksheet>`); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// xlsxRowEncoder writes rows as <row> elements of a sheet, starting with a header of the column names
+type xlsxRowEncoder struct {
+	w   io.Writer
+	row int
+}
+
+func newXLSXRowEncoder(w io.Writer, table exportTable) (rowEncoder, error) {
+	encoder := &xlsxRowEncoder{w: w}
+	header := make([]interface{}, len(table.columns))
+	for i, column := range table.columns {
+		header[i] = column
+	}
+	if err := encoder.encode(header); err != nil {
+		return nil, err
+	}
+	return encoder, nil
+}
+
+func (x *xlsxRowEncoder) encode(row []interface{}) error {
+	x.row++
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<row r="%d">`, x.row)
+	for i, value := range row {
+		ref := xlsxColumnName(i) + strconv.Itoa(x.row)
+		switch v := value.(type) {
+		case float64:
+			fmt.Fprintf(&sb, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			b := 0
+			if v {
+				b = 1
+			}
+			fmt.Fprintf(&sb, `<c r="%s" t="b"><v>%d</v></c>`, ref, b)
+		default:
+			s := formatCSVValue(v)
+			if s == "" {
+				continue
+			}
+			fmt.Fprintf(&sb, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xmlEscape(s))
+		}
+	}
+	sb.WriteString(`</row>`)
+
+	_, err := io.WriteString(x.w, sb.String())
+	return err
+}
+
+func (x *xlsxRowEncoder) flush() error {
+	return nil
+}
+
+// xlsxColumnName converts a zero based column index into its spreadsheet name (0 -> A, 26 -> AA)
+func xlsxColumnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+func xmlEscape(s string) string {
+	var sb strings.Builder
+	_ = xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// jsonStreamWriter writes a JSON document piece by piece, so large exports
+// never have to be held in memory as a whole.
+// The output is indented the same way json.MarshalIndent(v, "", "  ") would be.
+//
+// The first write error is remembered and all following writes become no-ops,
+// so callers only need to check Err (or the result of flush) once in a while.
+type jsonStreamWriter struct {
+	out    *bufio.Writer
+	target io.Writer
+	// empty holds one entry per open object/array telling whether nothing
+	// has been written into it yet.
+	empty []bool
+	err   error
+}
+
+func newJSONStreamWriter(w io.Writer) *jsonStreamWriter {
+	return &jsonStreamWriter{
+		out:    bufio.NewWriter(w),
+		target: w,
+	}
+}
+
+// beginObject opens a top level JSON object.
+func (s *jsonStreamWriter) beginObject() {
+	s.writeRaw("{")
+	s.empty = append(s.empty, true)
+}
+
+// field writes a complete "name": value pair into the current object.
+func (s *jsonStreamWriter) field(name string, v interface{}) {
+	s.writeKey(name)
+	s.writeValue(v)
+}
+
+// beginArrayField opens an array valued field in the current object.
+func (s *jsonStreamWriter) beginArrayField(name string) {
+	s.writeKey(name)
+	s.writeRaw("[")
+	s.empty = append(s.empty, true)
+}
+
+// element appends a value to the current array.
+func (s *jsonStreamWriter) element(v interface{}) {
+	s.writeSeparator()
+	s.writeValue(v)
+}
+
+// endArray closes the current array.
+func (s *jsonStreamWriter) endArray() {
+	s.end("]")
+}
+
+// endObject closes the current object.
+func (s *jsonStreamWriter) endObject() {
+	s.end("}")
+}
+
+// flush pushes everything buffered so far to the client.
+func (s *jsonStreamWriter) flush() error {
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.out.Flush(); err != nil {
+		s.err = err
+		return err
+	}
+	if rw, ok := s.target.(http.ResponseWriter); ok {
+		err := http.NewResponseController(rw).Flush()
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			s.err = err
+		}
+	}
+	return s.err
+}
+
+// Err returns the first error that occurred while writing.
+func (s *jsonStreamWriter) Err() error {
+	return s.err
+}
+
+func (s *jsonStreamWriter) end(closing string) {
+	if len(s.empty) == 0 {
+		return
+	}
+	wasEmpty := s.empty[len(s.empty)-1]
+	s.empty = s.empty[:len(s.empty)-1]
+	if !wasEmpty {
+		s.writeRaw("\n" + s.indent())
+	}
+	s.writeRaw(closing)
+}
+
+func (s *jsonStreamWriter) writeKey(name string) {
+	s.writeSeparator()
+	key, err := json.Marshal(name)
+	if err != nil {
+		s.err = err
+		return
+	}
+	s.writeRaw(string(key) + ": ")
+}
+
+// writeSeparator writes the comma (if needed) and line break in front of the
+// next entry of the current container.
+func (s *jsonStreamWriter) writeSeparator() {
+	if len(s.empty) == 0 {
+		return
+	}
+	if s.empty[len(s.empty)-1] {
+		s.empty[len(s.empty)-1] = false
+		s.writeRaw("\n" + s.indent())
+		return
+	}
+	s.writeRaw(",\n" + s.indent())
+}
+
+func (s *jsonStreamWriter) writeValue(v interface{}) {
+	if s.err != nil {
+		return
+	}
+	data, err := json.MarshalIndent(v, s.indent(), "  ")
+	if err != nil {
+		s.err = err
+		return
+	}
+	s.writeRaw(string(data))
+}
+
+func (s *jsonStreamWriter) writeRaw(str string) {
+	if s.err != nil {
+		return
+	}
+	if _, err := s.out.WriteString(str); err != nil {
+		s.err = err
+	}
+}
+
+func (s *jsonStreamWriter) indent() string {
+	return strings.Repeat("  ", len(s.empty))
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("connection closed")
+}
+
+func TestJSONStreamWriter(t *testing.T) {
+	type entry struct {
+		Name  string   `json:"name"`
+		Tags  []string `json:"tags"`
+		Price float64  `json:"price"`
+	}
+	entries := []entry{
+		{Name: "Mochi \"Matcha\"", Tags: []string{"sweet"}, Price: 350},
+		{Name: "Crepe", Tags: []string{}, Price: 500},
+	}
+
+	var buf bytes.Buffer
+	s := newJSONStreamWriter(&buf)
+	s.beginObject()
+	s.field("version", 1)
+	s.beginArrayField("entries")
+	for _, e := range entries {
+		s.element(e)
+	}
+	s.endArray()
+	s.beginArrayField("empty")
+	s.endArray()
+	s.field("meta", map[string]any{"count": len(entries)})
+	s.endObject()
+	if err := s.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !json.Valid(buf.Bytes()) {
+		t.Fatalf("invalid JSON document:\n%s", buf.String())
+	}
+	expected, err := json.MarshalIndent(struct {
+		Version int            `json:"version"`
+		Entries []entry        `json:"entries"`
+		Empty   []entry        `json:"empty"`
+		Meta    map[string]any `json:"meta"`
+	}{1, entries, []entry{}, map[string]any{"count": len(entries)}}, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != string(expected) {
+		t.Errorf("expected the json.MarshalIndent output\n%s\ngot\n%s", expected, buf.String())
+	}
+}
+
+func TestJSONStreamWriterKeepsFirstError(t *testing.T) {
+	s := newJSONStreamWriter(failingWriter{})
+	s.beginObject()
+	s.field("invalid", func() {})
+	s.field("version", 1)
+	s.endObject()
+
+	var unsupported *json.UnsupportedTypeError
+	if !errors.As(s.Err(), &unsupported) {
+		t.Fatalf("expected the marshal error, got %v", s.Err())
+	}
+	if err := s.flush(); !errors.As(err, &unsupported) {
+		t.Errorf("expected flush to return the first error, got %v", err)
+	}
+}
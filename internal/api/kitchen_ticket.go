@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/hooks"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// ReprintKitchenTicketsRequest is the body of ReprintKitchenTicketsHandler.
+type ReprintKitchenTicketsRequest struct {
+	// Station limits the reprint to the ticket of the station, all stations with a printer get one by default.
+	Station string `json:"station"`
+}
+
+// ReprintKitchenTicketsHandler returns an Echo handler function printing the kitchen tickets of all order items
+// of the order with the path parameter 'id' again, e.g. after a printer ran out of paper.
+// It responds with the queued print jobs, they are printed by the print spooler.
+func ReprintKitchenTicketsHandler(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		orderRecord, err := app.FindRecordById(model.OrderCollection, e.Request.PathValue("id"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, echo.Map{"error": "Order not found"})
+		}
+
+		var body ReprintKitchenTicketsRequest
+		if err := e.BindBody(&body); err != nil {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid body"})
+		}
+		if body.Station != "" {
+			if _, err := app.FindRecordById(model.StationCollection, body.Station); err != nil {
+				return e.JSON(http.StatusNotFound, echo.Map{"error": "Station not found"})
+			}
+		}
+
+		orderItemRecords, err := app.FindRecordsByFilter(
+			model.OrderItemCollection,
+			"order = {:order}",
+			"created,id",
+			0,
+			0,
+			dbx.Params{"order": orderRecord.Id},
+		)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		orderItems := make([]model.OrderItem, len(orderItemRecords))
+		for i, record := range orderItemRecords {
+			orderItems[i] = model.OrderItemFromRecord(record)
+		}
+
+		jobs, err := hooks.QueueKitchenTicketReprint(app, orderItems, body.Station)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		if len(jobs) == 0 {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": "No station with a printer prepares the order items"})
+		}
+		return e.JSON(http.StatusOK, jobs)
+	}
+}
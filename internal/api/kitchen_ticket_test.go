@@ -0,0 +1,127 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+func TestReprintKitchenTickets(t *testing.T) {
+	app := newTestApp(t)
+	user, err := app.FindRecordById(model.UserCollection, "1p1725ql8j7u632")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := user.NewAuthToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{"Authorization": token}
+
+	// only the crepes station has a printer, the route is registered like routes.RegisterAPIRoutes
+	roleAppFactory := func(role string) func(t testing.TB) *tests.TestApp {
+		return func(t testing.TB) *tests.TestApp {
+			app, err := tests.NewTestApp(testDataDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setUserRole(t, app, "1p1725ql8j7u632", role)
+			station, err := app.FindRecordById(model.StationCollection, "7kbm0uq66x72736")
+			if err != nil {
+				t.Fatal(err)
+			}
+			station.Set("printer", "192.0.2.1")
+			if err := app.Save(station); err != nil {
+				t.Fatal(err)
+			}
+			app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+				e.Router.POST("/api/orders/{id}/reprint", ReprintKitchenTicketsHandler(e.App)).Bind(apis.RequireAuth(), RequireCapability(model.CapTakeOrders))
+				return e.Next()
+			})
+			return app
+		}
+	}
+	appFactory := roleAppFactory(model.RoleKellner)
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:           "reprint all tickets of the order",
+			Method:         http.MethodPost,
+			URL:            "/api/orders/hvfhh05zbr323h5/reprint",
+			Headers:        headers,
+			ExpectedStatus: 200,
+			ExpectedContent: []string{
+				`"station":"7kbm0uq66x72736"`,
+				`"order_items":["virgkh8idg27vfo","rt0a00ca3sha5b8"]`,
+				`"reprint":true`,
+				`"status":"pending"`,
+			},
+			NotExpectedContent: []string{"w8qc24zj57849cj"},
+			TestAppFactory:     appFactory,
+		},
+		{
+			Name:            "reprint the ticket of a station without a printer",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/hvfhh05zbr323h5/reprint",
+			Body:            strings.NewReader(`{"station":"w8qc24zj57849cj"}`),
+			Headers:         headers,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{"No station with a printer"},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "reprint the ticket of an unknown station",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/hvfhh05zbr323h5/reprint",
+			Body:            strings.NewReader(`{"station":"unknown"}`),
+			Headers:         headers,
+			ExpectedStatus:  404,
+			ExpectedContent: []string{"Station not found"},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "reprint the tickets of an unknown order",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/unknown/reprint",
+			Headers:         headers,
+			ExpectedStatus:  404,
+			ExpectedContent: []string{"Order not found"},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "reprint by the kitchen",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/hvfhh05zbr323h5/reprint",
+			Headers:         headers,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{"The 'take_orders' permission is required"},
+			TestAppFactory:  roleAppFactory(model.RoleKueche),
+		},
+		{
+			Name:            "reprint by a user without a role",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/hvfhh05zbr323h5/reprint",
+			Headers:         headers,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{"The 'take_orders' permission is required"},
+			TestAppFactory:  roleAppFactory(""),
+		},
+		{
+			Name:            "reprint without a token",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/hvfhh05zbr323h5/reprint",
+			ExpectedStatus:  401,
+			ExpectedContent: []string{`"data":{}`},
+			TestAppFactory:  appFactory,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
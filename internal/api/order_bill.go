@@ -0,0 +1,93 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/hooks"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// BillPreview is what a payment of some order items would cost, calculated like the payment hooks do.
+type BillPreview struct {
+	OrderId string          `json:"order_id"`
+	Items   []SplitBillItem `json:"items"`
+	hooks.PaymentBreakdown
+	TipAmount float64 `json:"tip_amount"`
+	// Charge is the amount to charge, the total plus the tip.
+	Charge float64 `json:"charge"`
+}
+
+// OrderBillHandler returns an Echo handler function previewing the payment of the order with the path parameter 'id'.
+// The optional query parameters are 'order_items' (comma separated ids, all unpaid order items by default),
+// 'discount_percent' and 'tip_amount'.
+func OrderBillHandler(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		query := e.Request.URL.Query()
+		discountPercent, err := parseAmount(query.Get("discount_percent"))
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid 'discount_percent'"})
+		}
+		tipAmount, err := parseAmount(query.Get("tip_amount"))
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid 'tip_amount'"})
+		}
+		if err := hooks.ValidatePaymentAmounts(discountPercent, tipAmount); err != nil {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+
+		orderRecord, err := app.FindRecordById(model.OrderCollection, e.Request.PathValue("id"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, echo.Map{"error": "Order not found"})
+		}
+		bill, err := fetchSplitBill(app, model.OrderFromRecord(orderRecord), splitByItem)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+
+		var items []SplitBillItem
+		if orderItems := query.Get("order_items"); orderItems != "" {
+			var status int
+			items, status, err = unpaidSplitBillItems(bill, strings.Split(orderItems, ","))
+			if err != nil {
+				return e.JSON(status, echo.Map{"error": err.Error()})
+			}
+		} else {
+			items = []SplitBillItem{}
+			for _, item := range bill.Items {
+				if item.PaymentId == "" {
+					items = append(items, item)
+				}
+			}
+		}
+
+		return e.JSON(http.StatusOK, newBillPreview(bill.OrderId, items, discountPercent, tipAmount))
+	}
+}
+
+func newBillPreview(orderId string, items []SplitBillItem, discountPercent, tipAmount float64) BillPreview {
+	prices := make([]float64, len(items))
+	for i, item := range items {
+		prices[i] = item.Price
+	}
+	breakdown := hooks.NewPaymentBreakdown(prices, discountPercent)
+
+	return BillPreview{
+		OrderId:          orderId,
+		Items:            items,
+		PaymentBreakdown: breakdown,
+		TipAmount:        tipAmount,
+		Charge:           breakdown.Total + tipAmount,
+	}
+}
+
+// parseAmount parses an optional amount query parameter, missing amounts are 0.
+func parseAmount(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
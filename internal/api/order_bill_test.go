@@ -0,0 +1,102 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+func TestOrderBill(t *testing.T) {
+	app := newTestApp(t)
+	user, err := app.FindRecordById(model.UserCollection, "1p1725ql8j7u632")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := user.NewAuthToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{"Authorization": token}
+
+	// roleAppFactory gives the user of the token the role and registers the route like routes.RegisterAPIRoutes
+	roleAppFactory := func(role string) func(t testing.TB) *tests.TestApp {
+		return func(t testing.TB) *tests.TestApp {
+			app, err := tests.NewTestApp(testDataDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setUserRole(t, app, "1p1725ql8j7u632", role)
+			app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+				e.Router.GET("/api/orders/{id}/bill", OrderBillHandler(e.App)).Bind(apis.RequireAuth(), RequireCapability(model.CapViewOrders))
+				return e.Next()
+			})
+			return app
+		}
+	}
+	appFactory := roleAppFactory(model.RoleKellner)
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:            "all unpaid order items",
+			Method:          http.MethodGet,
+			URL:             "/api/orders/" + testDeliveredOrder + "/bill",
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"subtotal":942`, `"discount":0`, `"total":942`, `"charge":942`},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "some order items with discount and tip",
+			Method:          http.MethodGet,
+			URL:             "/api/orders/" + testDeliveredOrder + "/bill?order_items=e5cxx50q2ln939x,virgkh8idg27vfo&discount_percent=10&tip_amount=21",
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"subtotal":421`, `"discount_percent":10`, `"discount":42`, `"total":379`, `"tip_amount":21`, `"charge":400`},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "paid order items",
+			Method:          http.MethodGet,
+			URL:             "/api/orders/b69u9kp1t9d71z5/bill?order_items=wogjt47xn7ru29d",
+			Headers:         headers,
+			ExpectedStatus:  409,
+			ExpectedContent: []string{"already paid"},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "full discount",
+			Method:          http.MethodGet,
+			URL:             "/api/orders/" + testDeliveredOrder + "/bill?discount_percent=100",
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"subtotal":942`, `"discount":942`, `"total":0`, `"charge":0`},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "bill for a user without a role",
+			Method:          http.MethodGet,
+			URL:             "/api/orders/" + testDeliveredOrder + "/bill",
+			Headers:         headers,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{"The 'view_orders' permission is required"},
+			TestAppFactory:  roleAppFactory(""),
+		},
+		{
+			Name:            "invalid discount",
+			Method:          http.MethodGet,
+			URL:             "/api/orders/" + testDeliveredOrder + "/bill?discount_percent=110",
+			Headers:         headers,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{"discount_percent"},
+			TestAppFactory:  appFactory,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
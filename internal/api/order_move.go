@@ -0,0 +1,98 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/hooks"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// TransferOrderRequest is the body of TransferOrderHandler.
+type TransferOrderRequest struct {
+	// Table is the number of the table the order is moved to.
+	Table float64 `json:"table"`
+}
+
+// MergeOrderRequest is the body of MergeOrderHandler.
+type MergeOrderRequest struct {
+	// Order is the order merged into the one of the path, it is deleted afterwards.
+	Order string `json:"order"`
+}
+
+// SplitOffOrderRequest is the body of SplitOffOrderHandler.
+type SplitOffOrderRequest struct {
+	OrderItems []string `json:"order_items"`
+	// Table is the number of the table of the new order, the table of the order if not set.
+	Table float64 `json:"table"`
+	// Person is the number of guests of the new order, 1 if not set.
+	Person int `json:"person"`
+}
+
+// TransferOrderHandler returns an Echo handler function moving the order with the path parameter 'id'
+// to another table. It responds with the updated order.
+func TransferOrderHandler(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		var body TransferOrderRequest
+		if err := e.BindBody(&body); err != nil || body.Table <= 0 {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": "Missing 'table'"})
+		}
+
+		orderRecord, err := app.FindRecordById(model.OrderCollection, e.Request.PathValue("id"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, echo.Map{"error": "Order not found"})
+		}
+
+		order, err := hooks.TransferOrder(app, e.Request.Context(), orderRecord.Id, body.Table)
+		if err != nil {
+			return saveErrorJSON(e, err)
+		}
+		return e.JSON(http.StatusOK, order)
+	}
+}
+
+// MergeOrderHandler returns an Echo handler function merging another order into the order with the path
+// parameter 'id', e.g. when two parties join. It responds with the updated order.
+func MergeOrderHandler(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		var body MergeOrderRequest
+		if err := e.BindBody(&body); err != nil || body.Order == "" {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": "Missing 'order'"})
+		}
+
+		orderRecord, err := app.FindRecordById(model.OrderCollection, e.Request.PathValue("id"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, echo.Map{"error": "Order not found"})
+		}
+
+		order, err := hooks.MergeOrders(app, e.Request.Context(), orderRecord.Id, body.Order)
+		if err != nil {
+			return saveErrorJSON(e, err)
+		}
+		return e.JSON(http.StatusOK, order)
+	}
+}
+
+// SplitOffOrderHandler returns an Echo handler function moving some of the order items of the order with
+// the path parameter 'id' into a new order, e.g. when some guests move to another table.
+// It responds with the new order.
+func SplitOffOrderHandler(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		var body SplitOffOrderRequest
+		if err := e.BindBody(&body); err != nil || len(body.OrderItems) == 0 {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": "Missing 'order_items'"})
+		}
+
+		orderRecord, err := app.FindRecordById(model.OrderCollection, e.Request.PathValue("id"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, echo.Map{"error": "Order not found"})
+		}
+
+		order, err := hooks.SplitOrder(app, e.Request.Context(), orderRecord.Id, body.OrderItems, body.Table, body.Person)
+		if err != nil {
+			return saveErrorJSON(e, err)
+		}
+		return e.JSON(http.StatusCreated, order)
+	}
+}
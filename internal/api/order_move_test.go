@@ -0,0 +1,149 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/supotsu-no-ochaya/backend/internal/hooks"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+func TestMoveOrders(t *testing.T) {
+	app := newTestApp(t)
+	user, err := app.FindRecordById(model.UserCollection, "1p1725ql8j7u632")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := user.NewAuthToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{"Authorization": token}
+
+	appFactory := func(t testing.TB) *tests.TestApp {
+		app, err := tests.NewTestApp(testDataDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hooks.RegisterOrderHooks(app)
+		hooks.RegisterTableHooks(app)
+		hooks.RegisterOrderItemHooks(app)
+		// a free table
+		tables, err := app.FindCollectionByNameOrId(model.TableCollection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		table := core.NewRecord(tables)
+		table.Set("number", 20)
+		if err := app.Save(table); err != nil {
+			t.Fatal(err)
+		}
+		app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+			e.Router.POST("/api/orders/{id}/transfer", TransferOrderHandler(e.App))
+			e.Router.POST("/api/orders/{id}/merge", MergeOrderHandler(e.App))
+			e.Router.POST("/api/orders/{id}/split-off", SplitOffOrderHandler(e.App))
+			return e.Next()
+		})
+		return app
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:            "transfer an order to another table",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/7c9314h8rh8469g/transfer",
+			Body:            strings.NewReader(`{"table": 20}`),
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"table":20`, `"dining_table":"`},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "transfer an order to a table of another waiter",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/7c9314h8rh8469g/transfer",
+			Body:            strings.NewReader(`{"table": 1}`),
+			Headers:         headers,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{"The table has unpaid orders of another waiter"},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "transfer an order to an unknown table",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/7c9314h8rh8469g/transfer",
+			Body:            strings.NewReader(`{"table": 99}`),
+			Headers:         headers,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{"Table 99 does not exist"},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "transfer an unknown order",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/unknown/transfer",
+			Body:            strings.NewReader(`{"table": 1}`),
+			Headers:         headers,
+			ExpectedStatus:  404,
+			ExpectedContent: []string{"Order not found"},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "merge two orders",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/hvfhh05zbr323h5/merge",
+			Body:            strings.NewReader(`{"order": "7c9314h8rh8469g"}`),
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"id":"hvfhh05zbr323h5"`, `"status":"Aufgegeben"`},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "merge without an order",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/hvfhh05zbr323h5/merge",
+			Body:            strings.NewReader(`{}`),
+			Headers:         headers,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{"Missing 'order'"},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "split off order items",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/hvfhh05zbr323h5/split-off",
+			Body:            strings.NewReader(`{"order_items": ["virgkh8idg27vfo"], "table": 20}`),
+			Headers:         headers,
+			ExpectedStatus:  201,
+			ExpectedContent: []string{`"table":20`, `"person":1`, `"status":"Geliefert"`},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "split off order items to a table of another waiter",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/hvfhh05zbr323h5/split-off",
+			Body:            strings.NewReader(`{"order_items": ["virgkh8idg27vfo"], "table": 13}`),
+			Headers:         headers,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{"The table has unpaid orders of another waiter"},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "split off order items of another order",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/hvfhh05zbr323h5/split-off",
+			Body:            strings.NewReader(`{"order_items": ["44tv6363beu9q34"]}`),
+			Headers:         headers,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{"The order items have to be part of the order"},
+			TestAppFactory:  appFactory,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
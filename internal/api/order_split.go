@@ -0,0 +1,300 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/hooks"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+const (
+	// splitByPerson distributes the unpaid order items evenly over the guests which have not paid yet.
+	splitByPerson = "person"
+	// splitByItem proposes a separate payment for every unpaid order item.
+	splitByItem = "item"
+)
+
+// SplitBill is the payment state of an order with proposals for paying the remaining order items.
+// Amounts are in the unit of the order item prices (cents).
+type SplitBill struct {
+	OrderId   string  `json:"order_id"`
+	Persons   int     `json:"persons"`
+	Total     float64 `json:"total"`
+	Paid      float64 `json:"paid"`
+	Remaining float64 `json:"remaining"`
+	// Complete is true once every order item is covered by a payment.
+	Complete  bool            `json:"complete"`
+	Items     []SplitBillItem `json:"items"`
+	Proposals []SplitProposal `json:"proposals"`
+}
+
+// SplitBillItem is an order item of a SplitBill.
+type SplitBillItem struct {
+	OrderItemId  string  `json:"order_item_id"`
+	MenuItemName string  `json:"menu_item_name"`
+	Price        float64 `json:"price"`
+	// PaymentId is the payment covering the order item, empty while it is unpaid.
+	PaymentId string `json:"payment_id"`
+}
+
+// SplitProposal is a proposed payment of some of the unpaid order items.
+type SplitProposal struct {
+	// Person is the guest the payment is proposed for, 0 when splitting by item.
+	Person     int      `json:"person"`
+	OrderItems []string `json:"order_items"`
+	Amount     float64  `json:"amount"`
+}
+
+// SplitPaymentRequest is the body of OrderSplitPaymentHandler.
+type SplitPaymentRequest struct {
+	OrderItems      []string `json:"order_items"`
+	Person          int      `json:"person"`
+	PaymentOption   string   `json:"payment_option"`
+	TipAmount       float64  `json:"tip_amount"`
+	DiscountPercent float64  `json:"discount_percent"`
+}
+
+// SplitPaymentResponse is the created payment together with the updated bill of the order.
+type SplitPaymentResponse struct {
+	Payment model.Payment `json:"payment"`
+	Bill    SplitBill     `json:"bill"`
+}
+
+// OrderSplitHandler returns an Echo handler function returning the SplitBill of the order with the path parameter 'id'.
+// The query parameter 'by' selects the proposals, "person" (default) or "item".
+func OrderSplitHandler(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		by := e.Request.URL.Query().Get("by")
+		if by == "" {
+			by = splitByPerson
+		}
+		if by != splitByPerson && by != splitByItem {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid 'by', expected 'person' or 'item'"})
+		}
+
+		orderRecord, err := app.FindRecordById(model.OrderCollection, e.Request.PathValue("id"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, echo.Map{"error": "Order not found"})
+		}
+
+		bill, err := fetchSplitBill(app, model.OrderFromRecord(orderRecord), by)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		return e.JSON(http.StatusOK, bill)
+	}
+}
+
+// OrderSplitPaymentHandler returns an Echo handler function creating a payment for some of the unpaid order items
+// of the order with the path parameter 'id'. The payment hooks calculate the total amount of the payment.
+// The payment hooks move the order items, and once every order item is paid the order, to "Bezahlt".
+func OrderSplitPaymentHandler(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		orderRecord, err := app.FindRecordById(model.OrderCollection, e.Request.PathValue("id"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, echo.Map{"error": "Order not found"})
+		}
+		order := model.OrderFromRecord(orderRecord)
+
+		var body SplitPaymentRequest
+		if err := e.BindBody(&body); err != nil {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid body: " + err.Error()})
+		}
+		if len(body.OrderItems) == 0 {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": "Missing 'order_items'"})
+		}
+
+		bill, err := fetchSplitBill(app, order, splitByItem)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		if _, status, err := unpaidSplitBillItems(bill, body.OrderItems); err != nil {
+			return e.JSON(status, echo.Map{"error": err.Error()})
+		}
+
+		collection, err := app.FindCollectionByNameOrId(model.PaymentCollection)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		paymentRecord := core.NewRecord(collection)
+		paymentRecord.Set("order_items", body.OrderItems)
+		paymentRecord.Set("tip_amount", body.TipAmount)
+		paymentRecord.Set("discount_percent", body.DiscountPercent)
+		paymentRecord.Set("person", body.Person)
+		paymentRecord.Set("payment_option", body.PaymentOption)
+
+		// the payment hooks check again for payments created in the meantime
+		err = app.RunInTransaction(func(txApp core.App) error {
+			return txApp.Save(paymentRecord)
+		})
+		if err != nil {
+			return saveErrorJSON(e, err)
+		}
+
+		bill, err = fetchSplitBill(app, order, splitByPerson)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		return e.JSON(http.StatusOK, SplitPaymentResponse{
+			Payment: model.PaymentFromRecord(paymentRecord),
+			Bill:    bill,
+		})
+	}
+}
+
+// unpaidSplitBillItems returns the items of the bill with the ids, failing with the http status
+// for ids of order items which are paid already or are not part of the order.
+func unpaidSplitBillItems(bill SplitBill, orderItemIds []string) ([]SplitBillItem, int, error) {
+	items := make([]SplitBillItem, 0, len(orderItemIds))
+	for _, orderItemId := range orderItemIds {
+		i := slices.IndexFunc(bill.Items, func(item SplitBillItem) bool { return item.OrderItemId == orderItemId })
+		if i < 0 {
+			return nil, http.StatusBadRequest, fmt.Errorf("Order item %s is not part of the order", orderItemId)
+		}
+		if bill.Items[i].PaymentId != "" {
+			return nil, http.StatusConflict, fmt.Errorf("Order item %s is already paid", orderItemId)
+		}
+		items = append(items, bill.Items[i])
+	}
+	return items, http.StatusOK, nil
+}
+
+// fetchSplitBill collects the order items of the order with the payments covering them
+// and proposes payments for the unpaid ones.
+func fetchSplitBill(app core.App, order model.Order, by string) (SplitBill, error) {
+	bill := SplitBill{
+		OrderId:   order.Id,
+		Persons:   max(order.Person, 1),
+		Items:     []SplitBillItem{},
+		Proposals: []SplitProposal{},
+	}
+
+	orderItemRecords := []*core.Record{}
+	err := app.RecordQuery(model.OrderItemCollection).
+		AndWhere(dbx.HashExp{"order": order.Id}).
+		OrderBy("created ASC", "id ASC").
+		All(&orderItemRecords)
+	if err != nil {
+		return bill, err
+	}
+
+	orderItems := make([]model.OrderItem, len(orderItemRecords))
+	orderItemIds := make([]string, len(orderItemRecords))
+	loader := newRelationLoader(app)
+	for i, record := range orderItemRecords {
+		orderItems[i] = model.OrderItemFromRecord(record)
+		orderItemIds[i] = orderItems[i].Id
+		loader.add(model.MenuItemCollection, orderItems[i].MenuItem)
+	}
+	if err := loader.load(); err != nil {
+		return bill, err
+	}
+	payments, err := hooks.OrderItemPayments(app, orderItemIds)
+	if err != nil {
+		return bill, err
+	}
+
+	var unpaid []SplitBillItem
+	paymentIds := []string{}
+	for _, orderItem := range orderItems {
+		item := SplitBillItem{
+			OrderItemId: orderItem.Id,
+			Price:       orderItem.Price,
+			PaymentId:   payments[orderItem.Id],
+		}
+		if menuItemRecord, ok := loader.get(model.MenuItemCollection, orderItem.MenuItem); ok {
+			item.MenuItemName = model.MenuItemFromRecord(menuItemRecord).Name
+		}
+
+		bill.Total += item.Price
+		if item.PaymentId == "" {
+			bill.Remaining += item.Price
+			unpaid = append(unpaid, item)
+		} else {
+			bill.Paid += item.Price
+			if !slices.Contains(paymentIds, item.PaymentId) {
+				paymentIds = append(paymentIds, item.PaymentId)
+			}
+		}
+		bill.Items = append(bill.Items, item)
+	}
+	bill.Complete = len(unpaid) == 0
+
+	if by == splitByItem {
+		for _, item := range unpaid {
+			bill.Proposals = append(bill.Proposals, SplitProposal{
+				OrderItems: []string{item.OrderItemId},
+				Amount:     item.Price,
+			})
+		}
+		return bill, nil
+	}
+
+	// guests which already paid are left out
+	paidPersons := []int{}
+	for _, paymentId := range paymentIds {
+		paymentRecord, err := app.FindRecordById(model.PaymentCollection, paymentId)
+		if err != nil {
+			return bill, err
+		}
+		if person := model.PaymentFromRecord(paymentRecord).Person; person > 0 {
+			paidPersons = append(paidPersons, person)
+		}
+	}
+	bill.Proposals = splitByPersons(unpaid, openPersons(bill.Persons, paidPersons))
+	return bill, nil
+}
+
+// openPersons returns the guests 1 to persons which have not paid yet, or a single new guest if all of them have.
+func openPersons(persons int, paidPersons []int) []int {
+	open := []int{}
+	for person := 1; person <= persons; person++ {
+		if !slices.Contains(paidPersons, person) {
+			open = append(open, person)
+		}
+	}
+	if len(open) == 0 {
+		open = append(open, persons+1)
+	}
+	return open
+}
+
+// splitByPersons distributes the order items over the persons so the amounts are as even as possible:
+// the most expensive order items first, each to the person with the lowest amount so far.
+// Persons without an order item get no proposal.
+func splitByPersons(items []SplitBillItem, persons []int) []SplitProposal {
+	proposals := make([]SplitProposal, len(persons))
+	for i, person := range persons {
+		proposals[i] = SplitProposal{Person: person, OrderItems: []string{}}
+	}
+
+	sorted := slices.Clone(items)
+	slices.SortStableFunc(sorted, func(a, b SplitBillItem) int {
+		switch {
+		case a.Price > b.Price:
+			return -1
+		case a.Price < b.Price:
+			return 1
+		}
+		return 0
+	})
+	for _, item := range sorted {
+		lowest := 0
+		for i := range proposals {
+			if proposals[i].Amount < proposals[lowest].Amount {
+				lowest = i
+			}
+		}
+		proposals[lowest].OrderItems = append(proposals[lowest].OrderItems, item.OrderItemId)
+		proposals[lowest].Amount += item.Price
+	}
+
+	return slices.DeleteFunc(proposals, func(proposal SplitProposal) bool {
+		return len(proposal.OrderItems) == 0
+	})
+}
@@ -0,0 +1,253 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/supotsu-no-ochaya/backend/internal/hooks"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// the delivered order hvfhh05zbr323h5 has 3 order items for 100 and 2 for 321, none of them is paid
+const testDeliveredOrder = "hvfhh05zbr323h5"
+
+func fetchTestSplitBill(tb testing.TB, app core.App, orderId, by string) SplitBill {
+	tb.Helper()
+	orderRecord, err := app.FindRecordById(model.OrderCollection, orderId)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	bill, err := fetchSplitBill(app, model.OrderFromRecord(orderRecord), by)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return bill
+}
+
+func TestFetchSplitBill(t *testing.T) {
+	app := newTestApp(t)
+	hooks.RegisterOrderHooks(app)
+	hooks.RegisterOrderItemHooks(app)
+	hooks.RegisterPaymentHooks(app)
+
+	order, err := app.FindRecordById(model.OrderCollection, testDeliveredOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order.Set("person", 2)
+	if err := app.Save(order); err != nil {
+		t.Fatal(err)
+	}
+
+	bill := fetchTestSplitBill(t, app, testDeliveredOrder, splitByItem)
+	if bill.Total != 942 || bill.Remaining != 942 || bill.Paid != 0 || bill.Complete {
+		t.Fatalf("unexpected totals of %+v", bill)
+	}
+	if len(bill.Proposals) != 5 {
+		t.Fatalf("expected a proposal per order item, got %+v", bill.Proposals)
+	}
+
+	// the expensive order items are split first, then the cheap ones go to the person with the lower amount
+	bill = fetchTestSplitBill(t, app, testDeliveredOrder, splitByPerson)
+	amounts := []float64{}
+	for _, proposal := range bill.Proposals {
+		amounts = append(amounts, proposal.Amount)
+	}
+	if !slices.Equal(amounts, []float64{521, 421}) {
+		t.Fatalf("expected amounts [521 421], got %+v", bill.Proposals)
+	}
+
+	// once the first person paid, the rest is proposed to the second one
+	collection, err := app.FindCollectionByNameOrId(model.PaymentCollection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payment := core.NewRecord(collection)
+	payment.Set("order_items", bill.Proposals[0].OrderItems)
+	payment.Set("total_amount", bill.Proposals[0].Amount)
+	payment.Set("person", bill.Proposals[0].Person)
+	if err := app.Save(payment); err != nil {
+		t.Fatal(err)
+	}
+
+	bill = fetchTestSplitBill(t, app, testDeliveredOrder, splitByPerson)
+	if bill.Paid != 521 || bill.Remaining != 421 || bill.Complete {
+		t.Fatalf("unexpected totals of %+v", bill)
+	}
+	if len(bill.Proposals) != 1 || bill.Proposals[0].Person != 2 || bill.Proposals[0].Amount != 421 {
+		t.Fatalf("expected a single proposal for person 2, got %+v", bill.Proposals)
+	}
+}
+
+func TestOrderSplitPayment(t *testing.T) {
+	app := newTestApp(t)
+	user, err := app.FindRecordById(model.UserCollection, "1p1725ql8j7u632")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := user.NewAuthToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{"Authorization": token}
+
+	// roleAppFactory gives the user of the token the role and registers the routes like routes.RegisterAPIRoutes
+	roleAppFactory := func(role string) func(t testing.TB) *tests.TestApp {
+		return func(t testing.TB) *tests.TestApp {
+			app, err := tests.NewTestApp(testDataDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setUserRole(t, app, "1p1725ql8j7u632", role)
+			hooks.RegisterOrderHooks(app)
+			hooks.RegisterOrderItemHooks(app)
+			hooks.RegisterPaymentHooks(app)
+			app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+				e.Router.GET("/api/orders/{id}/split", OrderSplitHandler(e.App)).Bind(apis.RequireAuth(), RequireCapability(model.CapViewOrders))
+				e.Router.POST("/api/orders/{id}/split", OrderSplitPaymentHandler(e.App)).Bind(apis.RequireAuth(), RequireCapability(model.CapTakePayments))
+				return e.Next()
+			})
+			return app
+		}
+	}
+	appFactory := roleAppFactory(model.RoleKellner)
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:            "bill of an unknown order",
+			Method:          http.MethodGet,
+			URL:             "/api/orders/unknown/split",
+			Headers:         headers,
+			ExpectedStatus:  404,
+			ExpectedContent: []string{"Order not found"},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "proposals by item",
+			Method:          http.MethodGet,
+			URL:             "/api/orders/" + testDeliveredOrder + "/split?by=item",
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"remaining":942`, `"complete":false`, `"order_items":["rt0a00ca3sha5b8"]`},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "paying some order items",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/" + testDeliveredOrder + "/split",
+			Body:            strings.NewReader(`{"order_items":["virgkh8idg27vfo","e5cxx50q2ln939x"],"person":1,"payment_option":"2dbpn606978dru1","discount_percent":10}`),
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"subtotal_amount":421`, `"discount_amount":42`, `"total_amount":379`, `"paid":421`, `"remaining":521`, `"complete":false`},
+			TestAppFactory:  appFactory,
+			AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
+				order, err := app.FindRecordById(model.OrderCollection, testDeliveredOrder)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if status := order.GetString("status"); status != "Geliefert" {
+					t.Errorf("expected the partly paid order to stay Geliefert, got %s", status)
+				}
+			},
+		},
+		{
+			Name:            "paying all order items",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/" + testDeliveredOrder + "/split",
+			Body:            strings.NewReader(`{"order_items":["e5cxx50q2ln939x","b4hxl8160i3x5px","e919384j8tp20cl","virgkh8idg27vfo","rt0a00ca3sha5b8"]}`),
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"total_amount":942`, `"remaining":0`, `"complete":true`},
+			TestAppFactory:  appFactory,
+			AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
+				order, err := app.FindRecordById(model.OrderCollection, testDeliveredOrder)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if status := order.GetString("status"); status != "Bezahlt" {
+					t.Errorf("expected the paid order to be Bezahlt, got %s", status)
+				}
+			},
+		},
+		{
+			Name:            "paying with a full discount",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/" + testDeliveredOrder + "/split",
+			Body:            strings.NewReader(`{"order_items":["virgkh8idg27vfo"],"discount_percent":100}`),
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"subtotal_amount":321`, `"discount_amount":321`, `"total_amount":0`, `"paid":321`},
+			TestAppFactory:  appFactory,
+		},
+		{
+			// amounts are in cents, so the payment rejects a fractional tip instead of the body
+			Name:            "paying with a fractional tip",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/" + testDeliveredOrder + "/split",
+			Body:            strings.NewReader(`{"order_items":["virgkh8idg27vfo"],"tip_amount":2.5}`),
+			Headers:         headers,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{"tip_amount: Decimal numbers are not allowed"},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:               "paying with an invalid body",
+			Method:             http.MethodPost,
+			URL:                "/api/orders/" + testDeliveredOrder + "/split",
+			Body:               strings.NewReader(`{"order_items":["virgkh8idg27vfo"],"tip_amount":"much"}`),
+			Headers:            headers,
+			ExpectedStatus:     400,
+			ExpectedContent:    []string{"Invalid body"},
+			NotExpectedContent: []string{"Missing 'order_items'"},
+			TestAppFactory:     appFactory,
+		},
+		{
+			Name:            "paying as the kitchen",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/" + testDeliveredOrder + "/split",
+			Body:            strings.NewReader(`{"order_items":["virgkh8idg27vfo"]}`),
+			Headers:         headers,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{"The 'take_payments' permission is required"},
+			TestAppFactory:  roleAppFactory(model.RoleKueche),
+		},
+		{
+			Name:            "bill of the kitchen",
+			Method:          http.MethodGet,
+			URL:             "/api/orders/" + testDeliveredOrder + "/split",
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"order_id":"hvfhh05zbr323h5"`},
+			TestAppFactory:  roleAppFactory(model.RoleKueche),
+		},
+		{
+			Name:            "paying an order item twice",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/b69u9kp1t9d71z5/split",
+			Body:            strings.NewReader(`{"order_items":["wogjt47xn7ru29d"]}`),
+			Headers:         headers,
+			ExpectedStatus:  409,
+			ExpectedContent: []string{"already paid"},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "paying an order item of another order",
+			Method:          http.MethodPost,
+			URL:             "/api/orders/" + testDeliveredOrder + "/split",
+			Body:            strings.NewReader(`{"order_items":["44tv6363beu9q34"]}`),
+			Headers:         headers,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{"not part of the order"},
+			TestAppFactory:  appFactory,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
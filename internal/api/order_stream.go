@@ -0,0 +1,406 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/hooks"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+const (
+	// orderStreamPingInterval keeps idle connections open through proxies.
+	orderStreamPingInterval = 30 * time.Second
+
+	orderStreamEventOrder        = "order"
+	orderStreamEventOrderDeleted = "order_deleted"
+)
+
+// OrderView is the state of an order pushed by the order stream: the order with the name of its waiter
+// and its order items with their menu items, so clients don't have to reassemble it from the collections.
+type OrderView struct {
+	model.Order
+	WaiterName string          `json:"waiter_name"`
+	Items      []OrderViewItem `json:"items"`
+}
+
+// OrderViewItem is an order item of an OrderView.
+type OrderViewItem struct {
+	Id            string            `json:"id"`
+	MenuItemId    string            `json:"menu_item_id"`
+	MenuItemName  string            `json:"menu_item_name"`
+	Price         float64           `json:"price"`
+	Status        string            `json:"status"`
+	StationStatus map[string]string `json:"station_status"`
+	Notes         string            `json:"notes"`
+	Products      []QueueProduct    `json:"products"`
+}
+
+// orderStreamFilter limits what a client of the order stream sees.
+type orderStreamFilter struct {
+	// waiter limits the orders to the ones at the tables of the open orders of the waiter.
+	waiter string
+	// station limits the order items to the ones with products of the station.
+	station string
+}
+
+// orderChange is a created, updated or deleted order, or an order with a changed order item.
+type orderChange struct {
+	order   string
+	deleted bool
+}
+
+// orderStream passes the order changes from the hooks to the connected clients.
+type orderStream struct {
+	mu      sync.Mutex
+	clients map[*orderStreamClient]struct{}
+}
+
+// orderStreamClient collects the changes for a client until it gets to send them.
+// Several changes of the same order, e.g. by a status cascade, are sent once.
+type orderStreamClient struct {
+	mu      sync.Mutex
+	changes []orderChange
+	notify  chan struct{}
+}
+
+func newOrderStream() *orderStream {
+	return &orderStream{clients: map[*orderStreamClient]struct{}{}}
+}
+
+// bind publishes the changes of orders and order items once they are saved.
+func (s *orderStream) bind(app core.App) {
+	publishOrder := func(deleted bool) func(e *core.RecordEvent) error {
+		return func(e *core.RecordEvent) error {
+			s.publish(orderChange{order: e.Record.Id, deleted: deleted})
+			return e.Next()
+		}
+	}
+	publishOrderItem := func(e *core.RecordEvent) error {
+		s.publish(orderChange{order: e.Record.GetString("order")})
+		return e.Next()
+	}
+
+	app.OnRecordAfterCreateSuccess(model.OrderCollection).BindFunc(publishOrder(false))
+	app.OnRecordAfterUpdateSuccess(model.OrderCollection).BindFunc(publishOrder(false))
+	app.OnRecordAfterDeleteSuccess(model.OrderCollection).BindFunc(publishOrder(true))
+	app.OnRecordAfterCreateSuccess(model.OrderItemCollection).BindFunc(publishOrderItem)
+	app.OnRecordAfterUpdateSuccess(model.OrderItemCollection).BindFunc(publishOrderItem)
+	app.OnRecordAfterDeleteSuccess(model.OrderItemCollection).BindFunc(publishOrderItem)
+}
+
+func (s *orderStream) subscribe() *orderStreamClient {
+	client := &orderStreamClient{notify: make(chan struct{}, 1)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[client] = struct{}{}
+	return client
+}
+
+func (s *orderStream) unsubscribe(client *orderStreamClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.clients, client)
+}
+
+func (s *orderStream) publish(change orderChange) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for client := range s.clients {
+		client.add(change)
+	}
+}
+
+func (c *orderStreamClient) add(change orderChange) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	merged := false
+	for i, pending := range c.changes {
+		if pending.order != change.order {
+			continue
+		}
+		change.deleted = change.deleted || pending.deleted
+		c.changes[i] = change
+		merged = true
+		break
+	}
+	if !merged {
+		c.changes = append(c.changes, change)
+	}
+
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the pending changes in the order they happened.
+func (c *orderStreamClient) take() []orderChange {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	changes := c.changes
+	c.changes = nil
+	return changes
+}
+
+// OrderStreamHandler returns an Echo handler function streaming the open orders as server-sent events,
+// first all orders which are not paid yet and then every order again whenever it or one of its order items
+// changes. The events are "order" with an OrderView and "order_deleted" with the id of a deleted order.
+// What a client sees depends on its role:
+//   - Kellner get the orders at the tables of their open orders, including the ones of other waiters.
+//   - Kueche get the order items of the station of their user.
+//   - Kuechenchef and superusers get all orders, optionally limited to the station in the query parameter 'station'.
+//
+// The handler subscribes to the order and order item hooks of the app when it is created.
+func OrderStreamHandler(app core.App) func(e *core.RequestEvent) error {
+	stream := newOrderStream()
+	stream.bind(app)
+
+	return func(e *core.RequestEvent) error {
+		filter, status, err := orderStreamFilterFor(app, e)
+		if err != nil {
+			return e.JSON(status, echo.Map{"error": err.Error()})
+		}
+
+		// subscribe first to not miss changes while the open orders are sent
+		client := stream.subscribe()
+		defer stream.unsubscribe(client)
+
+		e.Response.Header().Set("Content-Type", "text/event-stream")
+		e.Response.Header().Set("Cache-Control", "no-store")
+		e.Response.Header().Set("X-Accel-Buffering", "no")
+		e.Response.WriteHeader(http.StatusOK)
+
+		// orders sent to the client, a station is told when an order has no order items for it anymore
+		sent := map[string]bool{}
+		openOrders := []*core.Record{}
+		query := app.RecordQuery(model.OrderCollection).
+			AndWhere(dbx.In("status", stringSliceToInterfaceSlice(hooks.UnpaidOrderStatuses())...)).
+			OrderBy("created ASC", "id ASC")
+		if filter.waiter != "" {
+			tables, err := waiterTables(app, filter.waiter)
+			if err != nil {
+				return err
+			}
+			query.AndWhere(dbx.In("table", tables...))
+		}
+		if err := query.All(&openOrders); err != nil {
+			return err
+		}
+		for _, orderRecord := range openOrders {
+			if err := sendOrderView(app, e, filter, orderRecord.Id, sent); err != nil {
+				return err
+			}
+		}
+		if err := e.Flush(); err != nil {
+			return err
+		}
+
+		ping := time.NewTicker(orderStreamPingInterval)
+		defer ping.Stop()
+		for {
+			select {
+			case <-e.Request.Context().Done():
+				return nil
+			case <-ping.C:
+				if _, err := fmt.Fprint(e.Response, ": ping\n\n"); err != nil {
+					return nil
+				}
+			case <-client.notify:
+				for _, change := range client.take() {
+					if err := sendOrderChange(app, e, filter, change, sent); err != nil {
+						return err
+					}
+				}
+			}
+			if err := e.Flush(); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// orderStreamFilterFor returns the filter for the role of the authenticated user, or an error with
+// the status to respond with for users who may not use the order stream.
+func orderStreamFilterFor(app core.App, e *core.RequestEvent) (orderStreamFilter, int, error) {
+	filter := orderStreamFilter{station: e.Request.URL.Query().Get("station")}
+	if filter.station != "" {
+		if _, err := app.FindRecordById(model.StationCollection, filter.station); err != nil {
+			return filter, http.StatusNotFound, errors.New("Station not found")
+		}
+	}
+
+	role, superuser, err := hooks.AuthRole(app, e.Auth)
+	if err != nil {
+		return filter, http.StatusInternalServerError, err
+	}
+	switch {
+	case superuser || role == model.RoleKuechenchef:
+	case role == model.RoleKellner:
+		filter.waiter = e.Auth.Id
+	case role == model.RoleKueche:
+		station := model.UserFromRecord(e.Auth).Station
+		if station == "" {
+			return filter, http.StatusForbidden, errors.New("No station is assigned to the user")
+		}
+		if filter.station != "" && filter.station != station {
+			return filter, http.StatusForbidden, errors.New("Kueche only get the order items of their own station")
+		}
+		filter.station = station
+	default:
+		return filter, http.StatusForbidden, errors.New("The order stream is only available to Kellner, Kueche and Kuechenchef")
+	}
+	return filter, http.StatusOK, nil
+}
+
+// sendOrderChange sends the changed order if the client may see it.
+func sendOrderChange(app core.App, e *core.RequestEvent, filter orderStreamFilter, change orderChange, sent map[string]bool) error {
+	if !change.deleted {
+		return sendOrderView(app, e, filter, change.order, sent)
+	}
+	if (filter.waiter != "" || filter.station != "") && !sent[change.order] {
+		return nil
+	}
+	delete(sent, change.order)
+	return writeServerSentEvent(e, orderStreamEventOrderDeleted, echo.Map{"id": change.order})
+}
+
+// sendOrderView sends the current state of the order if the client may see it.
+// Orders without order items of the station of the client, or no longer at a table of the waiter of the client,
+// are only sent when they were sent before.
+func sendOrderView(app core.App, e *core.RequestEvent, filter orderStreamFilter, orderId string, sent map[string]bool) error {
+	view, err := fetchOrderView(app, orderId, filter.station)
+	if err != nil {
+		return err
+	}
+	if view == nil {
+		return nil
+	}
+	if filter.waiter != "" && !sent[orderId] {
+		tables, err := waiterTables(app, filter.waiter)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(tables, any(view.Table)) {
+			return nil
+		}
+	}
+	if filter.station != "" && len(view.Items) == 0 && !sent[orderId] {
+		return nil
+	}
+	sent[orderId] = true
+	return writeServerSentEvent(e, orderStreamEventOrder, view)
+}
+
+// waiterTables returns the tables of the open orders of the waiter.
+// A waiter serves the tables they have open orders at, whoever placed the other orders there.
+func waiterTables(app core.App, waiter string) ([]any, error) {
+	tables := []float64{}
+	err := app.DB().
+		Select("table").
+		Distinct(true).
+		From(model.OrderCollection).
+		AndWhere(dbx.HashExp{"waiter": waiter}).
+		AndWhere(dbx.In("status", stringSliceToInterfaceSlice(hooks.UnpaidOrderStatuses())...)).
+		Column(&tables)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]any, len(tables))
+	for i, table := range tables {
+		result[i] = table
+	}
+	return result, nil
+}
+
+// fetchOrderView assembles the view of the order, nil is returned if the order does not exist (anymore).
+// With a station only the order items with products of the station are part of it.
+func fetchOrderView(app core.App, orderId string, station string) (*OrderView, error) {
+	orderRecord, err := app.FindRecordById(model.OrderCollection, orderId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	orderItemRecords, err := app.FindRecordsByFilter(
+		model.OrderItemCollection,
+		"order = {:order}",
+		"created,id",
+		0,
+		0,
+		dbx.Params{"order": orderId},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	view := &OrderView{Order: model.OrderFromRecord(orderRecord), Items: []OrderViewItem{}}
+	loader := newRelationLoader(app)
+	loader.add(model.UserCollection, view.Waiter)
+	orderItems := make([]model.OrderItem, len(orderItemRecords))
+	for i, record := range orderItemRecords {
+		orderItems[i] = model.OrderItemFromRecord(record)
+		loader.add(model.MenuItemCollection, orderItems[i].MenuItem)
+		loader.add(model.ProductCollection, orderItems[i].Products...)
+	}
+	if err := loader.load(); err != nil {
+		return nil, err
+	}
+
+	if waiterRecord, ok := loader.get(model.UserCollection, view.Waiter); ok {
+		view.WaiterName = model.UserFromRecord(waiterRecord).Name
+	}
+	for _, orderItem := range orderItems {
+		var menuItem model.MenuItem
+		if menuItemRecord, ok := loader.get(model.MenuItemCollection, orderItem.MenuItem); ok {
+			menuItem = model.MenuItemFromRecord(menuItemRecord)
+		}
+
+		var products []QueueProduct
+		if station != "" {
+			products = stationProducts(loader, station, orderItem, menuItem)
+			if products == nil {
+				continue
+			}
+		} else {
+			products = []QueueProduct{}
+			for _, productId := range orderItem.Products {
+				if productRecord, ok := loader.get(model.ProductCollection, productId); ok {
+					products = append(products, QueueProduct{Id: productId, Name: productRecord.GetString("name")})
+				}
+			}
+		}
+
+		view.Items = append(view.Items, OrderViewItem{
+			Id:            orderItem.Id,
+			MenuItemId:    menuItem.Id,
+			MenuItemName:  menuItem.Name,
+			Price:         orderItem.Price,
+			Status:        orderItem.Status,
+			StationStatus: orderItem.StationStatus,
+			Notes:         orderItem.Notes,
+			Products:      products,
+		})
+	}
+	return view, nil
+}
+
+// writeServerSentEvent writes an event with the data as JSON, it is sent with the next flush.
+func writeServerSentEvent(e *core.RequestEvent, name string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.Response, "event: %s\ndata: %s\n\n", name, payload)
+	return err
+}
@@ -0,0 +1,321 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+func TestOrderStream(t *testing.T) {
+	app := newTestApp(t)
+	user, err := app.FindRecordById(model.UserCollection, "1p1725ql8j7u632")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := user.NewAuthToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{"Authorization": token}
+
+	// appFactory gives the user of the token the role
+	appFactory := func(role string) func(t testing.TB) *tests.TestApp {
+		return func(t testing.TB) *tests.TestApp {
+			app, err := tests.NewTestApp(testDataDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			roleId := ""
+			if role != "" {
+				roleRecord, err := app.FindFirstRecordByData(model.UserRoleCollection, "role_name", role)
+				if err != nil {
+					t.Fatal(err)
+				}
+				roleId = roleRecord.Id
+			}
+			user, err := app.FindRecordById(model.UserCollection, "1p1725ql8j7u632")
+			if err != nil {
+				t.Fatal(err)
+			}
+			user.Set("role", roleId)
+			if err := app.Save(user); err != nil {
+				t.Fatal(err)
+			}
+
+			app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+				e.Router.GET("/api/stream/orders", OrderStreamHandler(e.App))
+				return e.Next()
+			})
+			return app
+		}
+	}
+	// kitchenAppFactory gives the user of the token the Kueche role and the station
+	kitchenAppFactory := func(station string) func(t testing.TB) *tests.TestApp {
+		return func(t testing.TB) *tests.TestApp {
+			app := appFactory(model.RoleKueche)(t)
+			user, err := app.FindRecordById(model.UserCollection, "1p1725ql8j7u632")
+			if err != nil {
+				t.Fatal(err)
+			}
+			user.Set("station", station)
+			if err := app.Save(user); err != nil {
+				t.Fatal(err)
+			}
+			return app
+		}
+	}
+	// waiterAppFactory moves the order of another waiter to a table without orders of the user of the token
+	waiterAppFactory := func(t testing.TB) *tests.TestApp {
+		app := appFactory(model.RoleKellner)(t)
+		order, err := app.FindRecordById(model.OrderCollection, "39180c9j1kfu86n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		order.Set("table", 7)
+		if err := app.Save(order); err != nil {
+			t.Fatal(err)
+		}
+		return app
+	}
+	// changeOrderItemNotes changes the notes of an order item while the stream is open
+	changeOrderItemNotes := func(orderItem, notes string) func(t testing.TB, app *tests.TestApp, e *core.ServeEvent) {
+		return func(t testing.TB, app *tests.TestApp, e *core.ServeEvent) {
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				record, err := app.FindRecordById(model.OrderItemCollection, orderItem)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				record.Set("notes", notes)
+				if err := app.Save(record); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:           "the orders at the tables of a waiter",
+			Method:         http.MethodGet,
+			URL:            "/api/stream/orders",
+			Headers:        headers,
+			Timeout:        500 * time.Millisecond,
+			ExpectedStatus: 200,
+			ExpectedContent: []string{
+				"event: order\ndata: {\"id\":\"b69u9kp1t9d71z5\"",
+				"event: order\ndata: {\"id\":\"7c9314h8rh8469g\"",
+				"event: order\ndata: {\"id\":\"hvfhh05zbr323h5\"",
+				`"waiter_name":"Username"`,
+				`"menu_item_name":"Nutella Crepe"`,
+				`"notes":"ohne Zucker"`,
+			},
+			NotExpectedContent: []string{"39180c9j1kfu86n"},
+			BeforeTestFunc:     changeOrderItemNotes("44tv6363beu9q34", "ohne Zucker"),
+			TestAppFactory:     waiterAppFactory,
+		},
+		{
+			Name:           "the orders of a table taken over by a waiter",
+			Method:         http.MethodGet,
+			URL:            "/api/stream/orders",
+			Headers:        headers,
+			Timeout:        500 * time.Millisecond,
+			ExpectedStatus: 200,
+			ExpectedContent: []string{
+				"event: order\ndata: {\"id\":\"39180c9j1kfu86n\"",
+			},
+			BeforeTestFunc: func(t testing.TB, app *tests.TestApp, e *core.ServeEvent) {
+				go func() {
+					time.Sleep(100 * time.Millisecond)
+					order, err := app.FindRecordById(model.OrderCollection, "7c9314h8rh8469g")
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					order.Set("table", 7)
+					if err := app.Save(order); err != nil {
+						t.Error(err)
+						return
+					}
+					// the order of the other waiter at the table changes
+					orderItem, err := app.FindFirstRecordByData(model.OrderItemCollection, "order", "39180c9j1kfu86n")
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					orderItem.Set("notes", "ohne Sahne")
+					if err := app.Save(orderItem); err != nil {
+						t.Error(err)
+					}
+				}()
+			},
+			TestAppFactory: waiterAppFactory,
+		},
+		{
+			Name:           "the order items of the station of the kitchen",
+			Method:         http.MethodGet,
+			URL:            "/api/stream/orders",
+			Headers:        headers,
+			Timeout:        500 * time.Millisecond,
+			ExpectedStatus: 200,
+			ExpectedContent: []string{
+				`"id":"7c9314h8rh8469g"`,
+				`"id":"hvfhh05zbr323h5"`,
+				`"id":"virgkh8idg27vfo"`,
+				`"notes":"extra scharf"`,
+			},
+			NotExpectedContent: []string{"b69u9kp1t9d71z5", "39180c9j1kfu86n", "e5cxx50q2ln939x"},
+			BeforeTestFunc:     changeOrderItemNotes("virgkh8idg27vfo", "extra scharf"),
+			TestAppFactory:     kitchenAppFactory("7kbm0uq66x72736"),
+		},
+		{
+			Name:            "another station for the kitchen",
+			Method:          http.MethodGet,
+			URL:             "/api/stream/orders?station=w8qc24zj57849cj",
+			Headers:         headers,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{"only get the order items of their own station"},
+			TestAppFactory:  kitchenAppFactory("7kbm0uq66x72736"),
+		},
+		{
+			Name:           "a station for the Kuechenchef",
+			Method:         http.MethodGet,
+			URL:            "/api/stream/orders?station=7kbm0uq66x72736",
+			Headers:        headers,
+			Timeout:        200 * time.Millisecond,
+			ExpectedStatus: 200,
+			ExpectedContent: []string{
+				`"id":"7c9314h8rh8469g"`,
+				`"id":"virgkh8idg27vfo"`,
+			},
+			NotExpectedContent: []string{"b69u9kp1t9d71z5", "e5cxx50q2ln939x"},
+			TestAppFactory:     appFactory(model.RoleKuechenchef),
+		},
+		{
+			Name:           "all orders for the Kuechenchef",
+			Method:         http.MethodGet,
+			URL:            "/api/stream/orders",
+			Headers:        headers,
+			Timeout:        200 * time.Millisecond,
+			ExpectedStatus: 200,
+			ExpectedContent: []string{
+				`"id":"b69u9kp1t9d71z5"`,
+				`"id":"7c9314h8rh8469g"`,
+				`"id":"hvfhh05zbr323h5"`,
+				`"id":"39180c9j1kfu86n"`,
+			},
+			TestAppFactory: appFactory(model.RoleKuechenchef),
+		},
+		{
+			Name:            "the kitchen without a station",
+			Method:          http.MethodGet,
+			URL:             "/api/stream/orders",
+			Headers:         headers,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{"No station is assigned to the user"},
+			TestAppFactory:  appFactory(model.RoleKueche),
+		},
+		{
+			Name:            "a user without a role",
+			Method:          http.MethodGet,
+			URL:             "/api/stream/orders",
+			Headers:         headers,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{"only available to Kellner, Kueche and Kuechenchef"},
+			TestAppFactory:  appFactory(""),
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
+
+func TestUsersCannotAssignTheirStation(t *testing.T) {
+	app := newTestApp(t)
+	user, err := app.FindRecordById(model.UserCollection, "1p1725ql8j7u632")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := user.NewAuthToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{"Authorization": token}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:            "the own station",
+			Method:          http.MethodPatch,
+			URL:             "/api/collections/users/records/1p1725ql8j7u632",
+			Body:            strings.NewReader(`{"station":"7kbm0uq66x72736"}`),
+			Headers:         headers,
+			ExpectedStatus:  404,
+			ExpectedContent: []string{`"data":{}`},
+		},
+		{
+			Name:            "other fields of the own record",
+			Method:          http.MethodPatch,
+			URL:             "/api/collections/users/records/1p1725ql8j7u632",
+			Body:            strings.NewReader(`{"emailVisibility":true}`),
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"id":"1p1725ql8j7u632"`},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.TestAppFactory = func(t testing.TB) *tests.TestApp {
+			app, err := tests.NewTestApp(testDataDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return app
+		}
+		scenario.Test(t)
+	}
+}
+
+func TestFetchOrderViewErrors(t *testing.T) {
+	app := newTestApp(t)
+
+	view, err := fetchOrderView(app, "unknown", "")
+	if view != nil || err != nil {
+		t.Errorf("expected no view and no error for an unknown order, got %v, %v", view, err)
+	}
+
+	// other errors than a missing order are not swallowed
+	if _, err := app.DB().NewQuery("ALTER TABLE {{order}} RENAME TO {{order_gone}}").Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetchOrderView(app, "b69u9kp1t9d71z5", ""); err == nil {
+		t.Error("expected the failing query to be returned")
+	}
+}
+
+func TestOrderStreamClientMergesChanges(t *testing.T) {
+	client := &orderStreamClient{notify: make(chan struct{}, 1)}
+	client.add(orderChange{order: "a"})
+	client.add(orderChange{order: "b"})
+	client.add(orderChange{order: "a", deleted: true})
+
+	changes := client.take()
+	expected := []orderChange{{order: "a", deleted: true}, {order: "b"}}
+	if len(changes) != len(expected) || changes[0] != expected[0] || changes[1] != expected[1] {
+		t.Errorf("expected the changes %v, got %v", expected, changes)
+	}
+	if len(client.take()) != 0 {
+		t.Error("expected no changes after taking them")
+	}
+	select {
+	case <-client.notify:
+	default:
+		t.Error("expected the client to be notified")
+	}
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+	"github.com/supotsu-no-ochaya/backend/internal/printing"
+)
+
+const (
+	receiptFormatPDF    = "pdf"
+	receiptFormatESCPOS = "escpos"
+)
+
+// receiptItem is a line of the receipt for all order items of the same menu item and price.
+type receiptItem struct {
+	name     string
+	price    float64
+	quantity int
+}
+
+// PaymentReceiptHandler returns an Echo handler function rendering the receipt of the payment with the
+// path parameter 'id'. The query parameter 'format' selects a PDF ("pdf", the default) or the raw
+// ESC/POS bytes for a thermal receipt printer ("escpos").
+func PaymentReceiptHandler(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		format := e.Request.URL.Query().Get("format")
+		if format == "" {
+			format = receiptFormatPDF
+		}
+		if format != receiptFormatPDF && format != receiptFormatESCPOS {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid 'format', use 'pdf' or 'escpos'"})
+		}
+
+		paymentRecord, err := app.FindRecordById(model.PaymentCollection, e.Request.PathValue("id"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, echo.Map{"error": "Payment not found"})
+		}
+		config, err := fetchAdminConfig(app)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		receipt, err := layoutReceipt(app, model.PaymentFromRecord(paymentRecord), config.Receipt)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+
+		var body bytes.Buffer
+		contentType := "application/pdf"
+		if format == receiptFormatESCPOS {
+			contentType = "application/octet-stream"
+			body.Write(printing.ESCPOS(receipt))
+		} else {
+			doc := printing.NewPDFRoll("Beleg "+paymentRecord.Id, receipt, 10, 8)
+			if err := doc.Write(&body); err != nil {
+				return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+			}
+		}
+
+		e.Response.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="receipt-%s.%s"`, paymentRecord.Id, format))
+		return e.Blob(http.StatusOK, contentType, body.Bytes())
+	}
+}
+
+// fetchAdminConfig returns the config of the first admin settings, or an empty config if there are none.
+func fetchAdminConfig(app core.App) (model.AdminConfig, error) {
+	records, err := app.FindRecordsByFilter(model.AdminSettingsCollection, "", "created", 1, 0)
+	if err != nil || len(records) == 0 {
+		return model.AdminConfig{}, err
+	}
+	return model.AdminSettingsFromRecord(records[0]).ParseConfig()
+}
+
+// layoutReceipt lays out the itemized receipt of the payment with the header and footer of the config.
+// The labels are German like the rest of the printed documents.
+func layoutReceipt(app core.App, payment model.Payment, config model.ReceiptConfig) (*printing.Text, error) {
+	columns := config.Columns
+	if columns <= 0 {
+		columns = printing.DefaultColumns
+	}
+	receipt := printing.NewText(columns)
+
+	loader := newRelationLoader(app)
+	loader.add(model.OrderItemCollection, payment.OrderItems...)
+	loader.add(model.PaymentOptionCollection, payment.PaymentOption)
+	if err := loader.load(); err != nil {
+		return receipt, err
+	}
+	for _, orderItemId := range payment.OrderItems {
+		orderItemRecord, err := loader.mustGet(model.OrderItemCollection, orderItemId)
+		if err != nil {
+			return receipt, err
+		}
+		orderItem := model.OrderItemFromRecord(orderItemRecord)
+		loader.add(model.MenuItemCollection, orderItem.MenuItem)
+		loader.add(model.OrderCollection, orderItem.Order)
+	}
+	if err := loader.load(); err != nil {
+		return receipt, err
+	}
+
+	// order items of the same menu item and price are printed as one line with their quantity
+	items := []*receiptItem{}
+	var order model.Order
+	itemsByKey := map[string]*receiptItem{}
+	for _, orderItemId := range payment.OrderItems {
+		orderItemRecord, _ := loader.get(model.OrderItemCollection, orderItemId)
+		orderItem := model.OrderItemFromRecord(orderItemRecord)
+		if order.Id == "" {
+			if orderRecord, ok := loader.get(model.OrderCollection, orderItem.Order); ok {
+				order = model.OrderFromRecord(orderRecord)
+			}
+		}
+
+		var menuItem model.MenuItem
+		if menuItemRecord, ok := loader.get(model.MenuItemCollection, orderItem.MenuItem); ok {
+			menuItem = model.MenuItemFromRecord(menuItemRecord)
+		}
+		key := fmt.Sprintf("%s/%v", orderItem.MenuItem, orderItem.Price)
+		item, ok := itemsByKey[key]
+		if !ok {
+			item = &receiptItem{name: menuItem.Name, price: orderItem.Price}
+			itemsByKey[key] = item
+			items = append(items, item)
+		}
+		item.quantity++
+	}
+
+	if order.Waiter != "" {
+		loader.add(model.UserCollection, order.Waiter)
+		if err := loader.load(); err != nil {
+			return receipt, err
+		}
+	}
+
+	for _, line := range splitConfigLines(config.Header) {
+		receipt.CenteredLine(line)
+	}
+	receipt.Separator()
+	receipt.Line("Beleg " + payment.Id)
+	receipt.Line("Datum: " + printing.FormatTime(payment.Created))
+	if order.Id != "" {
+		table := "Tisch " + strconv.FormatFloat(order.Table, 'f', -1, 64)
+		if waiterRecord, ok := loader.get(model.UserCollection, order.Waiter); ok {
+			table += ", Kellner: " + model.UserFromRecord(waiterRecord).Name
+		}
+		receipt.Line(table)
+	}
+	receipt.Separator()
+
+	for _, item := range items {
+		receipt.ColumnsLine(fmt.Sprintf("%dx %s", item.quantity, item.name), printing.FormatEuro(item.price*float64(item.quantity)))
+		if item.quantity > 1 {
+			receipt.Line("   je " + printing.FormatEuro(item.price))
+		}
+	}
+	receipt.Separator()
+
+	receipt.ColumnsLine("Zwischensumme", printing.FormatEuro(payment.SubtotalAmount))
+	if payment.DiscountAmount != 0 {
+		percent := strconv.FormatFloat(payment.DiscountPercent, 'f', -1, 64)
+		receipt.ColumnsLine("Rabatt "+percent+" %", printing.FormatEuro(-payment.DiscountAmount))
+	}
+	receipt.ColumnsLine("Summe", printing.FormatEuro(payment.TotalAmount))
+	if payment.TipAmount != 0 {
+		receipt.ColumnsLine("Trinkgeld", printing.FormatEuro(payment.TipAmount))
+	}
+	receipt.BoldColumnsLine("Gesamt", printing.FormatEuro(payment.TotalAmount+payment.TipAmount))
+	if optionRecord, ok := loader.get(model.PaymentOptionCollection, payment.PaymentOption); ok {
+		receipt.Line("Bezahlt mit " + model.PaymentOptionFromRecord(optionRecord).Name)
+	}
+
+	if footer := splitConfigLines(config.Footer); len(footer) > 0 {
+		receipt.Separator()
+		for _, line := range footer {
+			receipt.CenteredLine(line)
+		}
+	}
+	return receipt, nil
+}
+
+// splitConfigLines splits configured text into its lines, no lines are returned for empty text.
+func splitConfigLines(text string) []string {
+	text = strings.TrimRight(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
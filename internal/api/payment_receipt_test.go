@@ -0,0 +1,203 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/supotsu-no-ochaya/backend/internal/hooks"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+	"github.com/supotsu-no-ochaya/backend/internal/printing"
+)
+
+const testReceiptPayment = "receiptpayment1"
+
+// newReceiptTestApp returns the test data with a card payment of 3 order items of testDeliveredOrder
+// with a discount of 10 percent and a tip of 50, and admin settings with a receipt header and footer.
+func newReceiptTestApp(tb testing.TB) *tests.TestApp {
+	tb.Helper()
+	app, err := tests.NewTestApp(testDataDir)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	hooks.RegisterOrderHooks(app)
+	hooks.RegisterOrderItemHooks(app)
+	hooks.RegisterPaymentHooks(app)
+
+	payments, err := app.FindCollectionByNameOrId(model.PaymentCollection)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	payment := core.NewRecord(payments)
+	payment.Id = testReceiptPayment
+	payment.Set("order_items", []string{"e5cxx50q2ln939x", "b4hxl8160i3x5px", "virgkh8idg27vfo"})
+	payment.Set("discount_percent", 10)
+	payment.Set("tip_amount", 50)
+	payment.Set("payment_option", "2dbpn606978dru1")
+	if err := app.Save(payment); err != nil {
+		tb.Fatal(err)
+	}
+
+	settings, err := app.FindCollectionByNameOrId(model.AdminSettingsCollection)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	record := core.NewRecord(settings)
+	record.Set("config", map[string]any{
+		"receipt": map[string]any{"header": "Supotsu no Ochaya\nMusterstraße 1", "footer": "Vielen Dank!"},
+	})
+	if err := app.Save(record); err != nil {
+		tb.Fatal(err)
+	}
+	return app
+}
+
+func TestLayoutReceipt(t *testing.T) {
+	app := newReceiptTestApp(t)
+	t.Cleanup(app.Cleanup)
+
+	paymentRecord, err := app.FindRecordById(model.PaymentCollection, testReceiptPayment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := fetchAdminConfig(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipt, err := layoutReceipt(app, model.PaymentFromRecord(paymentRecord), config.Receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := []string{}
+	for _, line := range receipt.Lines() {
+		if len([]rune(line.Text)) > printing.DefaultColumns {
+			t.Errorf("line %q is wider than %d columns", line.Text, printing.DefaultColumns)
+		}
+		lines = append(lines, line.Text)
+	}
+	text := strings.Join(lines, "\n")
+	expected := []string{
+		"            Supotsu no Ochaya",
+		"Tisch 1, Kellner: Test",
+		"2x Nutella Mochi                    2,00 €\n   je 1,00 €",
+		"1x Nutella Crepe                    3,21 €",
+		"Zwischensumme                       5,21 €",
+		"Rabatt 10 %                        -0,52 €",
+		"Summe                               4,69 €",
+		"Trinkgeld                           0,50 €",
+		"Gesamt                              5,19 €",
+		"Bezahlt mit Karte",
+		"               Vielen Dank!",
+	}
+	for _, s := range expected {
+		if !strings.Contains(text, s) {
+			t.Errorf("expected the receipt to contain %q, got\n%s", s, text)
+		}
+	}
+}
+
+func TestPaymentReceipt(t *testing.T) {
+	app := newTestApp(t)
+	user, err := app.FindRecordById(model.UserCollection, "1p1725ql8j7u632")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := user.NewAuthToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{"Authorization": token}
+
+	// roleAppFactory gives the user of the token the role and registers the route like routes.RegisterAPIRoutes
+	roleAppFactory := func(role string) func(t testing.TB) *tests.TestApp {
+		return func(t testing.TB) *tests.TestApp {
+			app := newReceiptTestApp(t)
+			setUserRole(t, app, "1p1725ql8j7u632", role)
+			app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+				e.Router.GET("/api/payments/{id}/receipt", PaymentReceiptHandler(e.App)).Bind(apis.RequireAuth(), RequireCapability(model.CapTakePayments))
+				return e.Next()
+			})
+			return app
+		}
+	}
+	appFactory := roleAppFactory(model.RoleKellner)
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:            "receipt as PDF",
+			Method:          http.MethodGet,
+			URL:             "/api/payments/" + testReceiptPayment + "/receipt",
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{"%PDF-1.4", "Musterstra\\337e 1", "2x Nutella Mochi", "Gesamt", "5,19 \\200"},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:           "receipt for a receipt printer",
+			Method:         http.MethodGet,
+			URL:            "/api/payments/" + testReceiptPayment + "/receipt?format=escpos",
+			Headers:        headers,
+			ExpectedStatus: 200,
+			ExpectedContent: []string{
+				"\x1b@\x1bt\x10",
+				"Musterstra\xdfe 1",
+				"\x1bE\x01Gesamt                              5,19 \x80\x1bE\x00\n",
+				"Vielen Dank!",
+				"\x1dVB\x00",
+			},
+			TestAppFactory: appFactory,
+		},
+		{
+			Name:            "receipt in an unknown format",
+			Method:          http.MethodGet,
+			URL:             "/api/payments/" + testReceiptPayment + "/receipt?format=html",
+			Headers:         headers,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{"Invalid 'format'"},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "receipt for the kitchen",
+			Method:          http.MethodGet,
+			URL:             "/api/payments/" + testReceiptPayment + "/receipt",
+			Headers:         headers,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{"The 'take_payments' permission is required"},
+			TestAppFactory:  roleAppFactory(model.RoleKueche),
+		},
+		{
+			Name:            "receipt for a user without a role",
+			Method:          http.MethodGet,
+			URL:             "/api/payments/" + testReceiptPayment + "/receipt",
+			Headers:         headers,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{"The 'take_payments' permission is required"},
+			TestAppFactory:  roleAppFactory(""),
+		},
+		{
+			Name:            "receipt without a token",
+			Method:          http.MethodGet,
+			URL:             "/api/payments/" + testReceiptPayment + "/receipt",
+			ExpectedStatus:  401,
+			ExpectedContent: []string{`"data":{}`},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "receipt of an unknown payment",
+			Method:          http.MethodGet,
+			URL:             "/api/payments/unknown/receipt",
+			Headers:         headers,
+			ExpectedStatus:  404,
+			ExpectedContent: []string{"Payment not found"},
+			TestAppFactory:  appFactory,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+	"github.com/supotsu-no-ochaya/backend/internal/hooks"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// RequireCapability only allows superusers and users whose role has the capability, see model.RoleCapabilities.
+// It has to be bound after apis.RequireAuth.
+func RequireCapability(capability model.Capability) *hook.Handler[*core.RequestEvent] {
+	return &hook.Handler[*core.RequestEvent]{
+		Func: func(e *core.RequestEvent) error {
+			role, superuser, err := hooks.AuthRole(e.App, e.Auth)
+			if err != nil {
+				return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+			}
+			if !superuser && !model.RoleHas(role, capability) {
+				return e.JSON(http.StatusForbidden, echo.Map{"error": fmt.Sprintf("The '%s' permission is required", capability)})
+			}
+			return e.Next()
+		},
+	}
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// setUserRole gives the user the role with the name, an empty name removes the role.
+func setUserRole(tb testing.TB, app core.App, userId, role string) {
+	tb.Helper()
+	roleId := ""
+	if role != "" {
+		roleRecord, err := app.FindFirstRecordByData(model.UserRoleCollection, "role_name", role)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		roleId = roleRecord.Id
+	}
+	user, err := app.FindRecordById(model.UserCollection, userId)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	user.Set("role", roleId)
+	if err := app.Save(user); err != nil {
+		tb.Fatal(err)
+	}
+}
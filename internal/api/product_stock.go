@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/hooks"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// RestockProductRequest is the body of RestockProductHandler.
+type RestockProductRequest struct {
+	// Quantity is added to the stock of the product.
+	Quantity int `json:"quantity"`
+}
+
+// RestockProductHandler returns an Echo handler function adding to the stock of the product with the
+// path parameter 'id'. The product is available again and its stock is tracked from then on.
+// It responds with the updated product.
+func RestockProductHandler(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		var body RestockProductRequest
+		if err := e.BindBody(&body); err != nil || body.Quantity <= 0 {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": "'quantity' has to be a positive number"})
+		}
+
+		productRecord, err := app.FindRecordById(model.ProductCollection, e.Request.PathValue("id"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, echo.Map{"error": "Product not found"})
+		}
+
+		product, err := hooks.RestockProduct(app, productRecord.Id, body.Quantity)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		return e.JSON(http.StatusOK, product)
+	}
+}
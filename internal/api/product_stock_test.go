@@ -0,0 +1,92 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/supotsu-no-ochaya/backend/internal/hooks"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+func TestRestockProduct(t *testing.T) {
+	app := newTestApp(t)
+	user, err := app.FindRecordById(model.UserCollection, "1p1725ql8j7u632")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := user.NewAuthToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{"Authorization": token}
+
+	// roleAppFactory gives the user of the token the role and registers the route like routes.RegisterAPIRoutes
+	roleAppFactory := func(role string) func(t testing.TB) *tests.TestApp {
+		return func(t testing.TB) *tests.TestApp {
+			app, err := tests.NewTestApp(testDataDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setUserRole(t, app, "1p1725ql8j7u632", role)
+			hooks.RegisterProductHooks(app)
+			hooks.RegisterStockHooks(app)
+			app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+				e.Router.POST("/api/products/{id}/restock", RestockProductHandler(e.App)).Bind(apis.RequireAuth(), RequireCapability(model.CapManageMenu))
+				return e.Next()
+			})
+			return app
+		}
+	}
+	appFactory := roleAppFactory(model.RoleKuechenchef)
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:            "restock an unavailable product",
+			Method:          http.MethodPost,
+			URL:             "/api/products/40q2m010uf0uoy8/restock",
+			Body:            strings.NewReader(`{"quantity": 12}`),
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"is_available":true`, `"track_stock":true`, `"stock":12`},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "restock as a waiter",
+			Method:          http.MethodPost,
+			URL:             "/api/products/40q2m010uf0uoy8/restock",
+			Body:            strings.NewReader(`{"quantity": 12}`),
+			Headers:         headers,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{"The 'manage_menu' permission is required"},
+			TestAppFactory:  roleAppFactory(model.RoleKellner),
+		},
+		{
+			Name:            "restock without a quantity",
+			Method:          http.MethodPost,
+			URL:             "/api/products/40q2m010uf0uoy8/restock",
+			Body:            strings.NewReader(`{"quantity": 0}`),
+			Headers:         headers,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{"'quantity' has to be a positive number"},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "restock an unknown product",
+			Method:          http.MethodPost,
+			URL:             "/api/products/unknown/restock",
+			Body:            strings.NewReader(`{"quantity": 12}`),
+			Headers:         headers,
+			ExpectedStatus:  404,
+			ExpectedContent: []string{"Product not found"},
+			TestAppFactory:  appFactory,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
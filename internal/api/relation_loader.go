@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// relationLoader resolves relation ids to records in batches.
+// Ids are collected with add and fetched by load with a single query per
+// collection, instead of one FindRecordById call per relation.
+// Records that were loaded once are kept, so the loader can be reused across export batches.
+type relationLoader struct {
+	app     core.App
+	pending map[string]map[string]struct{}
+	// loaded holds a nil record for ids which do not exist, so they are not queried again.
+	loaded map[string]map[string]*core.Record
+}
+
+func newRelationLoader(app core.App) *relationLoader {
+	return &relationLoader{
+		app:     app,
+		pending: make(map[string]map[string]struct{}),
+		loaded:  make(map[string]map[string]*core.Record),
+	}
+}
+
+// add marks the given ids of a collection to be fetched with the next load.
+// Empty ids and ids which are already loaded are ignored.
+func (l *relationLoader) add(collection string, ids ...string) {
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if _, ok := l.loaded[collection][id]; ok {
+			continue
+		}
+		if l.pending[collection] == nil {
+			l.pending[collection] = make(map[string]struct{})
+		}
+		l.pending[collection][id] = struct{}{}
+	}
+}
+
+// load fetches all pending ids with one query per collection.
+func (l *relationLoader) load() error {
+	for collection, idSet := range l.pending {
+		ids := make([]interface{}, 0, len(idSet))
+		for id := range idSet {
+			ids = append(ids, id)
+		}
+
+		records, err := l.app.FindAllRecords(collection, dbx.In("id", ids...))
+		if err != nil {
+			return err
+		}
+
+		if l.loaded[collection] == nil {
+			l.loaded[collection] = make(map[string]*core.Record, len(ids))
+		}
+		for id := range idSet {
+			l.loaded[collection][id] = nil
+		}
+		for _, record := range records {
+			l.loaded[collection][record.Id] = record
+		}
+	}
+	l.pending = make(map[string]map[string]struct{})
+	return nil
+}
+
+// get returns the loaded record of the given collection and id.
+func (l *relationLoader) get(collection, id string) (*core.Record, bool) {
+	record := l.loaded[collection][id]
+	return record, record != nil
+}
+
+// mustGet is like get but returns an error when the record does not exist.
+func (l *relationLoader) mustGet(collection, id string) (*core.Record, error) {
+	record, ok := l.get(collection, id)
+	if !ok {
+		return nil, fmt.Errorf("%s record with id %q not found", collection, id)
+	}
+	return record, nil
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// countQueries counts every query executed through app.DB() from now on.
+func countQueries(tb testing.TB, app core.App) *atomic.Int64 {
+	tb.Helper()
+	db, ok := app.DB().(*dbx.DB)
+	if !ok {
+		tb.Fatal("app.DB() is not a *dbx.DB")
+	}
+	var count atomic.Int64
+	db.QueryLogFunc = func(ctx context.Context, t time.Duration, sql string, rows *sql.Rows, err error) {
+		count.Add(1)
+	}
+	return &count
+}
+
+// loadRelationsPerRecord resolves the export relations the way the export did
+// before the relationLoader: one FindRecordById per relation.
+func loadRelationsPerRecord(app core.App) error {
+	products, err := app.FindAllRecords("product")
+	if err != nil {
+		return err
+	}
+	for _, product := range products {
+		for _, id := range product.GetStringSlice("attribute") {
+			// missing attributes were skipped by the export as well
+			_, _ = app.FindRecordById("product_attribute", id)
+		}
+	}
+
+	orderItems, err := app.FindAllRecords("order_item")
+	if err != nil {
+		return err
+	}
+	for _, orderItem := range orderItems {
+		if _, err := app.FindRecordById("menu_item", orderItem.GetString("menu_item")); err != nil {
+			return err
+		}
+	}
+
+	payments, err := app.FindAllRecords("payment")
+	if err != nil {
+		return err
+	}
+	for _, payment := range payments {
+		// missing payment options were skipped by the export as well
+		_, _ = app.FindRecordById("payment_option", payment.GetString("payment_option"))
+	}
+	return nil
+}
+
+// loadRelationsBatched resolves the same relations as loadRelationsPerRecord with a relationLoader.
+func loadRelationsBatched(app core.App) error {
+	loader := newRelationLoader(app)
+
+	products, err := app.FindAllRecords("product")
+	if err != nil {
+		return err
+	}
+	for _, product := range products {
+		loader.add("product_attribute", product.GetStringSlice("attribute")...)
+	}
+
+	orderItems, err := app.FindAllRecords("order_item")
+	if err != nil {
+		return err
+	}
+	for _, orderItem := range orderItems {
+		loader.add("menu_item", orderItem.GetString("menu_item"))
+	}
+
+	payments, err := app.FindAllRecords("payment")
+	if err != nil {
+		return err
+	}
+	for _, payment := range payments {
+		loader.add("payment_option", payment.GetString("payment_option"))
+	}
+
+	return loader.load()
+}
+
+func BenchmarkRelationLoading(b *testing.B) {
+	scenarios := []struct {
+		name string
+		load func(app core.App) error
+	}{
+		{"PerRecord", loadRelationsPerRecord},
+		{"Batched", loadRelationsBatched},
+	}
+
+	for _, s := range scenarios {
+		b.Run(s.name, func(b *testing.B) {
+			app := newTestApp(b)
+			queries := countQueries(b, app)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := s.load(app); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(queries.Load())/float64(b.N), "queries/op")
+		})
+	}
+}
+
+func BenchmarkExportJSON(b *testing.B) {
+	app := newTestApp(b)
+	queries := countQueries(b, app)
+	filter := FilterData{Start: testExportStart, End: testExportEnd}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		loader := newRelationLoader(app)
+		products, err := fetchAndEnrichProducts(app, loader, filter.Start, filter.End)
+		if err != nil {
+			b.Fatal(err)
+		}
+		menuItems, err := fetchMenuItems(app)
+		if err != nil {
+			b.Fatal(err)
+		}
+		stream := newJSONStreamWriter(io.Discard)
+		if err := streamExportData(app, loader, stream, filter, products, menuItems); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(queries.Load())/float64(b.N), "queries/op")
+}
+
+func TestRelationLoaderLoadsEachCollectionOnce(t *testing.T) {
+	app := newTestApp(t)
+	queries := countQueries(t, app)
+
+	loader := newRelationLoader(app)
+	loader.add("menu_item", "m6l80c3w6te7611", "57vya5pa711gnk7", "")
+	loader.add("payment_option", "does-not-exist")
+	if err := loader.load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := queries.Load(); got != 2 {
+		t.Errorf("expected 2 queries, got %d", got)
+	}
+
+	if record, ok := loader.get("menu_item", "m6l80c3w6te7611"); !ok || record.GetString("name") != "Nutella Mochi" {
+		t.Errorf("expected menu item 'Nutella Mochi', got %v", record)
+	}
+	if _, err := loader.mustGet("payment_option", "does-not-exist"); err == nil {
+		t.Error("expected an error for a missing record")
+	}
+
+	// already loaded ids must not be fetched again, neither must missing ones
+	loader.add("menu_item", "m6l80c3w6te7611")
+	loader.add("payment_option", "does-not-exist")
+	if err := loader.load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := queries.Load(); got != 2 {
+		t.Errorf("expected no additional queries, got %d in total", got)
+	}
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/supotsu-no-ochaya/backend/internal/hooks"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// StationQueue is what a kitchen station has to prepare, oldest order items first.
+type StationQueue struct {
+	Station model.Station      `json:"station"`
+	Items   []StationQueueItem `json:"items"`
+}
+
+// StationQueueItem is an open order item with the parts the station has to prepare.
+type StationQueueItem struct {
+	OrderItemId  string         `json:"order_item_id"`
+	OrderId      string         `json:"order_id"`
+	Table        float64        `json:"table"`
+	Status       string         `json:"status"`
+	Notes        string         `json:"notes"`
+	MenuItemId   string         `json:"menu_item_id"`
+	MenuItemName string         `json:"menu_item_name"`
+	Products     []QueueProduct `json:"products"`
+	Waiter       *model.User    `json:"waiter"`
+	Created      types.DateTime `json:"created"`
+	// WaitingSeconds is the age of the order item at the time of the request.
+	WaitingSeconds int64 `json:"waiting_seconds"`
+}
+
+// QueueProduct is a product of an order item prepared by the station.
+type QueueProduct struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// StationQueueHandler returns an Echo handler function listing the open order items
+// (status Aufgegeben or InArbeit) the station with the path parameter 'id' has to prepare.
+func StationQueueHandler(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		stationRecord, err := app.FindRecordById(model.StationCollection, e.Request.PathValue("id"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, echo.Map{"error": "Station not found"})
+		}
+
+		queue, err := fetchStationQueue(app, model.StationFromRecord(stationRecord), time.Now())
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		return e.JSON(http.StatusOK, queue)
+	}
+}
+
+// StationOrderItemStatusRequest is the body of StationOrderItemStatusHandler.
+type StationOrderItemStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// StationOrderItemStatusHandler returns an Echo handler function updating the progress of the station
+// with the path parameter 'id' on the order item with the path parameter 'orderItemId'.
+// The status of the order item follows the slowest of its stations, see the order item hooks.
+func StationOrderItemStatusHandler(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		stationId := e.Request.PathValue("id")
+		orderItemRecord, err := app.FindRecordById(model.OrderItemCollection, e.Request.PathValue("orderItemId"))
+		if err != nil {
+			return e.JSON(http.StatusNotFound, echo.Map{"error": "Order item not found"})
+		}
+
+		var body StationOrderItemStatusRequest
+		if err := e.BindBody(&body); err != nil || body.Status == "" {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": "Missing 'status'"})
+		}
+
+		orderItem := model.OrderItemFromRecord(orderItemRecord)
+		stations, err := hooks.OrderItemStations(app, orderItem)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		if !slices.Contains(stations, stationId) {
+			return e.JSON(http.StatusNotFound, echo.Map{"error": "Order item is not prepared by the station"})
+		}
+
+		oldStatus, ok := orderItem.StationStatus[stationId]
+		if !ok {
+			oldStatus = orderItem.Status
+		}
+		if err := hooks.ValidateOrderItemStatusTransition(app, e.Auth, "status", oldStatus, body.Status); err != nil {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+
+		stationStatus := orderItem.StationStatus
+		if stationStatus == nil {
+			stationStatus = map[string]string{}
+		}
+		stationStatus[stationId] = body.Status
+		orderItemRecord.Set("station_status", stationStatus)
+
+		// save the order item together with the status cascade to its order
+		err = app.RunInTransaction(func(txApp core.App) error {
+			return txApp.Save(orderItemRecord)
+		})
+		if err != nil {
+			return saveErrorJSON(e, err)
+		}
+		return e.JSON(http.StatusOK, model.OrderItemFromRecord(orderItemRecord))
+	}
+}
+
+// fetchStationQueue collects the open order items containing products of the station
+// which the station has not finished yet.
+func fetchStationQueue(app core.App, station model.Station, now time.Time) (StationQueue, error) {
+	queue := StationQueue{
+		Station: station,
+		Items:   []StationQueueItem{},
+	}
+
+	// oldest first
+	orderItemRecords := []*core.Record{}
+	err := app.RecordQuery(model.OrderItemCollection).
+		AndWhere(dbx.In("status", stringSliceToInterfaceSlice(hooks.OpenOrderItemStatuses())...)).
+		OrderBy("created ASC", "id ASC").
+		All(&orderItemRecords)
+	if err != nil {
+		return queue, err
+	}
+	if len(orderItemRecords) == 0 {
+		return queue, nil
+	}
+
+	orderItems := make([]model.OrderItem, len(orderItemRecords))
+	loader := newRelationLoader(app)
+	for i, record := range orderItemRecords {
+		orderItems[i] = model.OrderItemFromRecord(record)
+		loader.add(model.MenuItemCollection, orderItems[i].MenuItem)
+		loader.add(model.ProductCollection, orderItems[i].Products...)
+		loader.add(model.OrderCollection, orderItems[i].Order)
+	}
+	if err := loader.load(); err != nil {
+		return queue, err
+	}
+
+	// waiters can only be collected once the orders are loaded
+	for _, orderItem := range orderItems {
+		if orderRecord, ok := loader.get(model.OrderCollection, orderItem.Order); ok {
+			loader.add(model.UserCollection, orderRecord.GetString("waiter"))
+		}
+	}
+	if err := loader.load(); err != nil {
+		return queue, err
+	}
+
+	for _, orderItem := range orderItems {
+		var menuItem model.MenuItem
+		if menuItemRecord, ok := loader.get(model.MenuItemCollection, orderItem.MenuItem); ok {
+			menuItem = model.MenuItemFromRecord(menuItemRecord)
+		}
+
+		products := stationProducts(loader, station.Id, orderItem, menuItem)
+		if products == nil {
+			continue
+		}
+
+		// the order item stays open until every station is done, only list it while this station is not
+		status := orderItem.Status
+		if stationStatus, ok := orderItem.StationStatus[station.Id]; ok {
+			status = stationStatus
+		}
+		if !slices.Contains(hooks.OpenOrderItemStatuses(), status) {
+			continue
+		}
+
+		item := StationQueueItem{
+			OrderItemId:    orderItem.Id,
+			OrderId:        orderItem.Order,
+			Status:         status,
+			Notes:          orderItem.Notes,
+			MenuItemId:     menuItem.Id,
+			MenuItemName:   menuItem.Name,
+			Products:       products,
+			Created:        orderItem.Created,
+			WaitingSeconds: int64(now.Sub(orderItem.Created.Time()).Seconds()),
+		}
+		if orderRecord, ok := loader.get(model.OrderCollection, orderItem.Order); ok {
+			order := model.OrderFromRecord(orderRecord)
+			item.Table = order.Table
+			if waiterRecord, ok := loader.get(model.UserCollection, order.Waiter); ok {
+				waiter := model.UserFromRecord(waiterRecord)
+				item.Waiter = &waiter
+			}
+		}
+		queue.Items = append(queue.Items, item)
+	}
+
+	return queue, nil
+}
+
+// stationProducts returns the products of the order item prepared by the station,
+// or nil if the station has nothing to do for the order item.
+// Order items without products belong to the station of their menu item.
+func stationProducts(loader *relationLoader, stationId string, orderItem model.OrderItem, menuItem model.MenuItem) []QueueProduct {
+	if len(orderItem.Products) == 0 {
+		if menuItem.Station == stationId {
+			return []QueueProduct{}
+		}
+		return nil
+	}
+
+	var products []QueueProduct
+	for _, productId := range orderItem.Products {
+		productRecord, ok := loader.get(model.ProductCollection, productId)
+		if !ok {
+			continue
+		}
+		product := model.ProductFromRecord(productRecord)
+		if model.ProductStation(product, menuItem) == stationId {
+			products = append(products, QueueProduct{Id: product.Id, Name: product.Name})
+		}
+	}
+	return products
+}
@@ -0,0 +1,257 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/supotsu-no-ochaya/backend/internal/hooks"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+func TestStationQueueHandler(t *testing.T) {
+	app := newTestApp(t)
+	user, err := app.FindRecordById(model.UserCollection, "1p1725ql8j7u632")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := user.NewAuthToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{"Authorization": token}
+
+	// roleAppFactory gives the user of the token the role and registers the route like routes.RegisterAPIRoutes
+	roleAppFactory := func(role string) func(t testing.TB) *tests.TestApp {
+		return func(t testing.TB) *tests.TestApp {
+			app, err := tests.NewTestApp(testDataDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setUserRole(t, app, "1p1725ql8j7u632", role)
+			app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+				e.Router.GET("/api/stations/{id}/queue", StationQueueHandler(e.App)).Bind(apis.RequireAuth(), RequireCapability(model.CapViewOrders))
+				return e.Next()
+			})
+			return app
+		}
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:            "the queue of a station",
+			Method:          http.MethodGet,
+			URL:             "/api/stations/7kbm0uq66x72736/queue",
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"order_item_id":"44tv6363beu9q34"`},
+			TestAppFactory:  roleAppFactory(model.RoleKueche),
+		},
+		{
+			Name:            "the queue of an unknown station",
+			Method:          http.MethodGet,
+			URL:             "/api/stations/unknown/queue",
+			Headers:         headers,
+			ExpectedStatus:  404,
+			ExpectedContent: []string{"Station not found"},
+			TestAppFactory:  roleAppFactory(model.RoleKueche),
+		},
+		{
+			Name:            "the queue for a user without a role",
+			Method:          http.MethodGet,
+			URL:             "/api/stations/7kbm0uq66x72736/queue",
+			Headers:         headers,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{"The 'view_orders' permission is required"},
+			TestAppFactory:  roleAppFactory(""),
+		},
+		{
+			Name:            "the queue without a token",
+			Method:          http.MethodGet,
+			URL:             "/api/stations/7kbm0uq66x72736/queue",
+			ExpectedStatus:  401,
+			ExpectedContent: []string{`"data":{}`},
+			TestAppFactory:  roleAppFactory(model.RoleKueche),
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
+
+func TestStationOrderItemStatusHandler(t *testing.T) {
+	app := newTestApp(t)
+	user, err := app.FindRecordById(model.UserCollection, "1p1725ql8j7u632")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := user.NewAuthToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{"Authorization": token}
+
+	// roleAppFactory gives the user of the token the role and registers the route like routes.RegisterAPIRoutes
+	roleAppFactory := func(role string) func(t testing.TB) *tests.TestApp {
+		return func(t testing.TB) *tests.TestApp {
+			app, err := tests.NewTestApp(testDataDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setUserRole(t, app, "1p1725ql8j7u632", role)
+			hooks.RegisterOrderHooks(app)
+			hooks.RegisterOrderItemHooks(app)
+			app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+				e.Router.PATCH("/api/stations/{id}/order-items/{orderItemId}", StationOrderItemStatusHandler(e.App)).Bind(apis.RequireAuth(), RequireCapability(model.CapUpdateOrders))
+				return e.Next()
+			})
+			return app
+		}
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:            "the progress of a station",
+			Method:          http.MethodPatch,
+			URL:             "/api/stations/7kbm0uq66x72736/order-items/44tv6363beu9q34",
+			Body:            strings.NewReader(`{"status": "InArbeit"}`),
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"station_status":{"7kbm0uq66x72736":"InArbeit"}`},
+			TestAppFactory:  roleAppFactory(model.RoleKueche),
+		},
+		{
+			Name:            "the progress of another station",
+			Method:          http.MethodPatch,
+			URL:             "/api/stations/u5os0gzw1p97l91/order-items/44tv6363beu9q34",
+			Body:            strings.NewReader(`{"status": "InArbeit"}`),
+			Headers:         headers,
+			ExpectedStatus:  404,
+			ExpectedContent: []string{"Order item is not prepared by the station"},
+			TestAppFactory:  roleAppFactory(model.RoleKueche),
+		},
+		{
+			Name:            "paying an order item through its station",
+			Method:          http.MethodPatch,
+			URL:             "/api/stations/w8qc24zj57849cj/order-items/e5cxx50q2ln939x",
+			Body:            strings.NewReader(`{"status": "Bezahlt"}`),
+			Headers:         headers,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{"Order items are paid by saving a payment covering them."},
+			TestAppFactory:  roleAppFactory(model.RoleKellner),
+		},
+		{
+			Name:            "the progress for a user without a role",
+			Method:          http.MethodPatch,
+			URL:             "/api/stations/7kbm0uq66x72736/order-items/44tv6363beu9q34",
+			Body:            strings.NewReader(`{"status": "InArbeit"}`),
+			Headers:         headers,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{"The 'update_orders' permission is required"},
+			TestAppFactory:  roleAppFactory(""),
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
+
+func TestFetchStationQueue(t *testing.T) {
+	app := newTestApp(t)
+	now := time.Date(2025, 1, 24, 0, 0, 0, 0, time.UTC)
+
+	queueIds := func(stationId string) []string {
+		t.Helper()
+		stationRecord, err := app.FindRecordById(model.StationCollection, stationId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		queue, err := fetchStationQueue(app, model.StationFromRecord(stationRecord), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make([]string, len(queue.Items))
+		for i, item := range queue.Items {
+			ids[i] = item.OrderItemId
+		}
+		return ids
+	}
+	assertIds := func(stationId string, expected ...string) {
+		t.Helper()
+		got := queueIds(stationId)
+		if len(got) != len(expected) {
+			t.Fatalf("station %s: expected %v, got %v", stationId, expected, got)
+		}
+		for i := range expected {
+			if got[i] != expected[i] {
+				t.Fatalf("station %s: expected %v, got %v", stationId, expected, got)
+			}
+		}
+	}
+
+	// products without a station belong to the station of their menu item,
+	// delivered order items are not part of any queue
+	assertIds("w8qc24zj57849cj", "wogjt47xn7ru29d", "00g3b1m6v1e54ef")
+	assertIds("7kbm0uq66x72736", "44tv6363beu9q34")
+	assertIds("u5os0gzw1p97l91")
+
+	// the station of a product takes precedence over the one of the menu item
+	product, err := app.FindRecordById(model.ProductCollection, "bn6pmb6r44w50m9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	product.Set("station", "u5os0gzw1p97l91")
+	if err := app.Save(product); err != nil {
+		t.Fatal(err)
+	}
+	assertIds("w8qc24zj57849cj", "00g3b1m6v1e54ef")
+	assertIds("u5os0gzw1p97l91", "wogjt47xn7ru29d")
+
+	// order items leave the queue of a station once the station is done with them
+	orderItem, err := app.FindRecordById(model.OrderItemCollection, "wogjt47xn7ru29d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orderItem.Set("station_status", map[string]string{"u5os0gzw1p97l91": "Abholbereit"})
+	if err := app.Save(orderItem); err != nil {
+		t.Fatal(err)
+	}
+	assertIds("u5os0gzw1p97l91")
+}
+
+func TestFetchStationQueueItemDetails(t *testing.T) {
+	app := newTestApp(t)
+	now := time.Date(2025, 1, 24, 0, 0, 0, 0, time.UTC)
+
+	stationRecord, err := app.FindRecordById(model.StationCollection, "7kbm0uq66x72736")
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue, err := fetchStationQueue(app, model.StationFromRecord(stationRecord), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue.Items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(queue.Items))
+	}
+
+	item := queue.Items[0]
+	if item.Table != 13 || item.Notes != "test" || item.MenuItemName != "Nutella Crepe" {
+		t.Errorf("unexpected item %+v", item)
+	}
+	if item.Waiter == nil || item.Waiter.Id != "1p1725ql8j7u632" {
+		t.Errorf("expected waiter 1p1725ql8j7u632, got %+v", item.Waiter)
+	}
+	if len(item.Products) != 1 || item.Products[0].Id != "40q2m010uf0uoy8" {
+		t.Errorf("expected product 40q2m010uf0uoy8, got %+v", item.Products)
+	}
+	if item.WaitingSeconds <= 0 {
+		t.Errorf("expected a positive waiting time, got %d", item.WaitingSeconds)
+	}
+}
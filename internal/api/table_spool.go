@@ -0,0 +1,96 @@
+package api
+
+import (
+	"bufio"
+	"io"
+	"os"
+)
+
+// rowEncoder encodes the rows of a single table into a stream.
+type rowEncoder interface {
+	encode(row []interface{}) error
+	flush() error
+}
+
+// tableSpool buffers the encoded rows of every export table in its own
+// temporary file. Rows arrive interleaved (an order, its items, their events, ...)
+// but archives have to be written one table after another, and keeping
+// them on disk bounds the memory needed for large exports.
+type tableSpool struct {
+	newEncoder func(w io.Writer, table exportTable) (rowEncoder, error)
+	tables     map[string]*spooledTable
+}
+
+type spooledTable struct {
+	file    *os.File
+	buf     *bufio.Writer
+	encoder rowEncoder
+}
+
+func newTableSpool(newEncoder func(w io.Writer, table exportTable) (rowEncoder, error)) *tableSpool {
+	return &tableSpool{
+		newEncoder: newEncoder,
+		tables:     make(map[string]*spooledTable),
+	}
+}
+
+// writeRow implements tableWriter.
+func (s *tableSpool) writeRow(table exportTable, row []interface{}) error {
+	spooled, err := s.table(table)
+	if err != nil {
+		return err
+	}
+	return spooled.encoder.encode(row)
+}
+
+// table returns the spooled table, creating its temporary file on first use.
+func (s *tableSpool) table(table exportTable) (*spooledTable, error) {
+	if spooled, ok := s.tables[table.name]; ok {
+		return spooled, nil
+	}
+
+	file, err := os.CreateTemp("", "export-"+table.name+"-*")
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(file)
+	encoder, err := s.newEncoder(buf, table)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	spooled := &spooledTable{file: file, buf: buf, encoder: encoder}
+	s.tables[table.name] = spooled
+	return spooled, nil
+}
+
+// copyTo writes the encoded rows of the table to w.
+// Tables without rows still get their (empty) encoding, e.g. a CSV header.
+func (s *tableSpool) copyTo(w io.Writer, table exportTable) error {
+	spooled, err := s.table(table)
+	if err != nil {
+		return err
+	}
+	if err := spooled.encoder.flush(); err != nil {
+		return err
+	}
+	if err := spooled.buf.Flush(); err != nil {
+		return err
+	}
+	if _, err := spooled.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, spooled.file)
+	return err
+}
+
+// cleanup removes all temporary files.
+func (s *tableSpool) cleanup() {
+	for _, spooled := range s.tables {
+		spooled.file.Close()
+		os.Remove(spooled.file.Name())
+	}
+	s.tables = make(map[string]*spooledTable)
+}
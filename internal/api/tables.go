@@ -0,0 +1,156 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/supotsu-no-ochaya/backend/internal/hooks"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// Occupancy statuses of a table.
+const (
+	tableFree     = "free"
+	tableOccupied = "occupied"
+	// tableWaitingToPay tables have been served everything they ordered, but did not pay all of it yet.
+	tableWaitingToPay = "waiting_to_pay"
+)
+
+// TableOccupancy is a table with its unpaid orders.
+// Amounts are in the unit of the order item prices (cents).
+type TableOccupancy struct {
+	model.Table
+	Status     string       `json:"status"`
+	OpenOrders []TableOrder `json:"open_orders"`
+	// SeatedSince is when the first unpaid order of the table was placed, empty for free tables.
+	SeatedSince   types.DateTime `json:"seated_since"`
+	SeatedMinutes int            `json:"seated_minutes"`
+	Outstanding   float64        `json:"outstanding"`
+}
+
+// TableOrder is an unpaid order of a TableOccupancy.
+type TableOrder struct {
+	Id      string         `json:"id"`
+	Waiter  string         `json:"waiter"`
+	Status  string         `json:"status"`
+	Person  int            `json:"person"`
+	Created types.DateTime `json:"created"`
+	// Outstanding is the price of the order items without a payment.
+	Outstanding float64 `json:"outstanding"`
+}
+
+// TablesHandler returns an Echo handler function returning the occupancy of all tables, ordered by their number.
+// The optional query parameter 'area' only returns the tables of the area.
+func TablesHandler(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		tables, err := fetchTableOccupancy(app, e.Request.URL.Query().Get("area"), time.Now())
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		return e.JSON(http.StatusOK, tables)
+	}
+}
+
+// fetchTableOccupancy collects the unpaid orders of the tables of the area (all areas if empty)
+// with the amount still to pay, the time seated is calculated up to now.
+func fetchTableOccupancy(app core.App, area string, now time.Time) ([]TableOccupancy, error) {
+	tableRecords := []*core.Record{}
+	query := app.RecordQuery(model.TableCollection).OrderBy("number ASC")
+	if area != "" {
+		query.AndWhere(dbx.HashExp{"area": area})
+	}
+	if err := query.All(&tableRecords); err != nil {
+		return nil, err
+	}
+
+	tables := make([]TableOccupancy, len(tableRecords))
+	tableIds := make([]interface{}, len(tableRecords))
+	tableIndex := make(map[string]int, len(tableRecords))
+	for i, record := range tableRecords {
+		tables[i] = TableOccupancy{
+			Table:      model.TableFromRecord(record),
+			Status:     tableFree,
+			OpenOrders: []TableOrder{},
+		}
+		tableIds[i] = record.Id
+		tableIndex[record.Id] = i
+	}
+	if len(tables) == 0 {
+		return tables, nil
+	}
+
+	orderRecords := []*core.Record{}
+	err := app.RecordQuery(model.OrderCollection).
+		AndWhere(dbx.In("dining_table", tableIds...)).
+		AndWhere(dbx.In("status", stringSliceToInterfaceSlice(hooks.UnpaidOrderStatuses())...)).
+		OrderBy("created ASC", "id ASC").
+		All(&orderRecords)
+	if err != nil {
+		return nil, err
+	}
+	if len(orderRecords) == 0 {
+		return tables, nil
+	}
+
+	orderIds := make([]interface{}, len(orderRecords))
+	for i, record := range orderRecords {
+		orderIds[i] = record.Id
+	}
+	orderItemRecords, err := app.FindAllRecords(model.OrderItemCollection, dbx.In("order", orderIds...))
+	if err != nil {
+		return nil, err
+	}
+	orderItemIds := make([]string, len(orderItemRecords))
+	for i, record := range orderItemRecords {
+		orderItemIds[i] = record.Id
+	}
+	payments, err := hooks.OrderItemPayments(app, orderItemIds)
+	if err != nil {
+		return nil, err
+	}
+	outstanding := map[string]float64{}
+	for _, record := range orderItemRecords {
+		orderItem := model.OrderItemFromRecord(record)
+		if payments[orderItem.Id] == "" {
+			outstanding[orderItem.Order] += orderItem.Price
+		}
+	}
+
+	delivered := make(map[string]int, len(tables))
+	for _, record := range orderRecords {
+		order := model.OrderFromRecord(record)
+		i := tableIndex[order.DiningTable]
+		table := &tables[i]
+		if len(table.OpenOrders) == 0 {
+			table.SeatedSince = order.Created
+			table.SeatedMinutes = int(now.Sub(order.Created.Time()).Minutes())
+		}
+		table.OpenOrders = append(table.OpenOrders, TableOrder{
+			Id:          order.Id,
+			Waiter:      order.Waiter,
+			Status:      order.Status,
+			Person:      order.Person,
+			Created:     order.Created,
+			Outstanding: outstanding[order.Id],
+		})
+		table.Outstanding += outstanding[order.Id]
+		if slices.Contains(hooks.DeliveredOrderStatuses(), order.Status) {
+			delivered[order.DiningTable]++
+		}
+	}
+	for i := range tables {
+		switch {
+		case len(tables[i].OpenOrders) == 0:
+		case delivered[tables[i].Id] == len(tables[i].OpenOrders):
+			tables[i].Status = tableWaitingToPay
+		default:
+			tables[i].Status = tableOccupied
+		}
+	}
+	return tables, nil
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+func TestTableOccupancy(t *testing.T) {
+	app := newTestApp(t)
+	now := time.Date(2025, 1, 20, 14, 8, 48, 875_000_000, time.UTC)
+
+	collection, err := app.FindCollectionByNameOrId(model.TableCollection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	terrace := core.NewRecord(collection)
+	terrace.Load(map[string]any{"number": 20, "area": "Terrasse", "seats": 4})
+	if err := app.Save(terrace); err != nil {
+		t.Fatal(err)
+	}
+
+	tables, err := fetchTableOccupancy(app, "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 3 || tables[0].Number != 1 || tables[1].Number != 13 || tables[2].Number != 20 {
+		t.Fatalf("expected the tables 1, 13 and 20, got %+v", tables)
+	}
+
+	// the order items of b69u9kp1t9d71z5 are paid already, the other two orders are delivered
+	first := tables[0]
+	if first.Status != tableOccupied || len(first.OpenOrders) != 3 || first.Outstanding != 1342 {
+		t.Errorf("unexpected occupancy of table 1: %+v", first)
+	}
+	if first.OpenOrders[0].Id != "b69u9kp1t9d71z5" || first.OpenOrders[0].Outstanding != 0 {
+		t.Errorf("expected the oldest order first, got %+v", first.OpenOrders[0])
+	}
+	if first.SeatedSince.String() != "2025-01-20 12:08:48.875Z" || first.SeatedMinutes != 120 {
+		t.Errorf("expected table 1 to be seated for 120 minutes since its oldest order, got %d since %s", first.SeatedMinutes, first.SeatedSince)
+	}
+	if tables[1].Status != tableOccupied || tables[1].Outstanding != 321 {
+		t.Errorf("unexpected occupancy of table 13: %+v", tables[1])
+	}
+	if tables[2].Status != tableFree || len(tables[2].OpenOrders) != 0 || !tables[2].SeatedSince.IsZero() {
+		t.Errorf("expected table 20 to be free, got %+v", tables[2])
+	}
+
+	// once the last order is served, table 1 only waits for the payment
+	_, err = app.DB().Update(model.OrderCollection, dbx.Params{"status": "Geliefert"}, dbx.HashExp{"id": "b69u9kp1t9d71z5"}).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables, err = fetchTableOccupancy(app, "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tables[0].Status != tableWaitingToPay {
+		t.Errorf("expected table 1 to wait for the payment, got %s", tables[0].Status)
+	}
+
+	tables, err = fetchTableOccupancy(app, "Terrasse", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 1 || tables[0].Id != terrace.Id || tables[0].Seats != 4 {
+		t.Errorf("expected only the table of the area, got %+v", tables)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/pocketbase/pocketbase/core"
 )
 
+// TestHandler returns all user records, including their emails, so it is only routed for superusers.
 func TestHandler(app core.App) func(e *core.RequestEvent) error {
 	return func(e *core.RequestEvent) error {
 		records, err := app.FindAllRecords("users", nil)
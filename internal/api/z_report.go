@@ -0,0 +1,525 @@
+package api
+
+import (
+	"cmp"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/supotsu-no-ochaya/backend/internal/hooks"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+	"github.com/supotsu-no-ochaya/backend/internal/printing"
+)
+
+// zReportRangeFilter selects the records of the period of a Z-report. Unlike for the exports the end is exclusive,
+// so a record created at the end of a period belongs to the report of the following period only.
+const zReportRangeFilter = "created >= {:start} && created < {:end}"
+
+// ZReport is the daily closing report of a period. All amounts are in cents like the order item prices.
+type ZReport struct {
+	// Id and Number are empty for a preview of a report which is not issued yet.
+	Id     string         `json:"id"`
+	Number int            `json:"number"`
+	Issued types.DateTime `json:"issued"`
+	Start  types.DateTime `json:"start"`
+	End    types.DateTime `json:"end"`
+	ZReportTotals
+}
+
+// ZReportTotals are the figures of a Z-report, they are stored as content of the issued report.
+type ZReportTotals struct {
+	Orders     int `json:"orders"`
+	OrderItems int `json:"order_items"`
+	// Sales is the sum of the prices of the ordered order items.
+	Sales    float64 `json:"sales"`
+	Payments int     `json:"payments"`
+	// Subtotal, Discounts and Revenue sum up the breakdowns of the payments, Revenue is what was paid without tips.
+	Subtotal       float64                `json:"subtotal"`
+	Discounts      float64                `json:"discounts"`
+	Revenue        float64                `json:"revenue"`
+	Tips           float64                `json:"tips"`
+	PaymentOptions []ZReportPaymentOption `json:"payment_options"`
+	MenuItems      []ZReportItemCount     `json:"menu_items"`
+	Categories     []ZReportItemCount     `json:"categories"`
+	Waiters        []ZReportWaiter        `json:"waiters"`
+	Voids          ZReportVoids           `json:"voids"`
+	// AverageOrderSeconds is the average time from placing an order until it was delivered,
+	// over the orders of the period which were delivered within it.
+	DeliveredOrders     int     `json:"delivered_orders"`
+	AverageOrderSeconds float64 `json:"average_order_seconds"`
+}
+
+// ZReportPaymentOption sums up the payments of a payment option. Payments without one have an empty id.
+type ZReportPaymentOption struct {
+	Id       string  `json:"id"`
+	Name     string  `json:"name"`
+	Payments int     `json:"payments"`
+	Revenue  float64 `json:"revenue"`
+	Tips     float64 `json:"tips"`
+}
+
+// ZReportItemCount counts the order items of a menu item or a category.
+type ZReportItemCount struct {
+	Id    string  `json:"id"`
+	Name  string  `json:"name"`
+	Count int     `json:"count"`
+	Sales float64 `json:"sales"`
+}
+
+// ZReportWaiter counts the orders of a waiter.
+type ZReportWaiter struct {
+	Id         string  `json:"id"`
+	Name       string  `json:"name"`
+	Orders     int     `json:"orders"`
+	OrderItems int     `json:"order_items"`
+	Sales      float64 `json:"sales"`
+}
+
+// ZReportVoids are the order items and payments deleted within the period.
+type ZReportVoids struct {
+	OrderItems       int     `json:"order_items"`
+	OrderItemsAmount float64 `json:"order_items_amount"`
+	Payments         int     `json:"payments"`
+	PaymentsAmount   float64 `json:"payments_amount"`
+}
+
+// IssueZReportRequest is the body of IssueZReportHandler, 'start' and 'end' are RFC3339 datetimes.
+type IssueZReportRequest struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// ZReportPreviewHandler returns an Echo handler function calculating the Z-report of the period
+// given by the 'start' and 'end' query parameters without issuing it.
+func ZReportPreviewHandler(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		startTime, endTime, err := parseQueryParams(e)
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+
+		totals, err := calculateZReportTotals(app, startTime, endTime)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		report := ZReport{ZReportTotals: totals}
+		report.Start, _ = types.ParseDateTime(startTime)
+		report.End, _ = types.ParseDateTime(endTime)
+		return e.JSON(http.StatusOK, report)
+	}
+}
+
+// IssueZReportHandler returns an Echo handler function issuing the Z-report of a finished period.
+// The report is numbered after the last one and stored, it cannot be changed afterwards.
+// Periods of issued reports must not overlap.
+func IssueZReportHandler(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		var body IssueZReportRequest
+		if err := e.BindBody(&body); err != nil || body.Start == "" || body.End == "" {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": "Missing 'start' or 'end'"})
+		}
+		startTime, endTime, err := parseTimeRange(body.Start, body.End)
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		if endTime.After(time.Now()) {
+			return e.JSON(http.StatusBadRequest, echo.Map{"error": "'end' cannot be in the future, the period has to be over"})
+		}
+		start, _ := types.ParseDateTime(startTime)
+		end, _ := types.ParseDateTime(endTime)
+
+		var report ZReport
+		var saveErr error
+		status := http.StatusInternalServerError
+		// nothing of the period can change between calculating and storing the report
+		err = app.RunInTransaction(func(txApp core.App) error {
+			overlapping, err := hooks.FindOverlappingZReport(txApp, start, end)
+			if err != nil {
+				return err
+			}
+			if overlapping != nil {
+				status = http.StatusConflict
+				return fmt.Errorf("The period overlaps with Z-report %d", overlapping.GetInt("number"))
+			}
+
+			totals, err := calculateZReportTotals(txApp, startTime, endTime)
+			if err != nil {
+				return err
+			}
+			collection, err := txApp.FindCollectionByNameOrId(model.ZReportCollection)
+			if err != nil {
+				return err
+			}
+			record := core.NewRecord(collection)
+			record.Set("start", start)
+			record.Set("end", end)
+			record.Set("content", totals)
+			if err := txApp.Save(record); err != nil {
+				saveErr = err
+				return err
+			}
+
+			report, err = zReportFromRecord(record)
+			return err
+		})
+		if saveErr != nil {
+			return saveErrorJSON(e, saveErr)
+		}
+		if err != nil {
+			return e.JSON(status, echo.Map{"error": err.Error()})
+		}
+		return e.JSON(http.StatusOK, report)
+	}
+}
+
+// ZReportHandler returns an Echo handler function returning the issued Z-report with the path parameter 'number'.
+func ZReportHandler(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		report, err := findZReport(app, e.Request.PathValue("number"))
+		if errors.Is(err, sql.ErrNoRows) {
+			return e.JSON(http.StatusNotFound, echo.Map{"error": "Z-report not found"})
+		}
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		return e.JSON(http.StatusOK, report)
+	}
+}
+
+// ZReportPDFHandler returns an Echo handler function returning the issued Z-report with the path parameter 'number'
+// as printable PDF.
+func ZReportPDFHandler(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		report, err := findZReport(app, e.Request.PathValue("number"))
+		if errors.Is(err, sql.ErrNoRows) {
+			return e.JSON(http.StatusNotFound, echo.Map{"error": "Z-report not found"})
+		}
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+
+		e.Response.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="z-report-%d.pdf"`, report.Number))
+		e.Response.Header().Set("Content-Type", "application/pdf")
+		e.Response.WriteHeader(http.StatusOK)
+
+		if err := writeZReportPDF(e.Response, report); err != nil {
+			app.Logger().Error("Failed to write Z-report PDF", "error", err)
+			return err
+		}
+		return nil
+	}
+}
+
+// findZReport returns the issued report with the number, sql.ErrNoRows is returned for unknown numbers.
+func findZReport(app core.App, numberStr string) (ZReport, error) {
+	number, err := strconv.Atoi(numberStr)
+	if err != nil {
+		return ZReport{}, sql.ErrNoRows
+	}
+	record, err := app.FindFirstRecordByFilter(model.ZReportCollection, "number = {:number}", dbx.Params{"number": number})
+	if err != nil {
+		return ZReport{}, err
+	}
+	return zReportFromRecord(record)
+}
+
+// zReportFromRecord returns the issued report with the figures stored when it was issued.
+func zReportFromRecord(record *core.Record) (ZReport, error) {
+	zReport := model.ZReportFromRecord(record)
+	report := ZReport{
+		Id:     zReport.Id,
+		Number: zReport.Number,
+		Issued: zReport.Created,
+		Start:  zReport.Start,
+		End:    zReport.End,
+	}
+	if err := json.Unmarshal(zReport.Content, &report.ZReportTotals); err != nil {
+		return report, fmt.Errorf("cannot read the content of Z-report %d: %w", zReport.Number, err)
+	}
+	return report, nil
+}
+
+// calculateZReportTotals calculates the figures of the orders, order items and payments created within the period.
+// Voids and delivery times are taken from the events of the period.
+func calculateZReportTotals(app core.App, startTime, endTime time.Time) (ZReportTotals, error) {
+	totals := ZReportTotals{
+		PaymentOptions: []ZReportPaymentOption{},
+		MenuItems:      []ZReportItemCount{},
+		Categories:     []ZReportItemCount{},
+		Waiters:        []ZReportWaiter{},
+	}
+
+	params := createdRangeParams(startTime, endTime)
+	orderRecords, err := app.FindRecordsByFilter(model.OrderCollection, zReportRangeFilter, "created,id", 0, 0, params)
+	if err != nil {
+		return totals, err
+	}
+	orderItemRecords, err := app.FindRecordsByFilter(model.OrderItemCollection, zReportRangeFilter, "created,id", 0, 0, params)
+	if err != nil {
+		return totals, err
+	}
+	paymentRecords, err := app.FindRecordsByFilter(model.PaymentCollection, zReportRangeFilter, "created,id", 0, 0, params)
+	if err != nil {
+		return totals, err
+	}
+	eventRecords, err := app.FindRecordsByFilter(model.EventCollection, zReportRangeFilter, "created,id", 0, 0, params)
+	if err != nil {
+		return totals, err
+	}
+
+	loader := newRelationLoader(app)
+	orders := make([]model.Order, len(orderRecords))
+	for i, record := range orderRecords {
+		orders[i] = model.OrderFromRecord(record)
+		loader.add(model.UserCollection, orders[i].Waiter)
+	}
+	orderItems := make([]model.OrderItem, len(orderItemRecords))
+	for i, record := range orderItemRecords {
+		orderItems[i] = model.OrderItemFromRecord(record)
+		loader.add(model.MenuItemCollection, orderItems[i].MenuItem)
+		// order items can be added to orders of an earlier period
+		loader.add(model.OrderCollection, orderItems[i].Order)
+	}
+	payments := make([]model.Payment, len(paymentRecords))
+	for i, record := range paymentRecords {
+		payments[i] = model.PaymentFromRecord(record)
+		loader.add(model.PaymentOptionCollection, payments[i].PaymentOption)
+	}
+	if err := loader.load(); err != nil {
+		return totals, err
+	}
+
+	// categories and the waiters of earlier orders can only be collected once the menu items and orders are loaded
+	for _, orderItem := range orderItems {
+		if menuItemRecord, ok := loader.get(model.MenuItemCollection, orderItem.MenuItem); ok {
+			loader.add(model.MenuCategoryCollection, menuItemRecord.GetString("category"))
+		}
+		if orderRecord, ok := loader.get(model.OrderCollection, orderItem.Order); ok {
+			loader.add(model.UserCollection, orderRecord.GetString("waiter"))
+		}
+	}
+	if err := loader.load(); err != nil {
+		return totals, err
+	}
+
+	waiters := map[string]*ZReportWaiter{}
+	waiter := func(id string) *ZReportWaiter {
+		if w, ok := waiters[id]; ok {
+			return w
+		}
+		w := &ZReportWaiter{Id: id}
+		if userRecord, ok := loader.get(model.UserCollection, id); ok {
+			w.Name = model.UserFromRecord(userRecord).Name
+		}
+		waiters[id] = w
+		return w
+	}
+
+	orderCreated := map[string]time.Time{}
+	for _, order := range orders {
+		totals.Orders++
+		waiter(order.Waiter).Orders++
+		orderCreated[order.Id] = order.Created.Time()
+	}
+
+	menuItems := map[string]*ZReportItemCount{}
+	categories := map[string]*ZReportItemCount{}
+	for _, orderItem := range orderItems {
+		totals.OrderItems++
+		totals.Sales += orderItem.Price
+
+		var menuItem model.MenuItem
+		if menuItemRecord, ok := loader.get(model.MenuItemCollection, orderItem.MenuItem); ok {
+			menuItem = model.MenuItemFromRecord(menuItemRecord)
+		}
+		countItem(menuItems, orderItem.MenuItem, menuItem.Name, orderItem.Price)
+
+		var category model.MenuCategory
+		if categoryRecord, ok := loader.get(model.MenuCategoryCollection, menuItem.Category); ok {
+			category = model.MenuCategoryFromRecord(categoryRecord)
+		}
+		countItem(categories, menuItem.Category, category.Name, orderItem.Price)
+
+		if orderRecord, ok := loader.get(model.OrderCollection, orderItem.Order); ok {
+			w := waiter(orderRecord.GetString("waiter"))
+			w.OrderItems++
+			w.Sales += orderItem.Price
+		}
+	}
+
+	paymentOptions := map[string]*ZReportPaymentOption{}
+	for _, payment := range payments {
+		totals.Payments++
+		totals.Subtotal += payment.SubtotalAmount
+		totals.Discounts += payment.DiscountAmount
+		totals.Revenue += payment.TotalAmount
+		totals.Tips += payment.TipAmount
+
+		option, ok := paymentOptions[payment.PaymentOption]
+		if !ok {
+			option = &ZReportPaymentOption{Id: payment.PaymentOption}
+			if optionRecord, ok := loader.get(model.PaymentOptionCollection, payment.PaymentOption); ok {
+				option.Name = model.PaymentOptionFromRecord(optionRecord).Name
+			}
+			paymentOptions[payment.PaymentOption] = option
+		}
+		option.Payments++
+		option.Revenue += payment.TotalAmount
+		option.Tips += payment.TipAmount
+	}
+
+	var orderSeconds float64
+	for _, eventRecord := range eventRecords {
+		event := model.EventFromRecord(eventRecord)
+		switch event.Type {
+		case model.OrderCollection:
+			// the first delivery counts, later status changes back and forth do not
+			orderId := event.ContentString("order_id")
+			created, ok := orderCreated[orderId]
+			if !ok || !slices.Contains(hooks.DeliveredOrderStatuses(), event.ContentString("status")) {
+				continue
+			}
+			delete(orderCreated, orderId)
+			totals.DeliveredOrders++
+			orderSeconds += event.Created.Time().Sub(created).Seconds()
+		case model.OrderItemCollection:
+			var content struct {
+				Voided bool    `json:"voided"`
+				Price  float64 `json:"price"`
+			}
+			if json.Unmarshal(event.Content, &content) == nil && content.Voided {
+				totals.Voids.OrderItems++
+				totals.Voids.OrderItemsAmount += content.Price
+			}
+		case model.PaymentCollection:
+			var content struct {
+				Action      string  `json:"action"`
+				TotalAmount float64 `json:"total_amount"`
+			}
+			if json.Unmarshal(event.Content, &content) == nil && content.Action == hooks.PaymentDeletedAction {
+				totals.Voids.Payments++
+				totals.Voids.PaymentsAmount += content.TotalAmount
+			}
+		}
+	}
+	if totals.DeliveredOrders > 0 {
+		totals.AverageOrderSeconds = math.Round(orderSeconds / float64(totals.DeliveredOrders))
+	}
+
+	for _, option := range paymentOptions {
+		totals.PaymentOptions = append(totals.PaymentOptions, *option)
+	}
+	slices.SortFunc(totals.PaymentOptions, func(a, b ZReportPaymentOption) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.Id, b.Id))
+	})
+	totals.MenuItems = sortedItemCounts(menuItems)
+	totals.Categories = sortedItemCounts(categories)
+	for _, w := range waiters {
+		totals.Waiters = append(totals.Waiters, *w)
+	}
+	slices.SortFunc(totals.Waiters, func(a, b ZReportWaiter) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.Id, b.Id))
+	})
+
+	return totals, nil
+}
+
+func countItem(counts map[string]*ZReportItemCount, id, name string, price float64) {
+	count, ok := counts[id]
+	if !ok {
+		count = &ZReportItemCount{Id: id, Name: name}
+		counts[id] = count
+	}
+	count.Count++
+	count.Sales += price
+}
+
+// sortedItemCounts returns the counts with the most ordered first.
+func sortedItemCounts(counts map[string]*ZReportItemCount) []ZReportItemCount {
+	sorted := make([]ZReportItemCount, 0, len(counts))
+	for _, count := range counts {
+		sorted = append(sorted, *count)
+	}
+	slices.SortFunc(sorted, func(a, b ZReportItemCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Name, b.Name), cmp.Compare(a.Id, b.Id))
+	})
+	return sorted
+}
+
+// writeZReportPDF prints the report on A4 pages. The labels are German like the rest of the printed documents.
+func writeZReportPDF(w io.Writer, report ZReport) error {
+	title := fmt.Sprintf("Z-Bericht Nr. %d", report.Number)
+	doc := printing.NewPDFDocument(title, printing.A4Width, printing.A4Height, 50, 10)
+
+	doc.BoldLine(title)
+	doc.Line("Zeitraum: " + printing.FormatTime(report.Start) + " - " + printing.FormatTime(report.End))
+	doc.Line("Erstellt: " + printing.FormatTime(report.Issued))
+	doc.Separator()
+
+	doc.BoldLine("Umsatz")
+	doc.ColumnsLine("Bestellungen", strconv.Itoa(report.Orders))
+	doc.ColumnsLine("Bestellte Artikel", strconv.Itoa(report.OrderItems))
+	doc.ColumnsLine("Warenwert", printing.FormatEuro(report.Sales))
+	doc.ColumnsLine("Zahlungen", strconv.Itoa(report.Payments))
+	doc.ColumnsLine("Zwischensumme", printing.FormatEuro(report.Subtotal))
+	doc.ColumnsLine("Rabatte", printing.FormatEuro(-report.Discounts))
+	doc.ColumnsLine("Umsatz", printing.FormatEuro(report.Revenue))
+	doc.ColumnsLine("Trinkgeld", printing.FormatEuro(report.Tips))
+	doc.Line("")
+
+	doc.BoldLine("Zahlungsarten")
+	for _, option := range report.PaymentOptions {
+		name := option.Name
+		if name == "" {
+			name = "Ohne Zahlungsart"
+		}
+		doc.ColumnsLine(fmt.Sprintf("%s (%d)", name, option.Payments), printing.FormatEuro(option.Revenue))
+		doc.ColumnsLine("  Trinkgeld", printing.FormatEuro(option.Tips))
+	}
+	doc.Line("")
+
+	doc.BoldLine("Artikel")
+	for _, item := range report.MenuItems {
+		doc.ColumnsLine(fmt.Sprintf("%4dx %s", item.Count, item.Name), printing.FormatEuro(item.Sales))
+	}
+	doc.Line("")
+
+	doc.BoldLine("Kategorien")
+	for _, category := range report.Categories {
+		doc.ColumnsLine(fmt.Sprintf("%4dx %s", category.Count, category.Name), printing.FormatEuro(category.Sales))
+	}
+	doc.Line("")
+
+	doc.BoldLine("Kellner")
+	for _, waiter := range report.Waiters {
+		doc.ColumnsLine(
+			fmt.Sprintf("%s (%d Bestellungen, %d Artikel)", waiter.Name, waiter.Orders, waiter.OrderItems),
+			printing.FormatEuro(waiter.Sales),
+		)
+	}
+	doc.Line("")
+
+	doc.BoldLine("Stornos")
+	doc.ColumnsLine(fmt.Sprintf("Artikel (%d)", report.Voids.OrderItems), printing.FormatEuro(report.Voids.OrderItemsAmount))
+	doc.ColumnsLine(fmt.Sprintf("Zahlungen (%d)", report.Voids.Payments), printing.FormatEuro(report.Voids.PaymentsAmount))
+	doc.Line("")
+
+	seconds := int(report.AverageOrderSeconds)
+	doc.ColumnsLine(
+		fmt.Sprintf("Durchschnittliche Bestelldauer (%d Bestellungen)", report.DeliveredOrders),
+		fmt.Sprintf("%d:%02d min", seconds/60, seconds%60),
+	)
+
+	return doc.Write(w)
+}
@@ -0,0 +1,302 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/supotsu-no-ochaya/backend/internal/hooks"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// the orders 7c9314h8rh8469g, hvfhh05zbr323h5 and 39180c9j1kfu86n with 10 order items were placed on this day
+var (
+	testZReportStart = time.Date(2025, 1, 23, 0, 0, 0, 0, time.UTC)
+	testZReportEnd   = time.Date(2025, 1, 24, 0, 0, 0, 0, time.UTC)
+)
+
+// issueTestZReport stores the report of the period like IssueZReportHandler.
+func issueTestZReport(tb testing.TB, app core.App, startTime, endTime time.Time) *core.Record {
+	tb.Helper()
+	totals, err := calculateZReportTotals(app, startTime, endTime)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	collection, err := app.FindCollectionByNameOrId(model.ZReportCollection)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	start, _ := types.ParseDateTime(startTime)
+	end, _ := types.ParseDateTime(endTime)
+	record := core.NewRecord(collection)
+	record.Set("start", start)
+	record.Set("end", end)
+	record.Set("content", totals)
+	if err := app.Save(record); err != nil {
+		tb.Fatal(err)
+	}
+	return record
+}
+
+func TestCalculateZReportTotals(t *testing.T) {
+	app := newTestApp(t)
+
+	totals, err := calculateZReportTotals(app, testZReportStart, testZReportEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totals.Orders != 3 || totals.OrderItems != 10 || totals.Sales != 1663 || totals.Payments != 0 {
+		t.Fatalf("unexpected totals %+v", totals)
+	}
+
+	// 36.6 and 39.7 seconds from placing the orders until they were delivered
+	if totals.DeliveredOrders != 2 || totals.AverageOrderSeconds != 38 {
+		t.Errorf("expected 2 delivered orders taking 38 seconds, got %d taking %.0f", totals.DeliveredOrders, totals.AverageOrderSeconds)
+	}
+
+	menuItems := []string{}
+	for _, item := range totals.MenuItems {
+		menuItems = append(menuItems, item.Name)
+	}
+	if !slices.Equal(menuItems, []string{"Spekulatiuscreme Mochi", "Nutella Crepe", "Nutella Mochi"}) {
+		t.Errorf("expected the most ordered menu items first, got %v", menuItems)
+	}
+	if totals.MenuItems[1].Count != 3 || totals.MenuItems[1].Sales != 963 {
+		t.Errorf("unexpected count of Nutella Crepe %+v", totals.MenuItems[1])
+	}
+	if len(totals.Categories) != 2 || totals.Categories[0].Name != "Mochi" || totals.Categories[0].Count != 7 {
+		t.Errorf("unexpected categories %+v", totals.Categories)
+	}
+
+	expectedWaiters := []ZReportWaiter{
+		{Id: "u805e7e223v6521", Name: "Test", Orders: 2, OrderItems: 9, Sales: 1342},
+		{Id: "1p1725ql8j7u632", Name: "Username", Orders: 1, OrderItems: 1, Sales: 321},
+	}
+	if !slices.Equal(totals.Waiters, expectedWaiters) {
+		t.Errorf("expected waiters %+v, got %+v", expectedWaiters, totals.Waiters)
+	}
+}
+
+func TestCalculateZReportPaymentsAndVoids(t *testing.T) {
+	app := newTestApp(t)
+	hooks.RegisterOrderHooks(app)
+	hooks.RegisterOrderItemHooks(app)
+	hooks.RegisterPaymentHooks(app)
+	startTime := time.Now().Add(-time.Minute)
+
+	payments, err := app.FindCollectionByNameOrId(model.PaymentCollection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payment := core.NewRecord(payments)
+	payment.Set("order_items", []string{"e5cxx50q2ln939x", "virgkh8idg27vfo"})
+	payment.Set("discount_percent", 10)
+	payment.Set("tip_amount", 50)
+	payment.Set("payment_option", "2dbpn606978dru1")
+	if err := app.Save(payment); err != nil {
+		t.Fatal(err)
+	}
+
+	voidedPayment := core.NewRecord(payments)
+	voidedPayment.Set("order_items", []string{"b4hxl8160i3x5px"})
+	voidedPayment.Set("payment_option", "2dbpn606978dru1")
+	if err := app.Save(voidedPayment); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delete(voidedPayment); err != nil {
+		t.Fatal(err)
+	}
+
+	voidedOrderItem, err := app.FindRecordById(model.OrderItemCollection, "4jgk742j9t6pb81")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delete(voidedOrderItem); err != nil {
+		t.Fatal(err)
+	}
+
+	totals, err := calculateZReportTotals(app, startTime, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totals.Payments != 1 || totals.Subtotal != 421 || totals.Discounts != 42 || totals.Revenue != 379 || totals.Tips != 50 {
+		t.Errorf("unexpected payment totals %+v", totals)
+	}
+	expectedOptions := []ZReportPaymentOption{{Id: "2dbpn606978dru1", Name: "Karte", Payments: 1, Revenue: 379, Tips: 50}}
+	if !slices.Equal(totals.PaymentOptions, expectedOptions) {
+		t.Errorf("expected payment options %+v, got %+v", expectedOptions, totals.PaymentOptions)
+	}
+	expectedVoids := ZReportVoids{OrderItems: 1, OrderItemsAmount: 100, Payments: 1, PaymentsAmount: 100}
+	if totals.Voids != expectedVoids {
+		t.Errorf("expected voids %+v, got %+v", expectedVoids, totals.Voids)
+	}
+}
+
+func TestZReportsAreNumberedAndImmutable(t *testing.T) {
+	app := newTestApp(t)
+	hooks.RegisterZReportHooks(app)
+
+	first := issueTestZReport(t, app, testZReportStart, testZReportEnd)
+	second := issueTestZReport(t, app, testZReportEnd, testZReportEnd.Add(24*time.Hour))
+	if first.GetInt("number") != 1 || second.GetInt("number") != 2 {
+		t.Fatalf("expected the numbers 1 and 2, got %d and %d", first.GetInt("number"), second.GetInt("number"))
+	}
+
+	first.Set("number", 3)
+	if err := app.Save(first); !errors.Is(err, hooks.ErrZReportImmutable) {
+		t.Errorf("expected updating a Z-report to fail with ErrZReportImmutable, got %v", err)
+	}
+	if err := app.Delete(second); !errors.Is(err, hooks.ErrZReportImmutable) {
+		t.Errorf("expected deleting a Z-report to fail with ErrZReportImmutable, got %v", err)
+	}
+}
+
+func TestZReportAPI(t *testing.T) {
+	app := newTestApp(t)
+	user, err := app.FindRecordById(model.UserCollection, "1p1725ql8j7u632")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := user.NewAuthToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{"Authorization": token}
+	period := `{"start":"2025-01-23T00:00:00Z","end":"2025-01-24T00:00:00Z"}`
+
+	// roleAppFactory gives the user of the token the role and registers the routes like routes.RegisterAPIRoutes
+	roleAppFactory := func(role string) func(t testing.TB) *tests.TestApp {
+		return func(t testing.TB) *tests.TestApp {
+			app, err := tests.NewTestApp(testDataDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setUserRole(t, app, "1p1725ql8j7u632", role)
+			hooks.RegisterZReportHooks(app)
+			app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+				e.Router.GET("/api/z-reports/preview", ZReportPreviewHandler(e.App)).Bind(apis.RequireAuth(), RequireCapability(model.CapViewReports))
+				e.Router.POST("/api/z-reports", IssueZReportHandler(e.App)).Bind(apis.RequireAuth(), RequireCapability(model.CapIssueReports))
+				e.Router.GET("/api/z-reports/{number}", ZReportHandler(e.App)).Bind(apis.RequireAuth(), RequireCapability(model.CapViewReports))
+				e.Router.GET("/api/z-reports/{number}/pdf", ZReportPDFHandler(e.App)).Bind(apis.RequireAuth(), RequireCapability(model.CapViewReports))
+				return e.Next()
+			})
+			return app
+		}
+	}
+	appFactory := roleAppFactory(model.RoleKuechenchef)
+	issueFirstReport := func(t testing.TB, app *tests.TestApp, e *core.ServeEvent) {
+		issueTestZReport(t, app, testZReportStart, testZReportEnd)
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:            "preview",
+			Method:          http.MethodGet,
+			URL:             "/api/z-reports/preview?start=2025-01-23T00:00:00Z&end=2025-01-24T00:00:00Z",
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"number":0`, `"orders":3`, `"sales":1663`, `"average_order_seconds":38`},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "issuing a report",
+			Method:          http.MethodPost,
+			URL:             "/api/z-reports",
+			Body:            strings.NewReader(period),
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"number":1`, `"orders":3`, `"order_items":10`},
+			TestAppFactory:  appFactory,
+			AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
+				record, err := app.FindFirstRecordByData(model.ZReportCollection, "number", 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(record.GetString("content"), `"sales":1663`) {
+					t.Errorf("expected the figures to be stored with the report, got %s", record.GetString("content"))
+				}
+			},
+		},
+		{
+			Name:            "issuing a report as a waiter",
+			Method:          http.MethodPost,
+			URL:             "/api/z-reports",
+			Body:            strings.NewReader(period),
+			Headers:         headers,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{"The 'issue_reports' permission is required"},
+			TestAppFactory:  roleAppFactory(model.RoleKellner),
+		},
+		{
+			Name:            "preview of the kitchen",
+			Method:          http.MethodGet,
+			URL:             "/api/z-reports/preview?start=2025-01-23T00:00:00Z&end=2025-01-24T00:00:00Z",
+			Headers:         headers,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{"The 'view_reports' permission is required"},
+			TestAppFactory:  roleAppFactory(model.RoleKueche),
+		},
+		{
+			Name:            "issuing an overlapping report",
+			Method:          http.MethodPost,
+			URL:             "/api/z-reports",
+			Body:            strings.NewReader(`{"start":"2025-01-23T12:00:00Z","end":"2025-01-24T12:00:00Z"}`),
+			Headers:         headers,
+			ExpectedStatus:  409,
+			ExpectedContent: []string{"overlaps with Z-report 1"},
+			TestAppFactory:  appFactory,
+			BeforeTestFunc:  issueFirstReport,
+		},
+		{
+			Name:            "issuing a report of a period which is not over",
+			Method:          http.MethodPost,
+			URL:             "/api/z-reports",
+			Body:            strings.NewReader(`{"start":"2025-01-23T00:00:00Z","end":"2999-01-01T00:00:00Z"}`),
+			Headers:         headers,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{"cannot be in the future"},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "issued report",
+			Method:          http.MethodGet,
+			URL:             "/api/z-reports/1",
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"number":1`, `"start":"2025-01-23 00:00:00.000Z"`, `"sales":1663`},
+			TestAppFactory:  appFactory,
+			BeforeTestFunc:  issueFirstReport,
+		},
+		{
+			Name:            "unknown report",
+			Method:          http.MethodGet,
+			URL:             "/api/z-reports/2",
+			Headers:         headers,
+			ExpectedStatus:  404,
+			ExpectedContent: []string{"Z-report not found"},
+			TestAppFactory:  appFactory,
+			BeforeTestFunc:  issueFirstReport,
+		},
+		{
+			Name:            "issued report as PDF",
+			Method:          http.MethodGet,
+			URL:             "/api/z-reports/1/pdf",
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{"%PDF-1.4", "(Z-Bericht Nr. 1)", "Spekulatiuscreme Mochi", "%%EOF"},
+			TestAppFactory:  appFactory,
+			BeforeTestFunc:  issueFirstReport,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
@@ -0,0 +1,180 @@
+package hooks
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// ValidateBomTemplate checks the structure of the BOM template of a menu item and that its products exist.
+// Every product may only be part of the template once, so a selection maps to a single option.
+func ValidateBomTemplate(app core.App, template model.BomTemplate) error {
+	if err := validateBomTemplateStructure(template); err != nil {
+		return invalidBomTemplate(err.Error())
+	}
+
+	products := template.AllProducts()
+	if len(products) == 0 {
+		return nil
+	}
+	productRecords, err := app.FindRecordsByIds(productTableName, products)
+	if err != nil {
+		return err
+	}
+	for _, product := range products {
+		if !slices.ContainsFunc(productRecords, func(record *core.Record) bool { return record.Id == product }) {
+			return invalidBomTemplate(fmt.Sprintf("Unknown product %s", product))
+		}
+	}
+	return nil
+}
+
+func validateBomTemplateStructure(template model.BomTemplate) error {
+	if template.Type == "" && len(template.Products) == 0 && len(template.Groups) == 0 {
+		return nil
+	}
+	if template.Type != model.BomFixed {
+		return fmt.Errorf("Invalid type %q, use %q", template.Type, model.BomFixed)
+	}
+
+	seen := map[string]bool{}
+	addProduct := func(product string) error {
+		if product == "" {
+			return fmt.Errorf("Missing product")
+		}
+		if seen[product] {
+			return fmt.Errorf("Product %s is part of the template twice", product)
+		}
+		seen[product] = true
+		return nil
+	}
+	for _, product := range template.Products {
+		if err := addProduct(product); err != nil {
+			return err
+		}
+	}
+	for i, group := range template.Groups {
+		name := group.Name
+		if name == "" {
+			name = fmt.Sprintf("group %d", i+1)
+		}
+		switch group.Type {
+		case model.BomChoice:
+			if group.Count < 0 || group.ChoiceCount() > len(group.Options) {
+				return fmt.Errorf("Cannot choose %d of the %d options of %s", group.Count, len(group.Options), name)
+			}
+		case model.BomOptional:
+			if group.Count != 0 {
+				return fmt.Errorf("Only %q groups have a count, not %s", model.BomChoice, name)
+			}
+		default:
+			return fmt.Errorf("Invalid type %q of %s, use %q or %q", group.Type, name, model.BomChoice, model.BomOptional)
+		}
+		if len(group.Options) == 0 {
+			return fmt.Errorf("Missing options of %s", name)
+		}
+		for _, option := range group.Options {
+			if err := addProduct(option.Product); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func invalidBomTemplate(message string) error {
+	return validation.Errors{
+		"bom_template": validation.NewError("validation_invalid_bom_template", message),
+	}
+}
+
+// ExpandBomSelection expands the products chosen for an order item of the menu item into the products
+// of the order item and calculates its price. The fixed products are always included and don't have to be
+// chosen; the products are sorted like the template: the fixed products first, then the groups.
+// The price is the one of the menu item plus the price deltas of the chosen options.
+func ExpandBomSelection(menuItem model.MenuItem, template model.BomTemplate, selection []string) ([]string, float64, error) {
+	products := append([]string{}, template.Products...)
+	price := menuItem.Price
+	chosen := map[string]bool{}
+	for _, product := range template.Products {
+		chosen[product] = true
+	}
+
+	for _, group := range template.Groups {
+		count := 0
+		for _, option := range group.Options {
+			if !slices.Contains(selection, option.Product) {
+				continue
+			}
+			products = append(products, option.Product)
+			price += option.PriceDelta
+			chosen[option.Product] = true
+			count++
+		}
+		if group.Type == model.BomChoice && count != group.ChoiceCount() {
+			return nil, 0, invalidBomSelection(fmt.Sprintf("Choose %d of %s", group.ChoiceCount(), group.Name))
+		}
+	}
+	for _, product := range selection {
+		if !chosen[product] {
+			return nil, 0, invalidBomSelection(fmt.Sprintf("Product %s is not part of %s", product, menuItem.Name))
+		}
+	}
+	if price < 0 {
+		return nil, 0, invalidBomSelection(fmt.Sprintf("The price of %s would be negative", menuItem.Name))
+	}
+	return products, price, nil
+}
+
+func invalidBomSelection(message string) error {
+	return validation.Errors{
+		"products": validation.NewError("validation_invalid_bom_selection", message),
+	}
+}
+
+// expandOrderItemBom replaces the products chosen for the order item record by its expanded products
+// and sets its price, see ExpandBomSelection. The chosen options have to be available.
+// Order items of menu items without a BOM template are left as they are.
+func expandOrderItemBom(app core.App, record *core.Record, menuItem model.MenuItem) error {
+	template, err := menuItem.ParseBomTemplate()
+	if err != nil {
+		return invalidBomTemplate(err.Error())
+	}
+	if template.Type == "" {
+		return nil
+	}
+
+	orderItem := model.OrderItemFromRecord(record)
+	products, price, err := ExpandBomSelection(menuItem, template, orderItem.Products)
+	if err != nil {
+		return err
+	}
+	if len(products) > 0 {
+		productRecords, err := app.FindRecordsByIds(productTableName, products)
+		if err != nil {
+			return err
+		}
+		unavailable := []string{}
+		for _, productRecord := range productRecords {
+			if product := model.ProductFromRecord(productRecord); !product.IsAvailable {
+				unavailable = append(unavailable, product.Name)
+			}
+		}
+		if len(unavailable) > 0 {
+			return validation.Errors{
+				"products": validation.NewError(
+					"validation_product_unavailable",
+					"Unavailable products: "+strings.Join(unavailable, ", "),
+				),
+			}
+		}
+	}
+
+	record.Set("products", products)
+	record.Set("price", price)
+	return nil
+}
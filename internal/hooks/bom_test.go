@@ -0,0 +1,230 @@
+package hooks
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+const (
+	testProductCinnamon = "wngz7h4f47i6uj0"
+	testProductApple    = "43v7e9d7jxwq50k"
+	testProductMilk     = "888i7d52u2c32m9"
+	testMenuItemCrepe   = "o0u30w3s7f74aa5"
+)
+
+// testCrepeTemplate is a crepe with a choice of a filling and milk as add-on.
+var testCrepeTemplate = model.BomTemplate{
+	Type:     model.BomFixed,
+	Products: []string{testProductCrepe},
+	Groups: []model.BomGroup{
+		{Type: model.BomChoice, Name: "Füllung", Options: []model.BomOption{
+			{Product: testProductCinnamon},
+			{Product: testProductApple, PriceDelta: 30},
+		}},
+		{Type: model.BomOptional, Name: "Extras", Options: []model.BomOption{
+			{Product: testProductMilk, PriceDelta: 50},
+		}},
+	},
+}
+
+func TestValidateBomTemplate(t *testing.T) {
+	app := newTestApp(t)
+
+	scenarios := []struct {
+		name     string
+		template model.BomTemplate
+		expected string
+	}{
+		{"no template", model.BomTemplate{}, ""},
+		{"fixed", model.BomTemplate{Type: model.BomFixed, Products: []string{testProductMochi}}, ""},
+		{"choice and add-ons", testCrepeTemplate, ""},
+		{"unknown type", model.BomTemplate{Type: "Menu", Products: []string{testProductMochi}}, `Invalid type "Menu"`},
+		{"unknown product", model.BomTemplate{Type: model.BomFixed, Products: []string{"unknown"}}, "Unknown product unknown"},
+		{"product twice", model.BomTemplate{
+			Type:     model.BomFixed,
+			Products: []string{testProductCrepe},
+			Groups:   []model.BomGroup{{Type: model.BomOptional, Options: []model.BomOption{{Product: testProductCrepe}}}},
+		}, "part of the template twice"},
+		{"choice of too many", model.BomTemplate{
+			Type:   model.BomFixed,
+			Groups: []model.BomGroup{{Type: model.BomChoice, Name: "Füllung", Count: 2, Options: []model.BomOption{{Product: testProductApple}}}},
+		}, "Cannot choose 2 of the 1 options of Füllung"},
+		{"group without options", model.BomTemplate{
+			Type:   model.BomFixed,
+			Groups: []model.BomGroup{{Type: model.BomOptional, Name: "Extras"}},
+		}, "Missing options of Extras"},
+		{"unknown group type", model.BomTemplate{
+			Type:   model.BomFixed,
+			Groups: []model.BomGroup{{Type: "Any", Options: []model.BomOption{{Product: testProductApple}}}},
+		}, `Invalid type "Any" of group 1`},
+	}
+
+	for _, s := range scenarios {
+		err := ValidateBomTemplate(app, s.template)
+		if s.expected == "" {
+			if err != nil {
+				t.Errorf("%s: expected a valid template, got %v", s.name, err)
+			}
+			continue
+		}
+		assertValidationCode(t, err, "bom_template", "validation_invalid_bom_template")
+		if !strings.Contains(err.Error(), s.expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", s.name, s.expected, err)
+		}
+	}
+}
+
+func TestExpandBomSelection(t *testing.T) {
+	menuItem := model.MenuItem{Name: "Crepe", Price: 450}
+
+	scenarios := []struct {
+		name             string
+		selection        []string
+		expectedProducts []string
+		expectedPrice    float64
+		expectedError    string
+	}{
+		{"choice", []string{testProductCinnamon}, []string{testProductCrepe, testProductCinnamon}, 450, ""},
+		{"choice with a price delta and an add-on", []string{testProductMilk, testProductApple, testProductCrepe},
+			[]string{testProductCrepe, testProductApple, testProductMilk}, 530, ""},
+		{"missing choice", []string{testProductMilk}, nil, 0, "Choose 1 of Füllung"},
+		{"two choices", []string{testProductCinnamon, testProductApple}, nil, 0, "Choose 1 of Füllung"},
+		{"unknown product", []string{testProductCinnamon, testProductMochi}, nil, 0, "Product " + testProductMochi + " is not part of Crepe"},
+	}
+
+	for _, s := range scenarios {
+		products, price, err := ExpandBomSelection(menuItem, testCrepeTemplate, s.selection)
+		if s.expectedError != "" {
+			assertValidationCode(t, err, "products", "validation_invalid_bom_selection")
+			if !strings.Contains(err.Error(), s.expectedError) {
+				t.Errorf("%s: expected an error containing %q, got %v", s.name, s.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", s.name, err)
+			continue
+		}
+		if !slices.Equal(products, s.expectedProducts) || price != s.expectedPrice {
+			t.Errorf("%s: expected %v for %v, got %v for %v", s.name, s.expectedProducts, s.expectedPrice, products, price)
+		}
+	}
+}
+
+// setCrepeTemplate gives the crepe menu item testCrepeTemplate and makes its products available.
+func setCrepeTemplate(tb testing.TB, app core.App) {
+	tb.Helper()
+	for _, product := range testCrepeTemplate.AllProducts() {
+		setProductAvailable(tb, app, product, true)
+	}
+	template, err := json.Marshal(testCrepeTemplate)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	record, err := app.FindRecordById(model.MenuItemCollection, testMenuItemCrepe)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	record.Set("bom_template", types.JSONRaw(template))
+	if err := app.Save(record); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func TestBomTemplatesAreValidatedOnSave(t *testing.T) {
+	app := newTestApp(t)
+	setCrepeTemplate(t, app)
+	if menuItem := findMenuItem(t, app, testMenuItemCrepe); !menuItem.Available {
+		t.Fatalf("expected the crepe to be available, got %+v", menuItem)
+	}
+
+	// with one filling left the choice can still be made
+	setProductAvailable(t, app, testProductApple, false)
+	if menuItem := findMenuItem(t, app, testMenuItemCrepe); !menuItem.Available {
+		t.Fatalf("expected the crepe to be available with one filling, got %+v", menuItem)
+	}
+	setProductAvailable(t, app, testProductCinnamon, false)
+	if menuItem := findMenuItem(t, app, testMenuItemCrepe); menuItem.Available || menuItem.DisabledReason != "Not enough available options for Füllung" {
+		t.Fatalf("expected the crepe to be unavailable without fillings, got %+v", menuItem)
+	}
+
+	record, err := app.FindRecordById(model.MenuItemCollection, testMenuItemCrepe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Set("bom_template", `{"type": "Fixed", "product": ["`+testProductCrepe+`"]}`)
+	assertValidationCode(t, app.Save(record), "bom_template", "validation_invalid_bom_template")
+}
+
+func TestOrderItemsAreExpandedWithTheBomTemplate(t *testing.T) {
+	headers := authHeader(t)
+	appFactory := func(t testing.TB) *tests.TestApp {
+		app := newScenarioTestApp(t)
+		setWaiterRole(t, app, model.RoleKellner)
+		setCrepeTemplate(t, app)
+		return app
+	}
+	body := func(products ...string) *strings.Reader {
+		data, _ := json.Marshal(map[string]any{
+			"order":     "hvfhh05zbr323h5",
+			"menu_item": testMenuItemCrepe,
+			"products":  products,
+			"price":     1,
+			"status":    "Aufgegeben",
+		})
+		return strings.NewReader(string(data))
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:           "order item with a choice and an add-on",
+			Method:         http.MethodPost,
+			URL:            "/api/collections/order_item/records",
+			Body:           body(testProductApple, testProductMilk),
+			Headers:        headers,
+			ExpectedStatus: 200,
+			ExpectedContent: []string{
+				`"products":["` + testProductCrepe + `","` + testProductApple + `","` + testProductMilk + `"]`,
+				`"price":530`,
+			},
+			ExpectedEvents: map[string]int{"OnRecordCreateRequest": 1},
+			TestAppFactory: appFactory,
+		},
+		{
+			Name:            "order item without a choice",
+			Method:          http.MethodPost,
+			URL:             "/api/collections/order_item/records",
+			Body:            body(testProductMilk),
+			Headers:         headers,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{"validation_invalid_bom_selection", "Choose 1 of Füllung"},
+			TestAppFactory:  appFactory,
+		},
+		{
+			Name:            "order item with an unavailable add-on",
+			Method:          http.MethodPost,
+			URL:             "/api/collections/order_item/records",
+			Body:            body(testProductCinnamon, testProductMilk),
+			Headers:         headers,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{"validation_product_unavailable", "Kuhmilch"},
+			TestAppFactory: func(t testing.TB) *tests.TestApp {
+				app := appFactory(t)
+				setProductAvailable(t, app, testProductMilk, false)
+				return app
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
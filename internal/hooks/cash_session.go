@@ -0,0 +1,135 @@
+package hooks
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+const (
+	cashSessionTableName string = model.CashSessionCollection
+)
+
+func RegisterCashSessionHooks(app core.App) {
+	app.OnRecordCreate(cashSessionTableName).BindFunc(cashSessionCreate)
+}
+
+// cashSessionCreate allows a single open cash session per waiter,
+// otherwise it would be ambiguous which drawer a cash payment goes to.
+func cashSessionCreate(cashSessionRecordEvent *core.RecordEvent) error {
+	waiter := cashSessionRecordEvent.Record.GetString("waiter")
+	openSession, err := FindOpenCashSession(cashSessionRecordEvent.App, waiter)
+	if err != nil {
+		return err
+	}
+	if openSession != nil {
+		return validation.Errors{
+			"waiter": validation.NewError(
+				"validation_cash_session_already_open",
+				fmt.Sprintf("The waiter already has the open cash session %s", openSession.Id),
+			),
+		}
+	}
+	return cashSessionRecordEvent.Next()
+}
+
+// FindOpenCashSession returns the open cash session of the waiter, or nil if there is none.
+func FindOpenCashSession(app core.App, waiter string) (*core.Record, error) {
+	record, err := app.FindFirstRecordByFilter(
+		cashSessionTableName,
+		"waiter = {:waiter} && closed = ''",
+		dbx.Params{"waiter": waiter},
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return record, err
+}
+
+// attachCashSession attaches a cash payment to the open cash session of the waiter of its order,
+// so the payment is part of the reconciliation when the waiter closes the drawer.
+// Other payments are detached, e.g. when a payment is changed from cash to card.
+func attachCashSession(app core.App, record *core.Record) error {
+	payment := model.PaymentFromRecord(record)
+	cash, err := isCashPayment(app, payment)
+	if err != nil {
+		return err
+	}
+	if !cash {
+		record.Set("cash_session", "")
+		return nil
+	}
+
+	// a session chosen by the client has to be open, a session kept by an update stays
+	if payment.CashSession != "" {
+		if !record.IsNew() && payment.CashSession == record.Original().GetString("cash_session") {
+			return nil
+		}
+		sessionRecord, err := app.FindRecordById(cashSessionTableName, payment.CashSession)
+		if err != nil || !model.CashSessionFromRecord(sessionRecord).IsOpen() {
+			return validation.Errors{
+				"cash_session": validation.NewError("validation_cash_session_closed", "The cash session is not open"),
+			}
+		}
+		return nil
+	}
+
+	waiter, err := paymentWaiter(app, payment)
+	if err != nil {
+		return err
+	}
+	sessionRecord, err := FindOpenCashSession(app, waiter)
+	if err != nil {
+		return err
+	}
+	if sessionRecord == nil {
+		return validation.Errors{
+			"payment_option": validation.NewError(
+				"validation_no_open_cash_session",
+				"Cash payments need an open cash session of the waiter of the order",
+			),
+		}
+	}
+	record.Set("cash_session", sessionRecord.Id)
+	return nil
+}
+
+func isCashPayment(app core.App, payment model.Payment) (bool, error) {
+	if payment.PaymentOption == "" {
+		return false, nil
+	}
+	paymentOptionRecord, err := app.FindRecordById(model.PaymentOptionCollection, payment.PaymentOption)
+	if err != nil {
+		// unknown payment options are rejected by the relation field
+		return false, nil
+	}
+	return model.PaymentOptionFromRecord(paymentOptionRecord).Name == model.PaymentOptionCash, nil
+}
+
+// paymentWaiter returns the waiter of the order of the first order item of the payment,
+// or an empty string if the payment has no order item with an order.
+func paymentWaiter(app core.App, payment model.Payment) (string, error) {
+	if len(payment.OrderItems) == 0 {
+		return "", nil
+	}
+	orderItemRecord, err := app.FindRecordById(orderItemTableName, payment.OrderItems[0])
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	orderRecord, err := app.FindRecordById(orderTableName, orderItemRecord.GetString("order"))
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return model.OrderFromRecord(orderRecord).Waiter, nil
+}
@@ -0,0 +1,66 @@
+package hooks
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// testDeliveredOrderWaiter is the waiter of testDeliveredOrder
+const testDeliveredOrderWaiter = "u805e7e223v6521"
+
+func newCashPayment(tb testing.TB, app core.App, orderItems ...string) *core.Record {
+	tb.Helper()
+	payment := newPayment(tb, app, orderItems...)
+	payment.Set("payment_option", testPaymentOptionCash)
+	return payment
+}
+
+func TestCashPaymentsAreAttachedToTheOpenCashSession(t *testing.T) {
+	app := newTestApp(t)
+
+	// without an open cash session cash payments are rejected
+	err := saveInTransaction(app, newCashPayment(t, app, testDeliveredOrderItems[0]))
+	assertValidationCode(t, err, "payment_option", "validation_no_open_cash_session")
+
+	session := saveNewRecord(t, app, model.CashSessionCollection, map[string]any{
+		"waiter":        testDeliveredOrderWaiter,
+		"opening_float": 5000,
+	})
+
+	cash := newCashPayment(t, app, testDeliveredOrderItems[0])
+	if err := saveInTransaction(app, cash); err != nil {
+		t.Fatal(err)
+	}
+	if got := reload(t, app, cash).GetString("cash_session"); got != session.Id {
+		t.Errorf("expected the cash payment to be attached to %s, got %q", session.Id, got)
+	}
+
+	card := newPayment(t, app, testDeliveredOrderItems[1])
+	card.Set("cash_session", session.Id)
+	if err := saveInTransaction(app, card); err != nil {
+		t.Fatal(err)
+	}
+	if got := reload(t, app, card).GetString("cash_session"); got != "" {
+		t.Errorf("expected the card payment not to be attached, got %q", got)
+	}
+
+	// a waiter has a single open cash session
+	duplicate := core.NewRecord(session.Collection())
+	duplicate.Set("waiter", testDeliveredOrderWaiter)
+	assertValidationCode(t, app.Save(duplicate), "waiter", "validation_cash_session_already_open")
+
+	// nothing is attached to closed cash sessions
+	session.Set("closed", types.NowDateTime())
+	if err := app.Save(session); err != nil {
+		t.Fatal(err)
+	}
+	err = saveInTransaction(app, newCashPayment(t, app, testDeliveredOrderItems[2]))
+	assertValidationCode(t, err, "payment_option", "validation_no_open_cash_session")
+
+	explicit := newCashPayment(t, app, testDeliveredOrderItems[2])
+	explicit.Set("cash_session", session.Id)
+	assertValidationCode(t, saveInTransaction(app, explicit), "cash_session", "validation_cash_session_closed")
+}
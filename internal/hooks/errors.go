@@ -0,0 +1,38 @@
+package hooks
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrZReportImmutable is returned when changing or deleting an issued Z-report.
+var ErrZReportImmutable = errors.New("issued Z-reports cannot be changed or deleted")
+
+// InvalidStatusError is returned for a status which is not part of the status enum of a collection,
+// e.g. an empty status or one written to the database without validation.
+type InvalidStatusError struct {
+	Collection string
+	Status     string
+}
+
+func (e *InvalidStatusError) Error() string {
+	return fmt.Sprintf("invalid %s status %q", e.Collection, e.Status)
+}
+
+// StatusSchemaError is returned by CheckStatusSchema when the values of a status select field
+// differ from the statuses known to the hooks.
+type StatusSchemaError struct {
+	Collection string
+	Field      string
+	// Missing are statuses of the hooks which the select field does not allow.
+	Missing []string
+	// Unknown are values of the select field which the hooks do not handle.
+	Unknown []string
+}
+
+func (e *StatusSchemaError) Error() string {
+	return fmt.Sprintf(
+		"%s.%s does not match the statuses of the hooks (missing: %v, unknown: %v)",
+		e.Collection, e.Field, e.Missing, e.Unknown,
+	)
+}
@@ -2,11 +2,13 @@ package hooks
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
 )
 
 const (
-	eventTableName string = "event"
+	eventTableName string = model.EventCollection
 )
 
 type event[T eventMapping] struct {
@@ -20,6 +22,7 @@ const (
 	orderEventType     = eventType(orderTableName)
 	orderItemEventType = eventType(orderItemTableName)
 	productEventType   = eventType(productTableName) // Added for product events
+	paymentEventType   = eventType(paymentTableName)
 )
 
 // Define the mapping between eventType and eventContent
@@ -31,18 +34,48 @@ type eventMapping interface {
 type orderEvent struct {
 	OrderId string      `json:"order_id"`
 	Status  orderStatus `json:"status"`
+	// Action and the fields below are only set when the order is moved to another table, merged or split,
+	// see TransferOrder, MergeOrders and SplitOrder.
+	Action    orderAction `json:"action,omitempty"`
+	FromTable float64     `json:"from_table,omitempty"`
+	Table     float64     `json:"table,omitempty"`
+	// OtherOrder is the order merged into or split off this one, or the one this order was merged into
+	// or split off, with the OrderItems moved between them.
+	OtherOrder string   `json:"other_order,omitempty"`
+	OrderItems []string `json:"order_items,omitempty"`
 }
 
 // Order item event
 type orderItemEvent struct {
 	OrderItemId string          `json:"order_item_id"`
 	Status      orderItemStatus `json:"status"`
+	// Voided, MenuItem and Price are only set when the order item is deleted.
+	Voided   bool    `json:"voided,omitempty"`
+	MenuItem string  `json:"menu_item,omitempty"`
+	Price    float64 `json:"price,omitempty"`
 }
 
 // Product event
 type productEvent struct {
 	ProductId   string `json:"product_id"`
 	IsAvailable bool   `json:"is_available"`
+	// Stock and StockChange are only set when the stock changes, OrderItemId when an order item consumes it.
+	Stock       *int   `json:"stock,omitempty"`
+	StockChange int    `json:"stock_change,omitempty"`
+	OrderItemId string `json:"order_item_id,omitempty"`
+}
+
+// Payment event
+type paymentEvent struct {
+	PaymentId       string        `json:"payment_id"`
+	Action          paymentAction `json:"action"`
+	SubtotalAmount  float64       `json:"subtotal_amount"`
+	DiscountAmount  float64       `json:"discount_amount"`
+	TotalAmount     float64       `json:"total_amount"`
+	TipAmount       float64       `json:"tip_amount"`
+	DiscountPercent float64       `json:"discount_percent"`
+	PaymentOption   string        `json:"payment_option"`
+	OrderItems      []string      `json:"order_items"`
 }
 
 // Associate `orderEvent` with `orderEventType`
@@ -60,6 +93,11 @@ func (productEvent) getEventType() eventType {
 	return productEventType
 }
 
+// Associate `paymentEvent` with `paymentEventType`
+func (paymentEvent) getEventType() eventType {
+	return paymentEventType
+}
+
 func constructEvent[T eventMapping](content T) event[T] {
 	return event[T]{
 		eventType: content.getEventType(),
@@ -73,7 +111,10 @@ func (e event[T]) save(app core.App) error {
 		return err
 	}
 
-	contentString := e.stringifyContent()
+	contentString, err := e.stringifyContent()
+	if err != nil {
+		return err
+	}
 	record := core.NewRecord(collection)
 	record.Set("type", string(e.eventType))
 	record.Set("content", contentString)
@@ -81,10 +122,10 @@ func (e event[T]) save(app core.App) error {
 	return app.Save(record)
 }
 
-func (e *event[T]) stringifyContent() string {
+func (e *event[T]) stringifyContent() (string, error) {
 	data, err := json.Marshal(e.content)
 	if err != nil {
-		panic("Cannot marshal event")
+		return "", fmt.Errorf("cannot marshal %s event: %w", e.eventType, err)
 	}
-	return string(data)
+	return string(data), nil
 }
@@ -11,7 +11,10 @@ func TestCastToString(t *testing.T) {
 		Status:      orderItemStatusInArbeit,
 	})
 
-	content := event.stringifyContent()
+	content, err := event.stringifyContent()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// Expected JSON string
 	expected := `{"order_item_id":"12345","status":"InArbeit"}`
@@ -0,0 +1,86 @@
+package hooks
+
+import (
+	"errors"
+	"testing"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	_ "github.com/supotsu-no-ochaya/backend/migrations"
+)
+
+const testDataDir = "../../testdata/v5/pb_data"
+
+const (
+	testStationMochi  = "w8qc24zj57849cj"
+	testStationDrinks = "u5os0gzw1p97l91"
+	testMenuItemMochi = "m6l80c3w6te7611"
+	testProductMochi  = "bn6pmb6r44w50m9"
+	testProductCrepe  = "40q2m010uf0uoy8"
+	testWaiter        = "1p1725ql8j7u632"
+	testOpenOrderItem = "wogjt47xn7ru29d"
+)
+
+// newTestApp returns a copy of the test data with the order, table, order item, product, stock, menu item, payment,
+// cash session and kitchen ticket hooks registered.
+func newTestApp(tb testing.TB) *tests.TestApp {
+	tb.Helper()
+	app := newScenarioTestApp(tb)
+	tb.Cleanup(app.Cleanup)
+	return app
+}
+
+// newScenarioTestApp is newTestApp for a tests.ApiScenario, which cleans up the app itself.
+func newScenarioTestApp(tb testing.TB) *tests.TestApp {
+	tb.Helper()
+	app, err := tests.NewTestApp(testDataDir)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	RegisterOrderHooks(app)
+	RegisterTableHooks(app)
+	RegisterOrderItemHooks(app)
+	RegisterProductHooks(app)
+	RegisterStockHooks(app)
+	RegisterMenuItemHooks(app)
+	RegisterPaymentHooks(app)
+	RegisterCashSessionHooks(app)
+	RegisterKitchenTicketHooks(app)
+	return app
+}
+
+func saveNewRecord(tb testing.TB, app core.App, collection string, data map[string]any) *core.Record {
+	tb.Helper()
+	c, err := app.FindCollectionByNameOrId(collection)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	record := core.NewRecord(c)
+	record.Load(data)
+	if err := app.Save(record); err != nil {
+		tb.Fatal(err)
+	}
+	return record
+}
+
+func reload(tb testing.TB, app core.App, record *core.Record) *core.Record {
+	tb.Helper()
+	reloaded, err := app.FindRecordById(record.Collection(), record.Id)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return reloaded
+}
+
+func assertValidationCode(tb testing.TB, err error, field, code string) {
+	tb.Helper()
+	var validationErrors validation.Errors
+	if !errors.As(err, &validationErrors) {
+		tb.Fatalf("expected a validation error for %s, got %v", field, err)
+	}
+	if validationError, _ := validationErrors[field].(validation.Error); validationError == nil || validationError.Code() != code {
+		tb.Fatalf("expected %s for %s, got %v", code, field, err)
+	}
+}
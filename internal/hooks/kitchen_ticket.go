@@ -0,0 +1,163 @@
+package hooks
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+const (
+	printJobTableName string = model.PrintJobCollection
+
+	// kitchenTicketDelay is how long a kitchen ticket waits for further order items of its order,
+	// as the order items of an order are created one after the other.
+	kitchenTicketDelay = 3 * time.Second
+)
+
+// RegisterKitchenTicketHooks queues kitchen tickets for new order items, they are printed by the print spooler.
+// RegisterOrderItemHooks has to be registered before, its after create hook continues with this one.
+func RegisterKitchenTicketHooks(app core.App) {
+	app.OnRecordAfterCreateSuccess(orderItemTableName).BindFunc(kitchenTicketAfterCreateSuccess)
+}
+
+func kitchenTicketAfterCreateSuccess(orderItemRecordEvent *core.RecordEvent) error {
+	orderItem := model.OrderItemFromRecord(orderItemRecordEvent.Record)
+	_, err := QueueKitchenTickets(orderItemRecordEvent.App, []model.OrderItem{orderItem}, time.Now().Add(kitchenTicketDelay))
+	if err != nil {
+		// the order item is saved already, the kitchen can still reprint the ticket
+		orderItemRecordEvent.App.Logger().Error("Failed to queue kitchen ticket", "orderItem", orderItem.Id, "error", err)
+	}
+	return orderItemRecordEvent.Next()
+}
+
+// QueueKitchenTickets queues the order items for every station with a printer preparing some of them,
+// to be printed at due. Order items are added to a queued ticket of their order and station as long as
+// the spooler has not tried to print it, so an order ends up on a single ticket per station.
+func QueueKitchenTickets(app core.App, orderItems []model.OrderItem, due time.Time) ([]model.PrintJob, error) {
+	jobs := []model.PrintJob{}
+	err := app.RunInTransaction(func(txApp core.App) error {
+		tickets, err := kitchenTicketsByStation(txApp, orderItems, "")
+		if err != nil {
+			return err
+		}
+		for _, ticket := range tickets {
+			record, err := txApp.FindFirstRecordByFilter(
+				printJobTableName,
+				"order = {:order} && station = {:station} && status = {:pending} && attempts = 0 && reprint = false",
+				dbx.Params{"order": ticket.order, "station": ticket.station, "pending": model.PrintJobPending},
+			)
+			if errors.Is(err, sql.ErrNoRows) {
+				record, err = newPrintJob(txApp, ticket)
+			}
+			if err != nil {
+				return err
+			}
+
+			queued := record.GetStringSlice("order_items")
+			for _, orderItem := range ticket.orderItems {
+				if !slices.Contains(queued, orderItem) {
+					queued = append(queued, orderItem)
+				}
+			}
+			record.Set("order_items", queued)
+			record.Set("next_attempt", due)
+			if err := txApp.Save(record); err != nil {
+				return err
+			}
+			jobs = append(jobs, model.PrintJobFromRecord(record))
+		}
+		return nil
+	})
+	return jobs, err
+}
+
+// QueueKitchenTicketReprint queues the order items to be printed again right away, marked as reprint.
+// With a station only the ticket of that station is printed again.
+func QueueKitchenTicketReprint(app core.App, orderItems []model.OrderItem, station string) ([]model.PrintJob, error) {
+	jobs := []model.PrintJob{}
+	err := app.RunInTransaction(func(txApp core.App) error {
+		tickets, err := kitchenTicketsByStation(txApp, orderItems, station)
+		if err != nil {
+			return err
+		}
+		for _, ticket := range tickets {
+			record, err := newPrintJob(txApp, ticket)
+			if err != nil {
+				return err
+			}
+			record.Set("order_items", ticket.orderItems)
+			record.Set("reprint", true)
+			record.Set("next_attempt", time.Now())
+			if err := txApp.Save(record); err != nil {
+				return err
+			}
+			jobs = append(jobs, model.PrintJobFromRecord(record))
+		}
+		return nil
+	})
+	return jobs, err
+}
+
+// kitchenTicket are the order items of an order a station prepares.
+type kitchenTicket struct {
+	order      string
+	station    string
+	orderItems []string
+}
+
+// kitchenTicketsByStation groups the order items by order and station, stations without a printer are left out.
+// With a station only the ticket of that station is returned.
+func kitchenTicketsByStation(app core.App, orderItems []model.OrderItem, station string) ([]*kitchenTicket, error) {
+	tickets := []*kitchenTicket{}
+	printers := map[string]bool{}
+	for _, orderItem := range orderItems {
+		stations, err := OrderItemStations(app, orderItem)
+		if err != nil {
+			return nil, err
+		}
+		for _, stationId := range stations {
+			if station != "" && stationId != station {
+				continue
+			}
+			hasPrinter, ok := printers[stationId]
+			if !ok {
+				stationRecord, err := app.FindRecordById(model.StationCollection, stationId)
+				if err != nil {
+					return nil, err
+				}
+				hasPrinter = model.StationFromRecord(stationRecord).Printer != ""
+				printers[stationId] = hasPrinter
+			}
+			if !hasPrinter {
+				continue
+			}
+
+			i := slices.IndexFunc(tickets, func(ticket *kitchenTicket) bool {
+				return ticket.order == orderItem.Order && ticket.station == stationId
+			})
+			if i < 0 {
+				tickets = append(tickets, &kitchenTicket{order: orderItem.Order, station: stationId})
+				i = len(tickets) - 1
+			}
+			tickets[i].orderItems = append(tickets[i].orderItems, orderItem.Id)
+		}
+	}
+	return tickets, nil
+}
+
+func newPrintJob(app core.App, ticket *kitchenTicket) (*core.Record, error) {
+	collection, err := app.FindCollectionByNameOrId(printJobTableName)
+	if err != nil {
+		return nil, err
+	}
+	record := core.NewRecord(collection)
+	record.Set("order", ticket.order)
+	record.Set("station", ticket.station)
+	record.Set("status", model.PrintJobPending)
+	return record, nil
+}
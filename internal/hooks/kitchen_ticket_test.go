@@ -0,0 +1,109 @@
+package hooks
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+func setStationPrinter(tb testing.TB, app core.App, station, printer string) {
+	tb.Helper()
+	record, err := app.FindRecordById(model.StationCollection, station)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	record.Set("printer", printer)
+	if err := app.Save(record); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func printJobsOfOrder(tb testing.TB, app core.App, order string) []model.PrintJob {
+	tb.Helper()
+	records, err := app.FindRecordsByFilter(model.PrintJobCollection, "order = {:order}", "created", 0, 0, dbx.Params{"order": order})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	jobs := make([]model.PrintJob, len(records))
+	for i, record := range records {
+		jobs[i] = model.PrintJobFromRecord(record)
+	}
+	return jobs
+}
+
+func TestKitchenTicketsAreQueuedPerOrderAndStation(t *testing.T) {
+	app := newTestApp(t)
+	setStationPrinter(t, app, testStationMochi, "127.0.0.1:9100")
+
+	order := saveNewRecord(t, app, model.OrderCollection, map[string]any{
+		"table":  1,
+		"waiter": testWaiter,
+		"status": "Aufgegeben",
+		"person": 1,
+	})
+	newOrderItem := func() *core.Record {
+		return saveNewRecord(t, app, model.OrderItemCollection, map[string]any{
+			"order":     order.Id,
+			"price":     5,
+			"status":    "Aufgegeben",
+			"menu_item": testMenuItemMochi,
+			"products":  []string{testProductMochi},
+		})
+	}
+	first := newOrderItem()
+	second := newOrderItem()
+
+	// both order items end up on one ticket, the drinks station has no printer
+	jobs := printJobsOfOrder(t, app, order.Id)
+	if len(jobs) != 1 {
+		t.Fatalf("expected 1 print job, got %d", len(jobs))
+	}
+	job := jobs[0]
+	if job.Station != testStationMochi || job.Status != model.PrintJobPending || job.Reprint {
+		t.Errorf("unexpected print job %+v", job)
+	}
+	if !slices.Equal(job.OrderItems, []string{first.Id, second.Id}) {
+		t.Errorf("expected the order items %v, got %v", []string{first.Id, second.Id}, job.OrderItems)
+	}
+	if !job.NextAttempt.Time().After(time.Now()) {
+		t.Errorf("expected the print job to wait for further order items, next attempt %s", job.NextAttempt)
+	}
+
+	// once the spooler tried to print the job, further order items get a new ticket
+	record, err := app.FindRecordById(model.PrintJobCollection, job.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Set("attempts", 1)
+	if err := app.Save(record); err != nil {
+		t.Fatal(err)
+	}
+	third := newOrderItem()
+	jobs = printJobsOfOrder(t, app, order.Id)
+	if len(jobs) != 2 || !slices.Equal(jobs[1].OrderItems, []string{third.Id}) {
+		t.Fatalf("expected a second print job for %s, got %+v", third.Id, jobs)
+	}
+
+	reprints, err := QueueKitchenTicketReprint(app, []model.OrderItem{
+		model.OrderItemFromRecord(first),
+		model.OrderItemFromRecord(third),
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reprints) != 1 || !reprints[0].Reprint || !slices.Equal(reprints[0].OrderItems, []string{first.Id, third.Id}) {
+		t.Errorf("expected one reprint of %v, got %+v", []string{first.Id, third.Id}, reprints)
+	}
+
+	reprints, err = QueueKitchenTicketReprint(app, []model.OrderItem{model.OrderItemFromRecord(first)}, testStationDrinks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reprints) != 0 {
+		t.Errorf("expected no reprint for a station without a printer, got %+v", reprints)
+	}
+}
@@ -0,0 +1,180 @@
+package hooks
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+const (
+	menuItemTableName string = model.MenuItemCollection
+
+	menuItemDisabledReason = "The menu item is disabled"
+)
+
+// RegisterMenuItemHooks validates the BOM templates of the menu items and keeps their availability up to date.
+// A menu item is available unless it is disabled or its BOM template cannot be fulfilled with the available
+// products; it follows the products through productAfterUpdateSuccess.
+// Order items created through the API are checked and expanded against the BOM template of their menu item.
+func RegisterMenuItemHooks(app core.App) {
+	app.OnRecordCreate(menuItemTableName).BindFunc(menuItemSave)
+	app.OnRecordUpdate(menuItemTableName).BindFunc(menuItemSave)
+	app.OnRecordCreateRequest(orderItemTableName).BindFunc(orderItemCreateRequest)
+}
+
+// menuItemSave validates a new or changed BOM template and updates the availability of a menu item
+// when it is saved, e.g. when it is disabled or its BOM template changes.
+func menuItemSave(menuItemRecordEvent *core.RecordEvent) error {
+	record := menuItemRecordEvent.Record
+	if record.IsNew() || record.GetString("bom_template") != record.Original().GetString("bom_template") {
+		template, err := model.MenuItemFromRecord(record).ParseBomTemplate()
+		if err != nil {
+			return invalidBomTemplate(err.Error())
+		}
+		if err := ValidateBomTemplate(menuItemRecordEvent.App, template); err != nil {
+			return err
+		}
+	}
+
+	if _, err := setMenuItemAvailability(menuItemRecordEvent.App, menuItemRecordEvent.Record); err != nil {
+		return err
+	}
+	return menuItemRecordEvent.Next()
+}
+
+// orderItemCreateRequest rejects order items of unavailable menu items, expands the chosen products with
+// the BOM template of the menu item (see expandOrderItemBom) and continues the request in a transaction,
+// so the stock is consumed together with the order item.
+// The availability is checked again instead of trusting the stored one.
+func orderItemCreateRequest(e *core.RecordRequestEvent) error {
+	orderItem := model.OrderItemFromRecord(e.Record)
+	// unknown menu items are rejected by the validation of the relation
+	if menuItemRecord, err := e.App.FindRecordById(menuItemTableName, orderItem.MenuItem); err == nil {
+		menuItem := model.MenuItemFromRecord(menuItemRecord)
+		available, reason, err := MenuItemAvailability(e.App, menuItem)
+		if err != nil {
+			return err
+		}
+		if !available {
+			return validation.Errors{
+				"menu_item": validation.NewError("validation_menu_item_unavailable", reason),
+			}
+		}
+		if err := expandOrderItemBom(e.App, e.Record, menuItem); err != nil {
+			return err
+		}
+	}
+	return runRequestInTransaction(e)
+}
+
+// MenuItemAvailability reports whether the menu item can be ordered, and the reason if it cannot:
+// it is disabled, a fixed product of its BOM template is unavailable or a choice has not enough available options.
+func MenuItemAvailability(app core.App, menuItem model.MenuItem) (bool, string, error) {
+	if menuItem.Disabled {
+		return false, menuItemDisabledReason, nil
+	}
+
+	template, err := menuItem.ParseBomTemplate()
+	if err != nil {
+		return false, "Invalid BOM template", nil
+	}
+	products := template.AllProducts()
+	if len(products) == 0 {
+		return true, "", nil
+	}
+	productRecords, err := app.FindRecordsByIds(productTableName, products)
+	if err != nil {
+		return false, "", err
+	}
+	available := map[string]bool{}
+	names := map[string]string{}
+	for _, record := range productRecords {
+		product := model.ProductFromRecord(record)
+		available[product.Id] = product.IsAvailable
+		names[product.Id] = product.Name
+	}
+
+	reasons := []string{}
+	unavailable := []string{}
+	for _, productId := range template.Products {
+		if !available[productId] {
+			name, ok := names[productId]
+			if !ok {
+				name = productId
+			}
+			unavailable = append(unavailable, name)
+		}
+	}
+	if len(unavailable) > 0 {
+		reasons = append(reasons, "Unavailable products: "+strings.Join(unavailable, ", "))
+	}
+	for _, group := range template.Groups {
+		if group.Type != model.BomChoice {
+			continue
+		}
+		availableOptions := 0
+		for _, option := range group.Options {
+			if available[option.Product] {
+				availableOptions++
+			}
+		}
+		if availableOptions < group.ChoiceCount() {
+			reasons = append(reasons, "Not enough available options for "+group.Name)
+		}
+	}
+	if len(reasons) > 0 {
+		return false, strings.Join(reasons, "; "), nil
+	}
+	return true, "", nil
+}
+
+// UpdateMenuItemAvailability updates the availability of the menu items made of the product.
+// Only changed menu items are saved, which notifies the realtime subscribers of "menu_item".
+func UpdateMenuItemAvailability(app core.App, productId string) error {
+	records, err := app.FindRecordsByFilter(
+		menuItemTableName,
+		"bom_template ~ {:product}",
+		"",
+		0,
+		0,
+		dbx.Params{"product": productId},
+	)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		template, err := model.MenuItemFromRecord(record).ParseBomTemplate()
+		if err != nil || !slices.Contains(template.AllProducts(), productId) {
+			continue
+		}
+		changed, err := setMenuItemAvailability(app, record)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			continue
+		}
+		if err := app.Save(record); err != nil {
+			return fmt.Errorf("failed to update the availability of menu item %s: %w", record.Id, err)
+		}
+	}
+	return nil
+}
+
+// setMenuItemAvailability sets "available" and "disabled_reason" of the menu item record
+// and reports whether they changed.
+func setMenuItemAvailability(app core.App, record *core.Record) (bool, error) {
+	available, reason, err := MenuItemAvailability(app, model.MenuItemFromRecord(record))
+	if err != nil {
+		return false, err
+	}
+	changed := record.GetBool("available") != available || record.GetString("disabled_reason") != reason
+	record.Set("available", available)
+	record.Set("disabled_reason", reason)
+	return changed, nil
+}
@@ -0,0 +1,119 @@
+package hooks
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+func findMenuItem(tb testing.TB, app core.App, id string) model.MenuItem {
+	tb.Helper()
+	record, err := app.FindRecordById(model.MenuItemCollection, id)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return model.MenuItemFromRecord(record)
+}
+
+func setProductAvailable(tb testing.TB, app core.App, id string, available bool) {
+	tb.Helper()
+	record, err := app.FindRecordById(model.ProductCollection, id)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	record.Set("is_available", available)
+	if err := app.Save(record); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func TestMenuItemAvailabilityFollowsProducts(t *testing.T) {
+	app := newTestApp(t)
+
+	// all products of the test data are unavailable
+	menuItem := findMenuItem(t, app, testMenuItemMochi)
+	if menuItem.Available || menuItem.DisabledReason != "Unavailable products: Nutella Mochi" {
+		t.Fatalf("expected the mochi to be unavailable, got %+v", menuItem)
+	}
+
+	setProductAvailable(t, app, testProductMochi, true)
+	if menuItem := findMenuItem(t, app, testMenuItemMochi); !menuItem.Available || menuItem.DisabledReason != "" {
+		t.Fatalf("expected the mochi to be available with its product, got %+v", menuItem)
+	}
+
+	record, err := app.FindRecordById(model.MenuItemCollection, testMenuItemMochi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Set("disabled", true)
+	if err := app.Save(record); err != nil {
+		t.Fatal(err)
+	}
+	if menuItem := findMenuItem(t, app, testMenuItemMochi); menuItem.Available || menuItem.DisabledReason != menuItemDisabledReason {
+		t.Fatalf("expected the disabled mochi to be unavailable, got %+v", menuItem)
+	}
+
+	// running out of stock makes the product and with it the menu item unavailable
+	record.Set("disabled", false)
+	if err := app.Save(record); err != nil {
+		t.Fatal(err)
+	}
+	product, err := app.FindRecordById(model.ProductCollection, testProductMochi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	product.Set("track_stock", true)
+	product.Set("stock", 0)
+	if err := app.Save(product); err != nil {
+		t.Fatal(err)
+	}
+	if menuItem := findMenuItem(t, app, testMenuItemMochi); menuItem.Available {
+		t.Fatalf("expected the mochi out of stock to be unavailable, got %+v", menuItem)
+	}
+}
+
+func TestOrderItemsOfUnavailableMenuItemsAreRejected(t *testing.T) {
+	headers := authHeader(t)
+	body := `{"order":"hvfhh05zbr323h5","menu_item":"` + testMenuItemMochi + `","products":["` + testProductMochi + `"],"price":100,"status":"Aufgegeben"}`
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:            "order item of an unavailable menu item",
+			Method:          http.MethodPost,
+			URL:             "/api/collections/order_item/records",
+			Body:            strings.NewReader(body),
+			Headers:         headers,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{"validation_menu_item_unavailable", "Unavailable products: Nutella Mochi"},
+			TestAppFactory: func(t testing.TB) *tests.TestApp {
+				app := newScenarioTestApp(t)
+				setWaiterRole(t, app, model.RoleKellner)
+				return app
+			},
+		},
+		{
+			Name:            "order item of an available menu item",
+			Method:          http.MethodPost,
+			URL:             "/api/collections/order_item/records",
+			Body:            strings.NewReader(body),
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"menu_item":"` + testMenuItemMochi + `"`},
+			ExpectedEvents:  map[string]int{"OnRecordCreateRequest": 1},
+			TestAppFactory: func(t testing.TB) *tests.TestApp {
+				app := newScenarioTestApp(t)
+				setWaiterRole(t, app, model.RoleKellner)
+				setProductAvailable(t, app, testProductMochi, true)
+				return app
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
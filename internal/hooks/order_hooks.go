@@ -1,14 +1,16 @@
 package hooks
 
 import (
+	"context"
 	"fmt"
 	"github.com/pocketbase/dbx"
-	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+	"slices"
 )
 
 const (
-	orderTableName string = "order"
+	orderTableName string = model.OrderCollection
 )
 
 type orderStatus string
@@ -21,103 +23,171 @@ const (
 	orderStatusBezahlt     orderStatus = "Bezahlt"
 )
 
-func requiresOrderItemStatusUpdateCheck(status orderStatus) bool {
-	switch status {
-	case orderStatusAufgegeben,
-		orderStatusInArbeit,
-		orderStatusAbholbereit,
-		orderStatusGeliefert,
-		orderStatusBezahlt:
-		return true
-	default:
-		return false
+// UnpaidOrderStatuses returns the statuses of orders which are not paid yet.
+func UnpaidOrderStatuses() []string {
+	return []string{
+		string(orderStatusAufgegeben),
+		string(orderStatusInArbeit),
+		string(orderStatusAbholbereit),
+		string(orderStatusGeliefert),
+	}
+}
+
+// DeliveredOrderStatuses returns the statuses of orders which were served to the guests.
+func DeliveredOrderStatuses() []string {
+	return []string{
+		string(orderStatusGeliefert),
+		string(orderStatusBezahlt),
 	}
 }
 
-func mapOrderStatusToOrderItemStatus(orderStatus orderStatus) orderItemStatus {
+// orderStatuses lists all order statuses from the first to the last step.
+// They have to match the values of the "status" select field, see CheckStatusSchema.
+var orderStatuses = []orderStatus{
+	orderStatusAufgegeben,
+	orderStatusInArbeit,
+	orderStatusAbholbereit,
+	orderStatusGeliefert,
+	orderStatusBezahlt,
+}
+
+// parseOrderStatus returns the order status or an *InvalidStatusError for unknown values.
+func parseOrderStatus(status string) (orderStatus, error) {
+	if !slices.Contains(orderStatuses, orderStatus(status)) {
+		return "", &InvalidStatusError{Collection: orderTableName, Status: status}
+	}
+	return orderStatus(status), nil
+}
+
+func mapOrderStatusToOrderItemStatus(orderStatus orderStatus) (orderItemStatus, error) {
 	switch orderStatus {
 	case orderStatusAufgegeben:
-		return orderItemStatusAufgegeben
+		return orderItemStatusAufgegeben, nil
 	case orderStatusInArbeit:
-		return orderItemStatusInArbeit
+		return orderItemStatusInArbeit, nil
 	case orderStatusAbholbereit:
-		return orderItemStatusAbholbereit
+		return orderItemStatusAbholbereit, nil
 	case orderStatusGeliefert:
-		return orderItemStatusGeliefert
+		return orderItemStatusGeliefert, nil
 	case orderStatusBezahlt:
-		return orderItemStatusBezahlt
+		return orderItemStatusBezahlt, nil
 	default:
-		panic("invalid order status") // TODO remove panic for error propagation
+		return "", &InvalidStatusError{Collection: orderTableName, Status: string(orderStatus)}
 	}
 }
 
-func RegisterOrderHooks(app *pocketbase.PocketBase) {
+func RegisterOrderHooks(app core.App) {
+	app.OnRecordUpdateRequest(orderTableName).BindFunc(orderUpdateRequest)
+	app.OnRecordUpdateExecute(orderTableName).BindFunc(orderUpdateExecute)
 	app.OnRecordAfterCreateSuccess(orderTableName).BindFunc(orderAfterCreateSuccess)
 	app.OnRecordAfterUpdateSuccess(orderTableName).BindFunc(orderAfterUpdateSuccess)
 }
 
 func orderAfterCreateSuccess(orderRecordEvent *core.RecordEvent) error {
+	order := model.OrderFromRecord(orderRecordEvent.Record)
 	orderEvent := orderEvent{
-		OrderId: orderRecordEvent.Record.Get("id").(string),
-		Status:  orderStatus(orderRecordEvent.Record.Get("status").(string)),
+		OrderId: order.Id,
+		Status:  orderStatus(order.Status),
+	}
+	if err := constructEvent(orderEvent).save(orderRecordEvent.App); err != nil {
+		return err
 	}
-	return constructEvent(orderEvent).save(orderRecordEvent.App)
+	// continue with the other hooks, e.g. the order stream
+	return orderRecordEvent.Next()
 }
 
-func orderAfterUpdateSuccess(orderRecordEvent *core.RecordEvent) error {
-	oldStatus := orderStatus(orderRecordEvent.Record.Original().GetString("status"))
-	newStatus := orderStatus(orderRecordEvent.Record.GetString("status"))
+// orderUpdateExecute applies a status change of an order to its order items.
+// The cascade joins the transaction of the save, so for update requests (see orderUpdateRequest)
+// the order and its order items are either all updated or none.
+func orderUpdateExecute(orderRecordEvent *core.RecordEvent) error {
+	order := model.OrderFromRecord(orderRecordEvent.Record)
+	oldStatus := model.OrderFromRecord(orderRecordEvent.Record.Original()).Status
 
-	// If Status hasn't changed, no action is needed.
-	if oldStatus == newStatus {
+	if err := orderRecordEvent.Next(); err != nil {
+		return err
+	}
+
+	// Orders updated by the cascade of their order items already match them.
+	if order.Status == oldStatus || isStatusCascade(orderRecordEvent.Context) {
 		return nil
 	}
+	return orderRecordEvent.App.RunInTransaction(func(txApp core.App) error {
+		return cascadeOrderStatus(txApp, orderRecordEvent.Context, order)
+	})
+}
 
-	app := orderRecordEvent.App
-	orderEvent := orderEvent{
-		OrderId: orderRecordEvent.Record.Get("id").(string),
-		Status:  newStatus,
+// cascadeOrderStatus applies the new status of the order to its order items
+// e.g. if the order is in status "Geliefert" all order items are in status "Geliefert" as well.
+// Only changes orderItemStatusGraph allows are applied: paid order items stay paid, and only
+// payments mark order items paid. The order itself was checked against orderStatusGraph already.
+func cascadeOrderStatus(app core.App, ctx context.Context, order model.Order) error {
+	orderID := order.Id
+
+	status, err := parseOrderStatus(order.Status)
+	if err != nil {
+		app.Logger().Error(
+			fmt.Sprintf("Not updating the order items of order %s: %s", orderID, err),
+		)
+		return err
 	}
-	orderID := orderRecordEvent.Record.GetString("id")
-	status := orderStatus(orderRecordEvent.Record.GetString("status"))
+	newOrderItemStatus, err := mapOrderStatusToOrderItemStatus(status)
+	if err != nil {
+		return err
+	}
+
 	app.Logger().Info(
-		fmt.Sprintf("Order with id: %s changed to status %s ", orderID, status),
+		fmt.Sprintf("Updating order items stati because order %s changed into status %s", orderID, status),
 	)
-	// Create an event record for the order item Status change.
-	if err := constructEvent(orderEvent).save(orderRecordEvent.App); err != nil {
+	orderItems, err := app.FindRecordsByFilter(
+		orderItemTableName,
+		"order = {:OrderId}",
+		"",
+		0,
+		0,
+		dbx.Params{"OrderId": orderID},
+	)
+	if err != nil {
 		return err
 	}
-
-	// find the "order" the updated "order item" belongs to
-	// if all "order items" attached to that order are now in the same orderItemStatus set the order status to the equivilant status
-	// e.g. if all order items are in status "InArbeit" set the order status to the "InArbeit" status as well.
-	if requiresOrderItemStatusUpdateCheck(status) {
-		app.Logger().Info(
-			fmt.Sprintf("Updating order items stati because order %s changed into status %s", orderID, status),
-		)
-		orderItems, err := orderRecordEvent.App.FindRecordsByFilter(
-			orderItemTableName,
-			"order = {:OrderId}",
-			"",
-			0,
-			0,
-			dbx.Params{"OrderId": orderID},
-		)
-		if err != nil {
-			return err
+	for _, orderItem := range orderItems {
+		oldOrderItemStatus := orderItemStatus(orderItem.GetString("status"))
+		if newOrderItemStatus == orderItemStatusBezahlt ||
+			!orderItemStatusGraph.allowsForAnyRole(oldOrderItemStatus, newOrderItemStatus) {
+			continue
 		}
-		newOrderItemStatus := mapOrderStatusToOrderItemStatus(status)
-		for _, orderItem := range orderItems {
-			orderItem.Set("status", string(mapOrderItemStatusToOrderStatus(newOrderItemStatus)))
-			err := orderRecordEvent.App.Save(orderItem)
-			if err != nil {
-				app.Logger().Error(
-					fmt.Sprintf("failed to update order item with id: %s to status: %s", orderItem.Id, newOrderItemStatus),
-				)
-			}
+		orderItem.Set("status", string(newOrderItemStatus))
+		if err := app.SaveWithContext(withStatusCascade(ctx), orderItem); err != nil {
+			app.Logger().Error(
+				fmt.Sprintf("failed to update order item with id: %s to status: %s", orderItem.Id, newOrderItemStatus),
+			)
+			return fmt.Errorf("failed to update order item %s of order %s: %w", orderItem.Id, orderID, err)
 		}
-
 	}
 
 	return nil
 }
+
+func orderAfterUpdateSuccess(orderRecordEvent *core.RecordEvent) error {
+	order := model.OrderFromRecord(orderRecordEvent.Record)
+	oldStatus := orderStatus(model.OrderFromRecord(orderRecordEvent.Record.Original()).Status)
+	newStatus := orderStatus(order.Status)
+
+	// If Status hasn't changed, no event is needed.
+	if oldStatus == newStatus {
+		return orderRecordEvent.Next()
+	}
+
+	app := orderRecordEvent.App
+	orderEvent := orderEvent{
+		OrderId: order.Id,
+		Status:  newStatus,
+	}
+	app.Logger().Info(
+		fmt.Sprintf("Order with id: %s changed to status %s ", order.Id, newStatus),
+	)
+	// Create an event record for the order Status change.
+	if err := constructEvent(orderEvent).save(orderRecordEvent.App); err != nil {
+		return err
+	}
+	return orderRecordEvent.Next()
+}
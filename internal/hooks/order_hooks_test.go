@@ -0,0 +1,122 @@
+package hooks
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+func TestParseOrderStatus(t *testing.T) {
+	scenarios := []struct {
+		status string
+		valid  bool
+	}{
+		{"Aufgegeben", true},
+		{"InArbeit", true},
+		{"Abholbereit", true},
+		{"Geliefert", true},
+		{"Bezahlt", true},
+		{"", false},
+		{"bezahlt", false},
+		{" Bezahlt", false},
+		{"Kaputt", false},
+	}
+
+	for _, s := range scenarios {
+		orderStatus, orderErr := parseOrderStatus(s.status)
+		orderItemStatus, orderItemErr := parseOrderItemStatus(s.status)
+
+		if s.valid {
+			if orderErr != nil || string(orderStatus) != s.status {
+				t.Errorf("order status %q: expected to be valid, got %q, %v", s.status, orderStatus, orderErr)
+			}
+			if orderItemErr != nil || string(orderItemStatus) != s.status {
+				t.Errorf("order item status %q: expected to be valid, got %q, %v", s.status, orderItemStatus, orderItemErr)
+			}
+			continue
+		}
+
+		var invalidStatus *InvalidStatusError
+		if !errors.As(orderErr, &invalidStatus) || invalidStatus.Collection != orderTableName || invalidStatus.Status != s.status {
+			t.Errorf("order status %q: expected an InvalidStatusError, got %v", s.status, orderErr)
+		}
+		if !errors.As(orderItemErr, &invalidStatus) || invalidStatus.Collection != orderItemTableName || invalidStatus.Status != s.status {
+			t.Errorf("order item status %q: expected an InvalidStatusError, got %v", s.status, orderItemErr)
+		}
+	}
+}
+
+func TestStatusMappingRoundTrip(t *testing.T) {
+	for _, status := range orderItemStatuses {
+		orderStatus, err := mapOrderItemStatusToOrderStatus(status)
+		if err != nil {
+			t.Fatal(err)
+		}
+		back, err := mapOrderStatusToOrderItemStatus(orderStatus)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if back != status {
+			t.Errorf("expected %s to map back to itself, got %s", status, back)
+		}
+	}
+
+	var invalidStatus *InvalidStatusError
+	if _, err := mapOrderItemStatusToOrderStatus("Kaputt"); !errors.As(err, &invalidStatus) {
+		t.Errorf("expected an InvalidStatusError, got %v", err)
+	}
+	if _, err := mapOrderStatusToOrderItemStatus("Kaputt"); !errors.As(err, &invalidStatus) {
+		t.Errorf("expected an InvalidStatusError, got %v", err)
+	}
+}
+
+func TestMalformedOrderStatusFromRecord(t *testing.T) {
+	app := newTestApp(t)
+
+	// a status the select field would reject, e.g. written by a broken import
+	order, err := app.FindRecordById(model.OrderCollection, "b69u9kp1t9d71z5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	order.Set("status", "Kaputt")
+	err = app.SaveNoValidate(order)
+
+	var invalidStatus *InvalidStatusError
+	if !errors.As(err, &invalidStatus) || invalidStatus.Status != "Kaputt" {
+		t.Fatalf("expected an InvalidStatusError, got %v", err)
+	}
+
+	// the order items are left alone
+	orderItem, err := app.FindRecordById(model.OrderItemCollection, testOpenOrderItem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := orderItem.GetString("status"); status != "Aufgegeben" {
+		t.Errorf("expected the order item to stay Aufgegeben, got %s", status)
+	}
+}
+
+func TestMalformedOrderItemStatusFromRecord(t *testing.T) {
+	app := newTestApp(t)
+
+	orderItem, err := app.FindRecordById(model.OrderItemCollection, testOpenOrderItem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orderItem.Set("status", "")
+	err = app.SaveNoValidate(orderItem)
+
+	var invalidStatus *InvalidStatusError
+	if !errors.As(err, &invalidStatus) || invalidStatus.Collection != orderItemTableName {
+		t.Fatalf("expected an InvalidStatusError, got %v", err)
+	}
+
+	order, err := app.FindRecordById(model.OrderCollection, "b69u9kp1t9d71z5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := order.GetString("status"); status != "Aufgegeben" {
+		t.Errorf("expected the order to stay Aufgegeben, got %s", status)
+	}
+}
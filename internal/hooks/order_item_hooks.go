@@ -1,14 +1,16 @@
 package hooks
 
 import (
+	"context"
 	"fmt"
 	"github.com/pocketbase/dbx"
-	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+	"slices"
 )
 
 const (
-	orderItemTableName string = "order_item"
+	orderItemTableName string = model.OrderItemCollection
 )
 
 type orderItemStatus string
@@ -21,115 +23,192 @@ const (
 	orderItemStatusBezahlt     orderItemStatus = "Bezahlt"     //nolint:unused
 )
 
-func requiresOrderStatusUpdateCheck(status orderItemStatus) bool {
-	switch status {
-	case orderItemStatusAufgegeben,
-		orderItemStatusInArbeit,
-		orderItemStatusAbholbereit,
-		orderItemStatusGeliefert,
-		orderItemStatusBezahlt:
-		return true
-	default:
-		return false
+// OpenOrderItemStatuses returns the statuses of order items the kitchen still has to work on.
+func OpenOrderItemStatuses() []string {
+	return []string{
+		string(orderItemStatusAufgegeben),
+		string(orderItemStatusInArbeit),
 	}
 }
 
-func mapOrderItemStatusToOrderStatus(orderItemStatus orderItemStatus) orderStatus {
+// orderItemStatuses lists all order item statuses from the first to the last step.
+// They have to match the values of the "status" select field, see CheckStatusSchema.
+var orderItemStatuses = []orderItemStatus{
+	orderItemStatusAufgegeben,
+	orderItemStatusInArbeit,
+	orderItemStatusAbholbereit,
+	orderItemStatusGeliefert,
+	orderItemStatusBezahlt,
+}
+
+// parseOrderItemStatus returns the order item status or an *InvalidStatusError for unknown values.
+func parseOrderItemStatus(status string) (orderItemStatus, error) {
+	if !slices.Contains(orderItemStatuses, orderItemStatus(status)) {
+		return "", &InvalidStatusError{Collection: orderItemTableName, Status: status}
+	}
+	return orderItemStatus(status), nil
+}
+
+func mapOrderItemStatusToOrderStatus(orderItemStatus orderItemStatus) (orderStatus, error) {
 	switch orderItemStatus {
 	case orderItemStatusAufgegeben:
-		return orderStatusAufgegeben
+		return orderStatusAufgegeben, nil
 	case orderItemStatusInArbeit:
-		return orderStatusInArbeit
+		return orderStatusInArbeit, nil
 	case orderItemStatusAbholbereit:
-		return orderStatusAbholbereit
+		return orderStatusAbholbereit, nil
 	case orderItemStatusGeliefert:
-		return orderStatusGeliefert
+		return orderStatusGeliefert, nil
 	case orderItemStatusBezahlt:
-		return orderStatusBezahlt
+		return orderStatusBezahlt, nil
 	default:
-		panic("invalid order item status") // TODO remove panic for error propagation
+		return "", &InvalidStatusError{Collection: orderItemTableName, Status: string(orderItemStatus)}
 	}
 }
 
-func RegisterOrderItemHooks(app *pocketbase.PocketBase) {
+func RegisterOrderItemHooks(app core.App) {
+	app.OnRecordCreate(orderItemTableName).BindFunc(orderItemCreate)
+	app.OnRecordUpdate(orderItemTableName).BindFunc(orderItemUpdate)
+	app.OnRecordUpdateRequest(orderItemTableName).BindFunc(orderItemUpdateRequest)
+	app.OnRecordUpdateExecute(orderItemTableName).BindFunc(orderItemUpdateExecute)
 	app.OnRecordAfterCreateSuccess(orderItemTableName).BindFunc(orderItemAfterCreateSuccess)
 	app.OnRecordAfterUpdateSuccess(orderItemTableName).BindFunc(orderItemAfterUpdateSuccess)
+	app.OnRecordDeleteExecute(orderItemTableName).BindFunc(orderItemDeleteExecute)
 }
 
 func orderItemAfterCreateSuccess(orderItemRecordEvent *core.RecordEvent) error {
+	orderItem := model.OrderItemFromRecord(orderItemRecordEvent.Record)
 	orderItemEvent := orderItemEvent{
-		OrderItemId: orderItemRecordEvent.Record.Get("id").(string),
-		Status:      orderItemStatus(orderItemRecordEvent.Record.Get("status").(string)),
+		OrderItemId: orderItem.Id,
+		Status:      orderItemStatus(orderItem.Status),
 	}
 
-	return constructEvent(orderItemEvent).save(orderItemRecordEvent.App)
+	if err := constructEvent(orderItemEvent).save(orderItemRecordEvent.App); err != nil {
+		return err
+	}
+	// continue with the other hooks, e.g. the kitchen tickets
+	return orderItemRecordEvent.Next()
 }
 
 func orderItemAfterUpdateSuccess(orderItemRecordEvent *core.RecordEvent) error {
-	oldStatus := orderItemStatus(orderItemRecordEvent.Record.Original().GetString("status"))
-	newStatus := orderItemStatus(orderItemRecordEvent.Record.GetString("status"))
+	orderItem := model.OrderItemFromRecord(orderItemRecordEvent.Record)
+	oldStatus := orderItemStatus(model.OrderItemFromRecord(orderItemRecordEvent.Record.Original()).Status)
+	newStatus := orderItemStatus(orderItem.Status)
 
-	// If Status hasn't changed, no action is needed.
+	// If Status hasn't changed, no event is needed.
 	if oldStatus == newStatus {
-		return nil
+		return orderItemRecordEvent.Next()
 	}
-	return handleOrderItemStatusUpdate(orderItemRecordEvent)
-}
 
-func handleOrderItemStatusUpdate(orderItemRecordEvent *core.RecordEvent) error {
-	app := orderItemRecordEvent.App
 	orderItemEvent := orderItemEvent{
-		OrderItemId: orderItemRecordEvent.Record.Get("id").(string),
-		Status:      orderItemStatus(orderItemRecordEvent.Record.Get("status").(string)),
+		OrderItemId: orderItem.Id,
+		Status:      newStatus,
 	}
 	// Create an event record for the order item Status change.
 	if err := constructEvent(orderItemEvent).save(orderItemRecordEvent.App); err != nil {
 		return err
 	}
+	return orderItemRecordEvent.Next()
+}
+
+// orderItemDeleteExecute records the deleted order item as voided, like paymentDeleteExecute
+// in the transaction of the delete.
+func orderItemDeleteExecute(orderItemRecordEvent *core.RecordEvent) error {
+	if err := orderItemRecordEvent.Next(); err != nil {
+		return err
+	}
+
+	orderItem := model.OrderItemFromRecord(orderItemRecordEvent.Record)
+	orderItemEvent := orderItemEvent{
+		OrderItemId: orderItem.Id,
+		Status:      orderItemStatus(orderItem.Status),
+		Voided:      true,
+		MenuItem:    orderItem.MenuItem,
+		Price:       orderItem.Price,
+	}
+	return constructEvent(orderItemEvent).save(orderItemRecordEvent.App)
+}
+
+// orderItemUpdateExecute rolls a status change of an order item up to its order.
+// The cascade joins the transaction of the save, so for update requests (see orderItemUpdateRequest)
+// the order item and its order are either both updated or none.
+func orderItemUpdateExecute(orderItemRecordEvent *core.RecordEvent) error {
+	orderItem := model.OrderItemFromRecord(orderItemRecordEvent.Record)
+	oldStatus := model.OrderItemFromRecord(orderItemRecordEvent.Record.Original()).Status
+
+	if err := orderItemRecordEvent.Next(); err != nil {
+		return err
+	}
+
+	// Order items updated by the cascade of their order already match it.
+	if orderItem.Status == oldStatus || isStatusCascade(orderItemRecordEvent.Context) {
+		return nil
+	}
+	return orderItemRecordEvent.App.RunInTransaction(func(txApp core.App) error {
+		return cascadeOrderItemStatus(txApp, orderItemRecordEvent.Context, orderItem)
+	})
+}
+
+// cascadeOrderItemStatus updates the status of the order once all of its order items are in the same status.
+func cascadeOrderItemStatus(app core.App, ctx context.Context, orderItem model.OrderItem) error {
+
+	// For order items prepared by several stations the status is already the one of the slowest station,
+	// see syncStationStatus, so the order only follows once every station is done.
+	status, err := parseOrderItemStatus(orderItem.Status)
+	if err != nil {
+		app.Logger().Error(
+			fmt.Sprintf("Not updating the order of order item %s: %s", orderItem.Id, err),
+		)
+		return err
+	}
+	newOrderStatus, err := mapOrderItemStatusToOrderStatus(status)
+	if err != nil {
+		return err
+	}
 
-	status := orderItemStatus(orderItemRecordEvent.Record.GetString("status"))
 	// find the "order" the updated "order item" belongs to
 	// if all "order items" attached to that order are now in the same orderItemStatus set the order status to the equivilant status
 	// e.g. if all order items are in status "InArbeit" set the order status to the "InArbeit" status as well.
-	if requiresOrderStatusUpdateCheck(status) {
-		orderID := orderItemRecordEvent.Record.GetString("order")
-		orderItems, err := orderItemRecordEvent.App.FindRecordsByFilter(
-			orderItemTableName,
-			"order = {:OrderId}",
-			"",
-			0,
-			0,
-			dbx.Params{"OrderId": orderID},
+	orderID := orderItem.Order
+	orderItems, err := app.FindRecordsByFilter(
+		orderItemTableName,
+		"order = {:OrderId}",
+		"",
+		0,
+		0,
+		dbx.Params{"OrderId": orderID},
+	)
+	if err != nil {
+		return err
+	}
+	if !allOrderItemsHaveStatus(orderItems, orderItem.Status) {
+		return nil
+	}
+
+	order, err := app.FindRecordById(orderTableName, orderID)
+	if err != nil {
+		app.Logger().Error(
+			fmt.Sprintf("Failed to find order with id: %s", orderID),
 		)
-		if err != nil {
-			return err
-		}
-		if allOrderItemsHaveStatus(orderItems, orderItemRecordEvent.Record.GetString("status")) {
-			app.Logger().Info(
-				fmt.Sprintf("All order items of order (id: %s) are in status: %s ... Updating order status.", orderID, status),
-			)
-			order, err := orderItemRecordEvent.App.FindRecordById("order", orderID)
-			if err != nil {
-				app.Logger().Error(
-					fmt.Sprintf("Failed to find order with id: %s", orderID),
-				)
-				return err
-			}
-			order.Set("status", string(mapOrderItemStatusToOrderStatus(status)))
-			orderUpdateErr := orderItemRecordEvent.App.Save(order)
-			if orderUpdateErr != nil {
-				app.Logger().Error(
-					fmt.Sprintf("Failed to save order with id: %s", orderID),
-				)
-				return orderUpdateErr
-			}
-			app.Logger().Info(
-				fmt.Sprintf("Successfully updated order with id: %s to status: %s", orderID, status),
-			)
-
-			return nil
-		}
+		return err
+	}
+	if order.GetString("status") == string(newOrderStatus) {
+		return nil
+	}
+
+	app.Logger().Info(
+		fmt.Sprintf("All order items of order (id: %s) are in status: %s ... Updating order status.", orderID, status),
+	)
+	order.Set("status", string(newOrderStatus))
+	if err := app.SaveWithContext(withStatusCascade(ctx), order); err != nil {
+		app.Logger().Error(
+			fmt.Sprintf("Failed to save order with id: %s", orderID),
+		)
+		return fmt.Errorf("failed to update order %s: %w", orderID, err)
 	}
+	app.Logger().Info(
+		fmt.Sprintf("Successfully updated order with id: %s to status: %s", orderID, status),
+	)
 	return nil
 }
 
@@ -0,0 +1,134 @@
+package hooks
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// slowestStationStatus returns the least advanced status of all stations.
+func slowestStationStatus(stationStatus map[string]string) (orderItemStatus, error) {
+	slowest := -1
+	for station, status := range stationStatus {
+		parsed, err := parseOrderItemStatus(status)
+		if err != nil {
+			return "", validation.Errors{
+				"station_status": validation.NewError(
+					"validation_invalid_station_status",
+					fmt.Sprintf("station %s: %s", station, err),
+				),
+			}
+		}
+		progress := slices.Index(orderItemStatuses, parsed)
+		if slowest < 0 || progress < slowest {
+			slowest = progress
+		}
+	}
+	if slowest < 0 {
+		return "", fmt.Errorf("order item has no station status")
+	}
+	return orderItemStatuses[slowest], nil
+}
+
+// OrderItemStations returns the ids of the stations preparing the products of the order item.
+// Order items without products are prepared by the station of their menu item.
+func OrderItemStations(app core.App, orderItem model.OrderItem) ([]string, error) {
+	menuItemRecord, err := app.FindRecordById(model.MenuItemCollection, orderItem.MenuItem)
+	if err != nil {
+		return nil, err
+	}
+	menuItem := model.MenuItemFromRecord(menuItemRecord)
+
+	if len(orderItem.Products) == 0 {
+		if menuItem.Station == "" {
+			return nil, nil
+		}
+		return []string{menuItem.Station}, nil
+	}
+
+	productRecords, err := app.FindRecordsByIds(model.ProductCollection, orderItem.Products)
+	if err != nil {
+		return nil, err
+	}
+	stations := []string{}
+	for _, productRecord := range productRecords {
+		station := model.ProductStation(model.ProductFromRecord(productRecord), menuItem)
+		if station != "" && !slices.Contains(stations, station) {
+			stations = append(stations, station)
+		}
+	}
+	return stations, nil
+}
+
+func orderItemCreate(orderItemRecordEvent *core.RecordEvent) error {
+	if err := syncStationStatus(orderItemRecordEvent.App, orderItemRecordEvent.Record); err != nil {
+		return err
+	}
+	if err := validateOrderItemPaid(orderItemRecordEvent.Context, orderItemRecordEvent.Record); err != nil {
+		return err
+	}
+	return orderItemRecordEvent.Next()
+}
+
+func orderItemUpdate(orderItemRecordEvent *core.RecordEvent) error {
+	if err := syncStationStatus(orderItemRecordEvent.App, orderItemRecordEvent.Record); err != nil {
+		return err
+	}
+	if err := validateOrderItemPaid(orderItemRecordEvent.Context, orderItemRecordEvent.Record); err != nil {
+		return err
+	}
+	return orderItemRecordEvent.Next()
+}
+
+// syncStationStatus keeps "status" and "station_status" of an order item record consistent before it is saved:
+//   - new order items and order items with changed products or station status get an entry for every
+//     involved station, stations already known keep their status and other stations are dropped.
+//     This also covers order items created before stations tracked their progress.
+//   - a changed status of the order item itself (e.g. delivered by the waiter) is taken over by all stations
+//   - otherwise the status of the order item is the one of the slowest station
+func syncStationStatus(app core.App, record *core.Record) error {
+	orderItem := model.OrderItemFromRecord(record)
+	original := model.OrderItem{}
+	if !record.IsNew() {
+		original = model.OrderItemFromRecord(record.Original())
+	}
+	statusChanged := orderItem.Status != original.Status
+	stationStatusChanged := !maps.Equal(orderItem.StationStatus, original.StationStatus)
+	productsChanged := orderItem.MenuItem != original.MenuItem || !slices.Equal(orderItem.Products, original.Products)
+
+	stationStatus := maps.Clone(orderItem.StationStatus)
+	if len(stationStatus) == 0 || productsChanged || stationStatusChanged {
+		stations, err := OrderItemStations(app, orderItem)
+		if err != nil {
+			return err
+		}
+		initialized := make(map[string]string, len(stations))
+		for _, station := range stations {
+			if status, ok := stationStatus[station]; ok {
+				initialized[station] = status
+			} else {
+				initialized[station] = orderItem.Status
+			}
+		}
+		stationStatus = initialized
+	}
+
+	if statusChanged && !stationStatusChanged {
+		for station := range stationStatus {
+			stationStatus[station] = orderItem.Status
+		}
+	} else if len(stationStatus) > 0 {
+		status, err := slowestStationStatus(stationStatus)
+		if err != nil {
+			return err
+		}
+		record.Set("status", string(status))
+	}
+
+	record.Set("station_status", stationStatus)
+	return nil
+}
@@ -0,0 +1,124 @@
+package hooks
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+func TestOrderItemStatusFollowsSlowestStation(t *testing.T) {
+	app := newTestApp(t)
+
+	// the crepe is prepared at the drinks station, the mochi at the station of the menu item
+	crepe, err := app.FindRecordById(model.ProductCollection, testProductCrepe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crepe.Set("station", testStationDrinks)
+	if err := app.Save(crepe); err != nil {
+		t.Fatal(err)
+	}
+
+	order := saveNewRecord(t, app, model.OrderCollection, map[string]any{
+		"table":  1,
+		"waiter": testWaiter,
+		"status": "Aufgegeben",
+		"person": 1,
+	})
+	orderItemRecord := saveNewRecord(t, app, model.OrderItemCollection, map[string]any{
+		"order":     order.Id,
+		"price":     5,
+		"status":    "Aufgegeben",
+		"menu_item": testMenuItemMochi,
+		"products":  []string{testProductMochi, testProductCrepe},
+	})
+
+	expected := map[string]string{testStationMochi: "Aufgegeben", testStationDrinks: "Aufgegeben"}
+	if got := model.OrderItemFromRecord(reload(t, app, orderItemRecord)).StationStatus; !maps.Equal(got, expected) {
+		t.Fatalf("expected station status %v, got %v", expected, got)
+	}
+
+	steps := []struct {
+		station             string
+		status              string
+		expectedItemStatus  string
+		expectedOrderStatus string
+	}{
+		{testStationMochi, "Abholbereit", "Aufgegeben", "Aufgegeben"},
+		{testStationDrinks, "InArbeit", "InArbeit", "InArbeit"},
+		{testStationDrinks, "Abholbereit", "Abholbereit", "Abholbereit"},
+	}
+	for _, step := range steps {
+		record := reload(t, app, orderItemRecord)
+		stationStatus := model.OrderItemFromRecord(record).StationStatus
+		stationStatus[step.station] = step.status
+		record.Set("station_status", stationStatus)
+		if err := app.Save(record); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := reload(t, app, orderItemRecord).GetString("status"); got != step.expectedItemStatus {
+			t.Errorf("%s -> %s: expected order item status %s, got %s", step.station, step.status, step.expectedItemStatus, got)
+		}
+		if got := reload(t, app, order).GetString("status"); got != step.expectedOrderStatus {
+			t.Errorf("%s -> %s: expected order status %s, got %s", step.station, step.status, step.expectedOrderStatus, got)
+		}
+	}
+
+	// a status set on the order item itself applies to every station
+	record := reload(t, app, orderItemRecord)
+	record.Set("status", "Geliefert")
+	if err := app.Save(record); err != nil {
+		t.Fatal(err)
+	}
+	expected = map[string]string{testStationMochi: "Geliefert", testStationDrinks: "Geliefert"}
+	if got := model.OrderItemFromRecord(reload(t, app, orderItemRecord)).StationStatus; !maps.Equal(got, expected) {
+		t.Errorf("expected station status %v, got %v", expected, got)
+	}
+
+	// stations not preparing any product of the order item are dropped
+	record = reload(t, app, orderItemRecord)
+	record.Set("station_status", map[string]string{testStationMochi: "Geliefert", testStationDrinks: "Geliefert", "unknown": "Aufgegeben"})
+	if err := app.Save(record); err != nil {
+		t.Fatal(err)
+	}
+	if got := model.OrderItemFromRecord(reload(t, app, orderItemRecord)).StationStatus; !maps.Equal(got, expected) {
+		t.Errorf("expected station status %v, got %v", expected, got)
+	}
+}
+
+func TestOrderItemStationStatusIsValidated(t *testing.T) {
+	app := newTestApp(t)
+
+	record, err := app.FindRecordById(model.OrderItemCollection, testOpenOrderItem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Set("station_status", map[string]string{testStationMochi: "Kaputt"})
+	if err := app.Save(record); err == nil {
+		t.Fatal("expected an error for an invalid station status")
+	}
+}
+
+func TestOrderItemStationStatusIsInitializedForExistingOrderItems(t *testing.T) {
+	app := newTestApp(t)
+
+	record, err := app.FindRecordById(model.OrderItemCollection, testOpenOrderItem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(model.OrderItemFromRecord(record).StationStatus) != 0 {
+		t.Fatal("expected the test data to have no station status")
+	}
+
+	record.Set("notes", "ohne Sahne")
+	if err := app.Save(record); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{testStationMochi: "Aufgegeben"}
+	if got := model.OrderItemFromRecord(reload(t, app, record)).StationStatus; !maps.Equal(got, expected) {
+		t.Errorf("expected station status %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,303 @@
+package hooks
+
+import (
+	"context"
+	"slices"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+type orderAction string
+
+const (
+	orderActionTransferred orderAction = "transferred"
+	// orderActionMerged is recorded for the order the other one was merged into,
+	// orderActionMergedInto for the merged order, which is deleted afterwards.
+	orderActionMerged     orderAction = "merged"
+	orderActionMergedInto orderAction = "merged_into"
+	// orderActionSplitOff is recorded for the order order items were split off,
+	// orderActionSplitFrom for the new order holding them.
+	orderActionSplitOff  orderAction = "split_off"
+	orderActionSplitFrom orderAction = "split_from"
+)
+
+// TransferOrder moves the unpaid order to the table with the number.
+// Tables with unpaid orders of another waiter are rejected, their waiter serves the table.
+func TransferOrder(app core.App, ctx context.Context, orderId string, table float64) (model.Order, error) {
+	var order model.Order
+	err := app.RunInTransaction(func(txApp core.App) error {
+		record, err := findUnpaidOrder(txApp, "id", orderId)
+		if err != nil {
+			return err
+		}
+		fromTable := record.GetFloat("table")
+		if fromTable == table {
+			return validation.Errors{
+				"table": validation.NewError("validation_same_table", "The order is at this table already"),
+			}
+		}
+		if err := validateTableWaiter(txApp, table, record.GetString("waiter")); err != nil {
+			return err
+		}
+
+		// the table hooks reject unknown tables
+		record.Set("table", table)
+		if err := txApp.SaveWithContext(ctx, record); err != nil {
+			return err
+		}
+		order = model.OrderFromRecord(record)
+
+		return constructEvent(orderEvent{
+			OrderId:   order.Id,
+			Status:    orderStatus(order.Status),
+			Action:    orderActionTransferred,
+			FromTable: fromTable,
+			Table:     order.Table,
+		}).save(txApp)
+	})
+	return order, err
+}
+
+// MergeOrders moves the order items, kitchen tickets and guests of the unpaid order mergedId into
+// the unpaid order orderId and deletes the merged order. The order follows the status of its order items,
+// e.g. a delivered order is not delivered anymore once new order items are merged into it.
+func MergeOrders(app core.App, ctx context.Context, orderId, mergedId string) (model.Order, error) {
+	var order model.Order
+	err := app.RunInTransaction(func(txApp core.App) error {
+		if orderId == mergedId {
+			return validation.Errors{
+				"order": validation.NewError("validation_same_order", "An order cannot be merged into itself"),
+			}
+		}
+		record, err := findUnpaidOrder(txApp, "id", orderId)
+		if err != nil {
+			return err
+		}
+		mergedRecord, err := findUnpaidOrder(txApp, "order", mergedId)
+		if err != nil {
+			return err
+		}
+
+		orderItems, err := txApp.FindAllRecords(orderItemTableName, dbx.HashExp{"order": mergedId})
+		if err != nil {
+			return err
+		}
+		orderItemIds := make([]string, len(orderItems))
+		for i, orderItem := range orderItems {
+			orderItem.Set("order", orderId)
+			if err := txApp.SaveWithContext(ctx, orderItem); err != nil {
+				return err
+			}
+			orderItemIds[i] = orderItem.Id
+		}
+		// kitchen tickets would be deleted together with the merged order
+		printJobs, err := txApp.FindAllRecords(printJobTableName, dbx.HashExp{"order": mergedId})
+		if err != nil {
+			return err
+		}
+		for _, printJob := range printJobs {
+			printJob.Set("order", orderId)
+			if err := txApp.SaveWithContext(ctx, printJob); err != nil {
+				return err
+			}
+		}
+
+		record.Set("person", record.GetInt("person")+mergedRecord.GetInt("person"))
+		if err := txApp.SaveWithContext(ctx, record); err != nil {
+			return err
+		}
+		if err := syncOrderStatus(txApp, ctx, record); err != nil {
+			return err
+		}
+		order = model.OrderFromRecord(record)
+
+		merged := model.OrderFromRecord(mergedRecord)
+		err = constructEvent(orderEvent{
+			OrderId:    merged.Id,
+			Status:     orderStatus(merged.Status),
+			Action:     orderActionMergedInto,
+			OtherOrder: order.Id,
+			OrderItems: orderItemIds,
+		}).save(txApp)
+		if err != nil {
+			return err
+		}
+		err = constructEvent(orderEvent{
+			OrderId:    order.Id,
+			Status:     orderStatus(order.Status),
+			Action:     orderActionMerged,
+			OtherOrder: merged.Id,
+			OrderItems: orderItemIds,
+		}).save(txApp)
+		if err != nil {
+			return err
+		}
+
+		return txApp.DeleteWithContext(ctx, mergedRecord)
+	})
+	return order, err
+}
+
+// SplitOrder moves some of the order items of the unpaid order into a new order of the same waiter for
+// the number of guests at the table with the number, or the table of the order if it is 0.
+// The guests of the order are reduced by the guests of the new order, but not below one.
+// Both orders follow the status of their order items. Like transfers, splits to tables with unpaid orders
+// of another waiter are rejected.
+func SplitOrder(app core.App, ctx context.Context, orderId string, orderItemIds []string, table float64, person int) (model.Order, error) {
+	var newOrder model.Order
+	err := app.RunInTransaction(func(txApp core.App) error {
+		record, err := findUnpaidOrder(txApp, "id", orderId)
+		if err != nil {
+			return err
+		}
+
+		orderItems, err := txApp.FindAllRecords(orderItemTableName, dbx.HashExp{"order": orderId})
+		if err != nil {
+			return err
+		}
+		var moved []*core.Record
+		for _, orderItem := range orderItems {
+			if slices.Contains(orderItemIds, orderItem.Id) {
+				moved = append(moved, orderItem)
+			}
+		}
+		switch {
+		case len(orderItemIds) == 0 || len(moved) != len(orderItemIds):
+			return validation.Errors{
+				"order_items": validation.NewError("validation_invalid_order_items", "The order items have to be part of the order"),
+			}
+		case len(moved) == len(orderItems):
+			return validation.Errors{
+				"order_items": validation.NewError("validation_invalid_order_items", "At least one order item has to stay in the order"),
+			}
+		}
+
+		if table == 0 {
+			table = record.GetFloat("table")
+		} else if table != record.GetFloat("table") {
+			if err := validateTableWaiter(txApp, table, record.GetString("waiter")); err != nil {
+				return err
+			}
+		}
+		person = max(person, 1)
+		newRecord := core.NewRecord(record.Collection())
+		newRecord.Set("table", table)
+		newRecord.Set("waiter", record.GetString("waiter"))
+		newRecord.Set("status", record.GetString("status"))
+		newRecord.Set("person", person)
+		if err := txApp.SaveWithContext(ctx, newRecord); err != nil {
+			return err
+		}
+
+		movedIds := make([]string, len(moved))
+		for i, orderItem := range moved {
+			orderItem.Set("order", newRecord.Id)
+			if err := txApp.SaveWithContext(ctx, orderItem); err != nil {
+				return err
+			}
+			movedIds[i] = orderItem.Id
+		}
+
+		record.Set("person", max(record.GetInt("person")-person, 1))
+		if err := txApp.SaveWithContext(ctx, record); err != nil {
+			return err
+		}
+		if err := syncOrderStatus(txApp, ctx, record); err != nil {
+			return err
+		}
+		if err := syncOrderStatus(txApp, ctx, newRecord); err != nil {
+			return err
+		}
+		order := model.OrderFromRecord(record)
+		newOrder = model.OrderFromRecord(newRecord)
+
+		err = constructEvent(orderEvent{
+			OrderId:    order.Id,
+			Status:     orderStatus(order.Status),
+			Action:     orderActionSplitOff,
+			OtherOrder: newOrder.Id,
+			OrderItems: movedIds,
+		}).save(txApp)
+		if err != nil {
+			return err
+		}
+		return constructEvent(orderEvent{
+			OrderId:    newOrder.Id,
+			Status:     orderStatus(newOrder.Status),
+			Action:     orderActionSplitFrom,
+			Table:      newOrder.Table,
+			OtherOrder: order.Id,
+			OrderItems: movedIds,
+		}).save(txApp)
+	})
+	return newOrder, err
+}
+
+// findUnpaidOrder returns the order, failing with a validation error for the field if it is unknown or paid.
+func findUnpaidOrder(app core.App, field, orderId string) (*core.Record, error) {
+	record, err := app.FindRecordById(orderTableName, orderId)
+	if err != nil {
+		return nil, validation.Errors{
+			field: validation.NewError("validation_unknown_order", "The order does not exist"),
+		}
+	}
+	if record.GetString("status") == string(orderStatusBezahlt) {
+		return nil, validation.Errors{
+			field: validation.NewError("validation_order_paid", "The order is paid already"),
+		}
+	}
+	return record, nil
+}
+
+// validateTableWaiter rejects moving orders of the waiter to a table with unpaid orders of another waiter.
+func validateTableWaiter(app core.App, table float64, waiter string) error {
+	statuses := []any{}
+	for _, status := range UnpaidOrderStatuses() {
+		statuses = append(statuses, status)
+	}
+	var count int
+	err := app.RecordQuery(orderTableName).
+		Select("count(*)").
+		AndWhere(dbx.HashExp{"table": table}).
+		AndWhere(dbx.Not(dbx.HashExp{"waiter": waiter})).
+		AndWhere(dbx.In("status", statuses...)).
+		Row(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return validation.Errors{
+			"table": validation.NewError("validation_table_taken", "The table has unpaid orders of another waiter"),
+		}
+	}
+	return nil
+}
+
+// syncOrderStatus sets the status of the order to the least advanced status of its order items,
+// as moving order items between orders can leave an order ahead of them.
+// Like a status cascade, the order items are not changed.
+func syncOrderStatus(app core.App, ctx context.Context, record *core.Record) error {
+	orderItems, err := app.FindAllRecords(orderItemTableName, dbx.HashExp{"order": record.Id})
+	if err != nil || len(orderItems) == 0 {
+		return err
+	}
+
+	least := len(orderItemStatuses) - 1
+	for _, orderItem := range orderItems {
+		if i := slices.Index(orderItemStatuses, orderItemStatus(orderItem.GetString("status"))); i >= 0 {
+			least = min(least, i)
+		}
+	}
+	status, err := mapOrderItemStatusToOrderStatus(orderItemStatuses[least])
+	if err != nil {
+		return err
+	}
+	if record.GetString("status") == string(status) {
+		return nil
+	}
+	record.Set("status", string(status))
+	return app.SaveWithContext(withStatusCascade(ctx), record)
+}
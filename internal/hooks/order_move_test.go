@@ -0,0 +1,203 @@
+package hooks
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+const (
+	// testCrepeOrder is the open order at table 13 with a single crepe.
+	testCrepeOrder     = "7c9314h8rh8469g"
+	testCrepeOrderItem = "44tv6363beu9q34"
+)
+
+// orderMoveEvent returns the content of the order event with the action of the order.
+func orderMoveEvent(tb testing.TB, app core.App, orderId string, action orderAction) map[string]any {
+	tb.Helper()
+	record, err := app.FindFirstRecordByFilter(
+		eventTableName,
+		"type = {:type} && content.order_id = {:order} && content.action = {:action}",
+		dbx.Params{"type": string(orderEventType), "order": orderId, "action": string(action)},
+	)
+	if err != nil {
+		tb.Fatalf("no %s event for order %s: %v", action, orderId, err)
+	}
+	var content map[string]any
+	if err := record.UnmarshalJSONField("content", &content); err != nil {
+		tb.Fatal(err)
+	}
+	return content
+}
+
+// orderItemsOf returns the ids of the order items of the order.
+func orderItemsOf(tb testing.TB, app core.App, orderId string) []string {
+	tb.Helper()
+	records, err := app.FindAllRecords(model.OrderItemCollection, dbx.HashExp{"order": orderId})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	ids := make([]string, len(records))
+	for i, record := range records {
+		ids[i] = record.Id
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestTransferOrder(t *testing.T) {
+	app := newTestApp(t)
+
+	terrace := saveNewRecord(t, app, model.TableCollection, map[string]any{"number": 20})
+
+	order, err := TransferOrder(app, context.Background(), testCrepeOrder, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Table != 20 || order.DiningTable != terrace.Id {
+		t.Errorf("expected the order to be at table 20, got %+v", order)
+	}
+	event := orderMoveEvent(t, app, testCrepeOrder, orderActionTransferred)
+	if event["from_table"] != 13.0 || event["table"] != 20.0 || event["status"] != "Aufgegeben" {
+		t.Errorf("unexpected event %v", event)
+	}
+
+	_, err = TransferOrder(app, context.Background(), testCrepeOrder, 20)
+	assertValidationCode(t, err, "table", "validation_same_table")
+	// table 1 is served by the waiter of the delivered orders
+	_, err = TransferOrder(app, context.Background(), testCrepeOrder, 1)
+	assertValidationCode(t, err, "table", "validation_table_taken")
+	_, err = TransferOrder(app, context.Background(), testCrepeOrder, 99)
+	assertValidationCode(t, err, "table", "validation_unknown_table")
+
+	// paid orders stay where they were paid
+	_, err = app.DB().Update(model.OrderCollection, dbx.Params{"status": "Bezahlt"}, dbx.HashExp{"id": testCrepeOrder}).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = TransferOrder(app, context.Background(), testCrepeOrder, 13)
+	assertValidationCode(t, err, "id", "validation_order_paid")
+}
+
+func TestMergeOrders(t *testing.T) {
+	app := newTestApp(t)
+	printJob := saveNewRecord(t, app, model.PrintJobCollection, map[string]any{
+		"station":     testStationMochi,
+		"order":       testCrepeOrder,
+		"order_items": []string{testCrepeOrderItem},
+		"status":      model.PrintJobPending,
+	})
+	delivered := orderItemsOf(t, app, testDeliveredOrder)
+
+	// the new crepe is not delivered yet, so neither is the order anymore
+	order, err := MergeOrders(app, context.Background(), testDeliveredOrder, testCrepeOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != "Aufgegeben" {
+		t.Errorf("expected the merged order to follow its order items, got %s", order.Status)
+	}
+	expected := slices.Sorted(slices.Values(append(delivered, testCrepeOrderItem)))
+	if got := orderItemsOf(t, app, testDeliveredOrder); !slices.Equal(got, expected) {
+		t.Errorf("expected the order items %v, got %v", expected, got)
+	}
+	crepe, err := app.FindRecordById(model.OrderItemCollection, testCrepeOrderItem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := crepe.GetString("status"); got != "Aufgegeben" {
+		t.Errorf("expected the merged order item to keep its status, got %s", got)
+	}
+	if got := reload(t, app, printJob).GetString("order"); got != testDeliveredOrder {
+		t.Errorf("expected the kitchen ticket to be moved, got order %s", got)
+	}
+	if _, err := app.FindRecordById(model.OrderCollection, testCrepeOrder); err == nil {
+		t.Error("expected the merged order to be deleted")
+	}
+
+	event := orderMoveEvent(t, app, testDeliveredOrder, orderActionMerged)
+	if event["other_order"] != testCrepeOrder || len(event["order_items"].([]any)) != 1 {
+		t.Errorf("unexpected event %v", event)
+	}
+	event = orderMoveEvent(t, app, testCrepeOrder, orderActionMergedInto)
+	if event["other_order"] != testDeliveredOrder {
+		t.Errorf("unexpected event %v", event)
+	}
+
+	_, err = MergeOrders(app, context.Background(), testDeliveredOrder, testDeliveredOrder)
+	assertValidationCode(t, err, "order", "validation_same_order")
+	_, err = MergeOrders(app, context.Background(), testDeliveredOrder, testCrepeOrder)
+	assertValidationCode(t, err, "order", "validation_unknown_order")
+}
+
+func TestSplitOrder(t *testing.T) {
+	app := newTestApp(t)
+	crepes := []string{"rt0a00ca3sha5b8", "virgkh8idg27vfo"}
+
+	saveNewRecord(t, app, model.TableCollection, map[string]any{"number": 20})
+
+	newOrder, err := SplitOrder(app, context.Background(), testDeliveredOrder, crepes, 20, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newOrder.Table != 20 || newOrder.Person != 2 || newOrder.Status != "Geliefert" || newOrder.Waiter != "u805e7e223v6521" {
+		t.Errorf("unexpected new order %+v", newOrder)
+	}
+	if got := orderItemsOf(t, app, newOrder.Id); !slices.Equal(got, crepes) {
+		t.Errorf("expected the crepes in the new order, got %v", got)
+	}
+	if got := orderItemsOf(t, app, testDeliveredOrder); len(got) != 3 {
+		t.Errorf("expected the mochis to stay, got %v", got)
+	}
+
+	event := orderMoveEvent(t, app, testDeliveredOrder, orderActionSplitOff)
+	if event["other_order"] != newOrder.Id || len(event["order_items"].([]any)) != 2 {
+		t.Errorf("unexpected event %v", event)
+	}
+	event = orderMoveEvent(t, app, newOrder.Id, orderActionSplitFrom)
+	if event["other_order"] != testDeliveredOrder || event["table"] != 20.0 {
+		t.Errorf("unexpected event %v", event)
+	}
+
+	_, err = SplitOrder(app, context.Background(), testDeliveredOrder, orderItemsOf(t, app, testDeliveredOrder), 0, 1)
+	assertValidationCode(t, err, "order_items", "validation_invalid_order_items")
+	_, err = SplitOrder(app, context.Background(), testDeliveredOrder, []string{testCrepeOrderItem}, 0, 1)
+	assertValidationCode(t, err, "order_items", "validation_invalid_order_items")
+
+	// nothing is split off for an unknown table or a table of another waiter
+	mochi := orderItemsOf(t, app, testDeliveredOrder)[:1]
+	_, err = SplitOrder(app, context.Background(), testDeliveredOrder, mochi, 99, 1)
+	assertValidationCode(t, err, "table", "validation_unknown_table")
+	_, err = SplitOrder(app, context.Background(), testDeliveredOrder, mochi, 13, 1)
+	assertValidationCode(t, err, "table", "validation_table_taken")
+	if got := orderItemsOf(t, app, testDeliveredOrder); len(got) != 3 {
+		t.Errorf("expected the order items to stay, got %v", got)
+	}
+}
+
+func TestOrderMovesSaveWithTheContextOfTheCaller(t *testing.T) {
+	app := newTestApp(t)
+	type callerKey struct{}
+	ctx := context.WithValue(context.Background(), callerKey{}, "caller")
+
+	var saves, withCaller int
+	app.OnRecordUpdate(model.OrderCollection).BindFunc(func(e *core.RecordEvent) error {
+		saves++
+		if e.Context.Value(callerKey{}) == "caller" {
+			withCaller++
+		}
+		return e.Next()
+	})
+
+	// merging a new order item into the delivered order sets it back with a status cascade
+	if _, err := MergeOrders(app, ctx, testDeliveredOrder, testCrepeOrder); err != nil {
+		t.Fatal(err)
+	}
+	if saves == 0 || withCaller != saves {
+		t.Errorf("expected all %d saves of orders with the context of the caller, got %d", saves, withCaller)
+	}
+}
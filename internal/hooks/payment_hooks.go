@@ -0,0 +1,306 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+const (
+	paymentTableName string = model.PaymentCollection
+)
+
+type paymentAction string
+
+const (
+	paymentActionCreated paymentAction = "created"
+	paymentActionUpdated paymentAction = "updated"
+	paymentActionDeleted paymentAction = "deleted"
+)
+
+// PaymentDeletedAction is the action of the event saved for a deleted payment.
+const PaymentDeletedAction = string(paymentActionDeleted)
+
+// paymentKey marks the context of saving the order items covered by a payment,
+// the only saves which may move an order item to "Bezahlt".
+type paymentKey struct{}
+
+// withPayment returns a context for saving an order item paid by the payment.
+func withPayment(ctx context.Context, payment string) context.Context {
+	return context.WithValue(ctx, paymentKey{}, payment)
+}
+
+// savedByPayment returns the payment paying the saved order item, if any.
+func savedByPayment(ctx context.Context) string {
+	payment, _ := ctx.Value(paymentKey{}).(string)
+	return payment
+}
+
+func RegisterPaymentHooks(app core.App) {
+	app.OnRecordCreate(paymentTableName).BindFunc(paymentValidate)
+	app.OnRecordUpdate(paymentTableName).BindFunc(paymentValidate)
+	app.OnRecordCreateRequest(paymentTableName).BindFunc(runRequestInTransaction)
+	app.OnRecordUpdateRequest(paymentTableName).BindFunc(runRequestInTransaction)
+	app.OnRecordCreateExecute(paymentTableName).BindFunc(paymentSaveExecute)
+	app.OnRecordUpdateExecute(paymentTableName).BindFunc(paymentSaveExecute)
+	app.OnRecordAfterCreateSuccess(paymentTableName).BindFunc(paymentAfterCreateSuccess)
+	app.OnRecordAfterUpdateSuccess(paymentTableName).BindFunc(paymentAfterUpdateSuccess)
+	app.OnRecordDeleteExecute(paymentTableName).BindFunc(paymentDeleteExecute)
+}
+
+func newPaymentEvent(payment model.Payment, action paymentAction) paymentEvent {
+	return paymentEvent{
+		PaymentId:       payment.Id,
+		Action:          action,
+		SubtotalAmount:  payment.SubtotalAmount,
+		DiscountAmount:  payment.DiscountAmount,
+		TotalAmount:     payment.TotalAmount,
+		TipAmount:       payment.TipAmount,
+		DiscountPercent: payment.DiscountPercent,
+		PaymentOption:   payment.PaymentOption,
+		OrderItems:      payment.OrderItems,
+	}
+}
+
+func paymentAfterCreateSuccess(paymentRecordEvent *core.RecordEvent) error {
+	payment := model.PaymentFromRecord(paymentRecordEvent.Record)
+	if err := constructEvent(newPaymentEvent(payment, paymentActionCreated)).save(paymentRecordEvent.App); err != nil {
+		return err
+	}
+	return paymentRecordEvent.Next()
+}
+
+func paymentAfterUpdateSuccess(paymentRecordEvent *core.RecordEvent) error {
+	payment := model.PaymentFromRecord(paymentRecordEvent.Record)
+	if err := constructEvent(newPaymentEvent(payment, paymentActionUpdated)).save(paymentRecordEvent.App); err != nil {
+		return err
+	}
+	return paymentRecordEvent.Next()
+}
+
+// paymentDeleteExecute moves the order items of the deleted payment back to "Geliefert" (see markOrderItemsUnpaid)
+// and saves the event in the transaction PocketBase runs the delete in.
+// After the delete that transaction is already committed, but it is still the app of the after delete hooks.
+func paymentDeleteExecute(paymentRecordEvent *core.RecordEvent) error {
+	if err := paymentRecordEvent.Next(); err != nil {
+		return err
+	}
+
+	payment := model.PaymentFromRecord(paymentRecordEvent.Record)
+	if err := markOrderItemsUnpaid(paymentRecordEvent.App, paymentRecordEvent.Context, payment.OrderItems); err != nil {
+		return err
+	}
+	return constructEvent(newPaymentEvent(payment, paymentActionDeleted)).save(paymentRecordEvent.App)
+}
+
+// paymentValidate rejects payments covering order items which are already covered by another payment
+// and calculates the total of the payment, see applyPaymentBreakdown. Cash payments are attached to a cash session.
+// It runs in the transaction of the save, so concurrent payments cannot both cover the same order item.
+func paymentValidate(paymentRecordEvent *core.RecordEvent) error {
+	payment := model.PaymentFromRecord(paymentRecordEvent.Record)
+	payments, err := OrderItemPayments(paymentRecordEvent.App, payment.OrderItems)
+	if err != nil {
+		return err
+	}
+
+	for _, orderItem := range payment.OrderItems {
+		if paymentId, ok := payments[orderItem]; ok && paymentId != payment.Id {
+			return validation.Errors{
+				"order_items": validation.NewError(
+					"validation_order_item_already_paid",
+					fmt.Sprintf("Order item %s is already paid by payment %s", orderItem, paymentId),
+				),
+			}
+		}
+	}
+
+	if err := validatePaymentOrder(paymentRecordEvent.App, payment); err != nil {
+		return err
+	}
+	if err := applyPaymentBreakdown(paymentRecordEvent.App, paymentRecordEvent.Record); err != nil {
+		return err
+	}
+	if err := attachCashSession(paymentRecordEvent.App, paymentRecordEvent.Record); err != nil {
+		return err
+	}
+	return paymentRecordEvent.Next()
+}
+
+// OrderItemPayments returns the id of the payment covering each of the order items, unpaid order items are missing.
+func OrderItemPayments(app core.App, orderItems []string) (map[string]string, error) {
+	payments := make(map[string]string, len(orderItems))
+	if len(orderItems) == 0 {
+		return payments, nil
+	}
+
+	filters := make([]string, len(orderItems))
+	params := dbx.Params{}
+	for i, orderItem := range orderItems {
+		key := fmt.Sprintf("orderItem%d", i)
+		filters[i] = fmt.Sprintf("order_items.id ?= {:%s}", key)
+		params[key] = orderItem
+	}
+	paymentRecords, err := app.FindRecordsByFilter(
+		paymentTableName,
+		strings.Join(filters, " || "),
+		"created",
+		0,
+		0,
+		params,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, paymentRecord := range paymentRecords {
+		for _, orderItem := range paymentRecord.GetStringSlice("order_items") {
+			if _, ok := payments[orderItem]; !ok && slices.Contains(orderItems, orderItem) {
+				payments[orderItem] = paymentRecord.Id
+			}
+		}
+	}
+	return payments, nil
+}
+
+// paymentSaveExecute moves the order items covered by a saved payment to "Bezahlt" and the order items
+// no longer covered by an updated payment back to "Geliefert".
+// The status cascade of the order items moves their order to "Bezahlt" as well once all of its order items are paid.
+// Like the status cascades it joins the transaction of the save, so for create and update requests
+// the payment and the statuses are either all saved or none.
+func paymentSaveExecute(paymentRecordEvent *core.RecordEvent) error {
+	payment := model.PaymentFromRecord(paymentRecordEvent.Record)
+	var uncovered []string
+	if !paymentRecordEvent.Record.IsNew() {
+		for _, orderItem := range model.PaymentFromRecord(paymentRecordEvent.Record.Original()).OrderItems {
+			if !slices.Contains(payment.OrderItems, orderItem) {
+				uncovered = append(uncovered, orderItem)
+			}
+		}
+	}
+
+	if err := paymentRecordEvent.Next(); err != nil {
+		return err
+	}
+
+	return paymentRecordEvent.App.RunInTransaction(func(txApp core.App) error {
+		if err := markOrderItemsPaid(txApp, paymentRecordEvent.Context, payment); err != nil {
+			return err
+		}
+		return markOrderItemsUnpaid(txApp, paymentRecordEvent.Context, uncovered)
+	})
+}
+
+// validatePaymentOrder rejects payments covering the order items of several orders,
+// as the cash session and the receipt of a payment are the ones of its order.
+func validatePaymentOrder(app core.App, payment model.Payment) error {
+	if len(payment.OrderItems) < 2 {
+		return nil
+	}
+	orderItems, err := app.FindRecordsByIds(orderItemTableName, payment.OrderItems)
+	if err != nil {
+		return err
+	}
+	for _, orderItem := range orderItems {
+		if order := orderItem.GetString("order"); order != orderItems[0].GetString("order") {
+			return validation.Errors{
+				"order_items": validation.NewError(
+					"validation_payment_several_orders",
+					fmt.Sprintf("Order item %s belongs to another order than order item %s", orderItem.Id, orderItems[0].Id),
+				),
+			}
+		}
+	}
+	return nil
+}
+
+func markOrderItemsPaid(app core.App, ctx context.Context, payment model.Payment) error {
+	if len(payment.OrderItems) == 0 {
+		return nil
+	}
+
+	orderItems, err := app.FindRecordsByIds(orderItemTableName, payment.OrderItems)
+	if err != nil {
+		return err
+	}
+	for _, orderItem := range orderItems {
+		if orderItem.GetString("status") == string(orderItemStatusBezahlt) {
+			continue
+		}
+
+		orderItem.Set("status", string(orderItemStatusBezahlt))
+		if err := app.SaveWithContext(withPayment(ctx, payment.Id), orderItem); err != nil {
+			app.Logger().Error(
+				fmt.Sprintf("Failed to mark order item %s paid by payment %s", orderItem.Id, payment.Id),
+			)
+			return fmt.Errorf("failed to mark order item %s paid: %w", orderItem.Id, err)
+		}
+	}
+	return nil
+}
+
+// markOrderItemsUnpaid moves paid order items which are no longer covered by a payment back to "Geliefert",
+// and their order as well if it was paid. Otherwise they would stay "Bezahlt" without a payment and
+// OrderItemPayments would let them be paid a second time.
+func markOrderItemsUnpaid(app core.App, ctx context.Context, orderItemIds []string) error {
+	if len(orderItemIds) == 0 {
+		return nil
+	}
+
+	orderItems, err := app.FindRecordsByIds(orderItemTableName, orderItemIds)
+	if err != nil {
+		return err
+	}
+	orders := []string{}
+	for _, orderItem := range orderItems {
+		if orderItem.GetString("status") != string(orderItemStatusBezahlt) {
+			continue
+		}
+
+		// the order follows below, even if only some of its order items are unpaid
+		orderItem.Set("status", string(orderItemStatusGeliefert))
+		if err := app.SaveWithContext(withStatusCascade(ctx), orderItem); err != nil {
+			return fmt.Errorf("failed to mark order item %s unpaid: %w", orderItem.Id, err)
+		}
+		if order := orderItem.GetString("order"); !slices.Contains(orders, order) {
+			orders = append(orders, order)
+		}
+	}
+
+	for _, orderId := range orders {
+		order, err := app.FindRecordById(orderTableName, orderId)
+		if err != nil {
+			return err
+		}
+		if order.GetString("status") != string(orderStatusBezahlt) {
+			continue
+		}
+		order.Set("status", string(orderStatusGeliefert))
+		if err := app.SaveWithContext(withStatusCascade(ctx), order); err != nil {
+			return fmt.Errorf("failed to mark order %s unpaid: %w", orderId, err)
+		}
+	}
+	return nil
+}
+
+// validateOrderItemPaid rejects moving an order item to "Bezahlt" without a payment, e.g. by superusers in the
+// admin UI or by all stations of the order item. Such order items would count as unpaid for OrderItemPayments.
+func validateOrderItemPaid(ctx context.Context, record *core.Record) error {
+	if record.GetString("status") != string(orderItemStatusBezahlt) || savedByPayment(ctx) != "" {
+		return nil
+	}
+	if !record.IsNew() && record.Original().GetString("status") == string(orderItemStatusBezahlt) {
+		return nil
+	}
+	return validation.Errors{
+		"status": validation.NewError(
+			"validation_order_item_not_paid",
+			"Order items are paid by saving a payment covering them",
+		),
+	}
+}
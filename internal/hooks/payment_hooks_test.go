@@ -0,0 +1,236 @@
+package hooks
+
+import (
+	"errors"
+	"maps"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// the order items of the delivered order hvfhh05zbr323h5, none of them is paid yet
+var testDeliveredOrderItems = []string{"e5cxx50q2ln939x", "b4hxl8160i3x5px", "e919384j8tp20cl", "virgkh8idg27vfo", "rt0a00ca3sha5b8"}
+
+const testDeliveredOrder = "hvfhh05zbr323h5"
+
+const (
+	testPaymentOptionCash = "3gie4k61or17sfk"
+	testPaymentOptionCard = "2dbpn606978dru1"
+)
+
+// newPayment returns an unsaved card payment of the order items.
+func newPayment(tb testing.TB, app core.App, orderItems ...string) *core.Record {
+	tb.Helper()
+	collection, err := app.FindCollectionByNameOrId(model.PaymentCollection)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	payment := core.NewRecord(collection)
+	payment.Load(map[string]any{
+		"tip_amount":     1,
+		"payment_option": testPaymentOptionCard,
+		"order_items":    orderItems,
+	})
+	return payment
+}
+
+// paymentEvents returns the content of the events of the payment.
+func paymentEvents(tb testing.TB, app core.App, paymentId string) []map[string]any {
+	tb.Helper()
+	records, err := app.FindAllRecords(
+		eventTableName,
+		dbx.HashExp{"type": string(paymentEventType)},
+		dbx.NewExp("json_extract([[content]], '$.payment_id') = {:id}", dbx.Params{"id": paymentId}),
+	)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	contents := make([]map[string]any, len(records))
+	for i, record := range records {
+		if err := record.UnmarshalJSONField("content", &contents[i]); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return contents
+}
+
+func TestPaymentMarksOrderItemsPaid(t *testing.T) {
+	app := newTestApp(t)
+
+	payment := newPayment(t, app, testDeliveredOrderItems[0])
+	if err := saveInTransaction(app, payment); err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, app, model.OrderItemCollection, testDeliveredOrderItems[0], "Bezahlt")
+	assertStatus(t, app, model.OrderItemCollection, testDeliveredOrderItems[1], "Geliefert")
+	assertStatus(t, app, model.OrderCollection, testDeliveredOrder, "Geliefert")
+
+	// once every order item is covered the order is paid as well
+	payment = reload(t, app, payment)
+	payment.Set("order_items", testDeliveredOrderItems)
+	if err := saveInTransaction(app, payment); err != nil {
+		t.Fatal(err)
+	}
+	for _, orderItem := range testDeliveredOrderItems {
+		assertStatus(t, app, model.OrderItemCollection, orderItem, "Bezahlt")
+	}
+	assertStatus(t, app, model.OrderCollection, testDeliveredOrder, "Bezahlt")
+
+	if err := app.Delete(payment); err != nil {
+		t.Fatal(err)
+	}
+
+	events := paymentEvents(t, app, payment.Id)
+	expectedActions := []string{"created", "updated", "deleted"}
+	if len(events) != len(expectedActions) {
+		t.Fatalf("expected %d payment events, got %v", len(expectedActions), events)
+	}
+	for i, action := range expectedActions {
+		if events[i]["action"] != action {
+			t.Errorf("expected event %d to be %q, got %v", i, action, events[i])
+		}
+	}
+	if events[0]["total_amount"] != 100.0 || events[0]["tip_amount"] != 1.0 || events[0]["payment_option"] != testPaymentOptionCard {
+		t.Errorf("unexpected content of the created event %v", events[0])
+	}
+	if orderItems, _ := events[1]["order_items"].([]any); len(orderItems) != len(testDeliveredOrderItems) {
+		t.Errorf("expected the updated event to cover %d order items, got %v", len(testDeliveredOrderItems), events[1])
+	}
+}
+
+func TestUncoveredOrderItemsAreUnpaid(t *testing.T) {
+	app := newTestApp(t)
+
+	first := newPayment(t, app, testDeliveredOrderItems[0], testDeliveredOrderItems[1])
+	if err := saveInTransaction(app, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveInTransaction(app, newPayment(t, app, testDeliveredOrderItems[2:]...)); err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, app, model.OrderCollection, testDeliveredOrder, "Bezahlt")
+
+	// an order item removed from its payment is unpaid again, and so is its order
+	first = reload(t, app, first)
+	first.Set("order_items", testDeliveredOrderItems[:1])
+	if err := saveInTransaction(app, first); err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, app, model.OrderItemCollection, testDeliveredOrderItems[0], "Bezahlt")
+	assertStatus(t, app, model.OrderItemCollection, testDeliveredOrderItems[1], "Geliefert")
+	assertStatus(t, app, model.OrderCollection, testDeliveredOrder, "Geliefert")
+
+	// as are the order items of a deleted payment, the order items of other payments stay paid
+	if err := app.Delete(reload(t, app, first)); err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, app, model.OrderItemCollection, testDeliveredOrderItems[0], "Geliefert")
+	for _, orderItem := range testDeliveredOrderItems[2:] {
+		assertStatus(t, app, model.OrderItemCollection, orderItem, "Bezahlt")
+	}
+	assertStatus(t, app, model.OrderCollection, testDeliveredOrder, "Geliefert")
+
+	// and they are paid only once by the next payment
+	payments, err := OrderItemPayments(app, testDeliveredOrderItems[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payments) != 0 {
+		t.Errorf("expected the order items to be unpaid, got %v", payments)
+	}
+	if err := saveInTransaction(app, newPayment(t, app, testDeliveredOrderItems[:2]...)); err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, app, model.OrderCollection, testDeliveredOrder, "Bezahlt")
+}
+
+func TestPaymentCoversOneOrder(t *testing.T) {
+	app := newTestApp(t)
+
+	// 44tv6363beu9q34 is an unpaid order item of the order 7c9314h8rh8469g
+	err := app.Save(newPayment(t, app, testDeliveredOrderItems[0], "44tv6363beu9q34"))
+	assertValidationCode(t, err, "order_items", "validation_payment_several_orders")
+	assertStatus(t, app, model.OrderItemCollection, testDeliveredOrderItems[0], "Geliefert")
+}
+
+func TestPaymentHooksContinueTheChain(t *testing.T) {
+	app := newTestApp(t)
+	var created, updated int
+	app.OnRecordAfterCreateSuccess(paymentTableName).BindFunc(func(e *core.RecordEvent) error {
+		created++
+		return e.Next()
+	})
+	app.OnRecordAfterUpdateSuccess(paymentTableName).BindFunc(func(e *core.RecordEvent) error {
+		updated++
+		return e.Next()
+	})
+
+	payment := newPayment(t, app, testDeliveredOrderItems[0])
+	if err := app.Save(payment); err != nil {
+		t.Fatal(err)
+	}
+	payment = reload(t, app, payment)
+	payment.Set("tip_amount", 2)
+	if err := app.Save(payment); err != nil {
+		t.Fatal(err)
+	}
+	if created != 1 || updated != 1 {
+		t.Errorf("expected the later hooks to run once each, got %d created and %d updated", created, updated)
+	}
+}
+
+func TestPaymentIsRolledBackWithOrderItems(t *testing.T) {
+	app := newTestApp(t)
+
+	app.OnRecordUpdate(orderItemTableName).BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.Id == testDeliveredOrderItems[1] {
+			return errors.New("disk full")
+		}
+		return e.Next()
+	})
+
+	payment := newPayment(t, app, testDeliveredOrderItems[0], testDeliveredOrderItems[1])
+	if err := saveInTransaction(app, payment); err == nil {
+		t.Fatal("expected the failing order item to fail the payment")
+	}
+
+	if _, err := app.FindRecordById(model.PaymentCollection, payment.Id); err == nil {
+		t.Error("expected the payment to be rolled back")
+	}
+	assertStatus(t, app, model.OrderItemCollection, testDeliveredOrderItems[0], "Geliefert")
+	if events := paymentEvents(t, app, payment.Id); len(events) != 0 {
+		t.Errorf("expected no events for the rolled back payment, got %v", events)
+	}
+}
+
+func TestOrderItemIsNotPaidTwice(t *testing.T) {
+	app := newTestApp(t)
+
+	first := newPayment(t, app, testDeliveredOrderItems[0], testDeliveredOrderItems[1])
+	if err := saveInTransaction(app, first); err != nil {
+		t.Fatal(err)
+	}
+
+	second := newPayment(t, app, testDeliveredOrderItems[1], testDeliveredOrderItems[2])
+	assertValidationCode(t, saveInTransaction(app, second), "order_items", "validation_order_item_already_paid")
+	assertStatus(t, app, model.OrderItemCollection, testDeliveredOrderItems[2], "Geliefert")
+
+	// updating the first payment does not conflict with itself
+	first = reload(t, app, first)
+	first.Set("tip_amount", 2)
+	if err := saveInTransaction(app, first); err != nil {
+		t.Fatal(err)
+	}
+
+	payments, err := OrderItemPayments(app, testDeliveredOrderItems[:3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{testDeliveredOrderItems[0]: first.Id, testDeliveredOrderItems[1]: first.Id}
+	if !maps.Equal(payments, expected) {
+		t.Errorf("expected payments %v, got %v", expected, payments)
+	}
+}
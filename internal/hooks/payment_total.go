@@ -0,0 +1,105 @@
+package hooks
+
+import (
+	"fmt"
+	"math"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// PaymentBreakdown is how the total of a payment is made up, in cents like the order item prices.
+type PaymentBreakdown struct {
+	// Subtotal is the sum of the order item prices.
+	Subtotal        float64 `json:"subtotal"`
+	DiscountPercent float64 `json:"discount_percent"`
+	// Discount is DiscountPercent of Subtotal, rounded to full cents.
+	Discount float64 `json:"discount"`
+	// Total is what has to be paid without the tip.
+	Total float64 `json:"total"`
+}
+
+// NewPaymentBreakdown calculates the total of the prices after the discount.
+func NewPaymentBreakdown(prices []float64, discountPercent float64) PaymentBreakdown {
+	var subtotal float64
+	for _, price := range prices {
+		subtotal += price
+	}
+	subtotal = math.Round(subtotal)
+	discount := math.Round(subtotal * discountPercent / 100)
+
+	return PaymentBreakdown{
+		Subtotal:        subtotal,
+		DiscountPercent: discountPercent,
+		Discount:        discount,
+		Total:           subtotal - discount,
+	}
+}
+
+// CalculatePaymentBreakdown calculates the total of the order items after the discount.
+func CalculatePaymentBreakdown(app core.App, orderItems []string, discountPercent float64) (PaymentBreakdown, error) {
+	if err := ValidatePaymentAmounts(discountPercent, 0); err != nil {
+		return PaymentBreakdown{}, err
+	}
+
+	var prices []float64
+	if len(orderItems) > 0 {
+		orderItemRecords, err := app.FindRecordsByIds(orderItemTableName, orderItems)
+		if err != nil {
+			return PaymentBreakdown{}, err
+		}
+		for _, orderItemRecord := range orderItemRecords {
+			prices = append(prices, model.OrderItemFromRecord(orderItemRecord).Price)
+		}
+	}
+	return NewPaymentBreakdown(prices, discountPercent), nil
+}
+
+// ValidatePaymentAmounts checks the discount is between 0 and 100 percent and the tip is not negative.
+func ValidatePaymentAmounts(discountPercent, tipAmount float64) error {
+	if discountPercent < 0 || discountPercent > 100 {
+		return validation.Errors{
+			"discount_percent": validation.NewError("validation_invalid_discount_percent", "The discount has to be between 0 and 100 percent"),
+		}
+	}
+	if tipAmount < 0 {
+		return validation.Errors{
+			"tip_amount": validation.NewError("validation_invalid_tip_amount", "The tip cannot be negative"),
+		}
+	}
+	return nil
+}
+
+// applyPaymentBreakdown stores the breakdown of the payment calculated from its order items.
+// A total sent by the client has to match the calculated one, a missing total is filled in.
+// On updates the total counts as missing while the client leaves it unchanged, e.g. when adding an order item.
+func applyPaymentBreakdown(app core.App, record *core.Record) error {
+	payment := model.PaymentFromRecord(record)
+	if err := ValidatePaymentAmounts(payment.DiscountPercent, payment.TipAmount); err != nil {
+		return err
+	}
+	breakdown, err := CalculatePaymentBreakdown(app, payment.OrderItems, payment.DiscountPercent)
+	if err != nil {
+		return err
+	}
+
+	clientTotal := payment.TotalAmount
+	if !record.IsNew() && clientTotal == record.Original().GetFloat("total_amount") {
+		clientTotal = 0
+	}
+	if clientTotal != 0 && clientTotal != breakdown.Total {
+		message := fmt.Sprintf(
+			"The total of %.0f does not match the calculated total of %.0f (subtotal %.0f, discount %.0f)",
+			clientTotal, breakdown.Total, breakdown.Subtotal, breakdown.Discount,
+		)
+		return validation.Errors{
+			"total_amount": validation.NewError("validation_total_amount_mismatch", message),
+		}
+	}
+
+	record.Set("subtotal_amount", breakdown.Subtotal)
+	record.Set("discount_amount", breakdown.Discount)
+	record.Set("total_amount", breakdown.Total)
+	return nil
+}
@@ -0,0 +1,82 @@
+package hooks
+
+import (
+	"errors"
+	"testing"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+func TestNewPaymentBreakdown(t *testing.T) {
+	scenarios := []struct {
+		prices          []float64
+		discountPercent float64
+		expected        PaymentBreakdown
+	}{
+		{nil, 0, PaymentBreakdown{}},
+		{[]float64{350, 450}, 0, PaymentBreakdown{Subtotal: 800, Total: 800}},
+		{[]float64{350, 450}, 10, PaymentBreakdown{Subtotal: 800, DiscountPercent: 10, Discount: 80, Total: 720}},
+		// the discount is rounded to full cents
+		{[]float64{379}, 15, PaymentBreakdown{Subtotal: 379, DiscountPercent: 15, Discount: 57, Total: 322}},
+		{[]float64{379}, 100, PaymentBreakdown{Subtotal: 379, DiscountPercent: 100, Discount: 379, Total: 0}},
+	}
+
+	for _, s := range scenarios {
+		if got := NewPaymentBreakdown(s.prices, s.discountPercent); got != s.expected {
+			t.Errorf("%v with %v%%: expected %+v, got %+v", s.prices, s.discountPercent, s.expected, got)
+		}
+	}
+}
+
+func TestPaymentTotalIsCalculated(t *testing.T) {
+	app := newTestApp(t)
+
+	// the total is filled in, the prices of the order items are 100 and 321
+	payment := newPayment(t, app, testDeliveredOrderItems[0], testDeliveredOrderItems[3])
+	payment.Set("discount_percent", 10)
+	if err := saveInTransaction(app, payment); err != nil {
+		t.Fatal(err)
+	}
+	saved := model.PaymentFromRecord(reload(t, app, payment))
+	if saved.SubtotalAmount != 421 || saved.DiscountAmount != 42 || saved.TotalAmount != 379 {
+		t.Errorf("unexpected breakdown %+v", saved)
+	}
+
+	// a matching total is accepted
+	payment = newPayment(t, app, testDeliveredOrderItems[1])
+	payment.Set("total_amount", 100)
+	if err := saveInTransaction(app, payment); err != nil {
+		t.Fatal(err)
+	}
+
+	// a fully discounted payment without a tip costs nothing, "total_amount" is not required for that
+	payment = newPayment(t, app, testDeliveredOrderItems[4])
+	payment.Load(map[string]any{"discount_percent": 100, "tip_amount": 0})
+	if err := saveInTransaction(app, payment); err != nil {
+		t.Fatal(err)
+	}
+	saved = model.PaymentFromRecord(reload(t, app, payment))
+	if saved.SubtotalAmount != 321 || saved.DiscountAmount != 321 || saved.TotalAmount != 0 {
+		t.Errorf("unexpected breakdown of the fully discounted payment %+v", saved)
+	}
+
+	scenarios := []struct {
+		field string
+		data  map[string]any
+	}{
+		{"total_amount", map[string]any{"total_amount": 99}},
+		{"discount_percent", map[string]any{"discount_percent": 101}},
+		{"tip_amount", map[string]any{"tip_amount": -1}},
+	}
+	for _, s := range scenarios {
+		payment := newPayment(t, app, testDeliveredOrderItems[2])
+		payment.Load(s.data)
+		err := saveInTransaction(app, payment)
+
+		var validationErrors validation.Errors
+		if !errors.As(err, &validationErrors) || validationErrors[s.field] == nil {
+			t.Errorf("%v: expected a validation error for %s, got %v", s.data, s.field, err)
+		}
+	}
+}
@@ -1,41 +1,55 @@
 package hooks
 
 import (
-	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
 )
 
 const (
-	productTableName string = "product"
+	productTableName string = model.ProductCollection
 )
 
-func RegisterProductHooks(app *pocketbase.PocketBase) {
+func RegisterProductHooks(app core.App) {
 	app.OnRecordAfterCreateSuccess(productTableName).BindFunc(productAfterCreateSuccess)
 	app.OnRecordAfterUpdateSuccess(productTableName).BindFunc(productAfterUpdateSuccess)
 }
 
 func productAfterCreateSuccess(e *core.RecordEvent) error {
 	// On creation, we can log the initial availability if needed
+	product := model.ProductFromRecord(e.Record)
 	productEvent := productEvent{
-		ProductId:   e.Record.GetString("id"),
-		IsAvailable: e.Record.GetBool("is_available"),
+		ProductId:   product.Id,
+		IsAvailable: product.IsAvailable,
+	}
+	if product.TrackStock {
+		productEvent.Stock = &product.Stock
 	}
 	return constructEvent(productEvent).save(e.App)
 }
 
 func productAfterUpdateSuccess(e *core.RecordEvent) error {
-	oldAvailable := e.Record.Original().GetBool("is_available")
-	newAvailable := e.Record.GetBool("is_available")
+	product := model.ProductFromRecord(e.Record)
+	oldProduct := model.ProductFromRecord(e.Record.Original())
 
-	if oldAvailable != newAvailable {
+	if oldProduct.IsAvailable != product.IsAvailable || oldProduct.Stock != product.Stock {
 		productEvent := productEvent{
-			ProductId:   e.Record.GetString("id"),
-			IsAvailable: newAvailable,
+			ProductId:   product.Id,
+			IsAvailable: product.IsAvailable,
+		}
+		if oldProduct.Stock != product.Stock {
+			productEvent.Stock = &product.Stock
+			productEvent.StockChange = product.Stock - oldProduct.Stock
+			productEvent.OrderItemId = stockConsumer(e.Context)
 		}
 		if err := constructEvent(productEvent).save(e.App); err != nil {
 			return err
 		}
 	}
+	if oldProduct.IsAvailable != product.IsAvailable {
+		if err := UpdateMenuItemAvailability(e.App, product.Id); err != nil {
+			return err
+		}
+	}
 
 	return e.Next()
 }
@@ -0,0 +1,48 @@
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// CheckStatusSchema compares the values of the "status" select fields of orders and order items
+// with the statuses of the hooks. A mismatch lets status updates and cascades fail at runtime,
+// e.g. an order cascading "Bezahlt" onto order items which do not allow it,
+// so the app should refuse to start on a *StatusSchemaError.
+func CheckStatusSchema(app core.App) error {
+	return errors.Join(
+		checkSelectValues(app, orderTableName, "status", orderStatuses),
+		checkSelectValues(app, orderItemTableName, "status", orderItemStatuses),
+	)
+}
+
+func checkSelectValues[S ~string](app core.App, collectionName, fieldName string, statuses []S) error {
+	collection, err := app.FindCollectionByNameOrId(collectionName)
+	if err != nil {
+		return err
+	}
+	field, ok := collection.Fields.GetByName(fieldName).(*core.SelectField)
+	if !ok {
+		return fmt.Errorf("%s.%s is not a select field", collectionName, fieldName)
+	}
+
+	schemaErr := &StatusSchemaError{Collection: collectionName, Field: fieldName}
+	for _, status := range statuses {
+		if !slices.Contains(field.Values, string(status)) {
+			schemaErr.Missing = append(schemaErr.Missing, string(status))
+		}
+	}
+	for _, value := range field.Values {
+		if !slices.Contains(statuses, S(value)) {
+			schemaErr.Unknown = append(schemaErr.Unknown, value)
+		}
+	}
+
+	if len(schemaErr.Missing) > 0 || len(schemaErr.Unknown) > 0 {
+		return schemaErr
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package hooks
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestCheckStatusSchema(t *testing.T) {
+	app := newTestApp(t)
+
+	if err := CheckStatusSchema(app); err != nil {
+		t.Fatalf("expected the migrated schema to match, got %v", err)
+	}
+
+	// the order item status field as created from the former schema.json import before "Bezahlt" was added,
+	// with an additional status the hooks do not know
+	collection, err := app.FindCollectionByNameOrId(orderItemTableName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	field := collection.Fields.GetByName("status").(*core.SelectField)
+	field.Values = []string{"Aufgegeben", "InArbeit", "Abholbereit", "Geliefert", "Storniert"}
+	if err := app.Save(collection); err != nil {
+		t.Fatal(err)
+	}
+
+	err = CheckStatusSchema(app)
+	var schemaErr *StatusSchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("expected a StatusSchemaError, got %v", err)
+	}
+	if schemaErr.Collection != orderItemTableName || schemaErr.Field != "status" {
+		t.Errorf("expected the error for order_item.status, got %s.%s", schemaErr.Collection, schemaErr.Field)
+	}
+	if !slices.Equal(schemaErr.Missing, []string{"Bezahlt"}) {
+		t.Errorf("expected Bezahlt to be missing, got %v", schemaErr.Missing)
+	}
+	if !slices.Equal(schemaErr.Unknown, []string{"Storniert"}) {
+		t.Errorf("expected Storniert to be unknown, got %v", schemaErr.Unknown)
+	}
+}
@@ -0,0 +1,19 @@
+package hooks
+
+import "context"
+
+// statusCascadeKey marks the context of saves done by a status cascade.
+// A status change of an order is applied to its order items and the status of the order items
+// is rolled up to their order. Without the mark both cascades would trigger each other again.
+type statusCascadeKey struct{}
+
+// withStatusCascade returns a context for saving records as part of a status cascade.
+func withStatusCascade(ctx context.Context) context.Context {
+	return context.WithValue(ctx, statusCascadeKey{}, true)
+}
+
+// isStatusCascade reports whether the record is saved by a status cascade.
+func isStatusCascade(ctx context.Context) bool {
+	cascade, _ := ctx.Value(statusCascadeKey{}).(bool)
+	return cascade
+}
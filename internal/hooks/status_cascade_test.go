@@ -0,0 +1,212 @@
+package hooks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// testOpenOrder has the open order items wogjt47xn7ru29d and 00g3b1m6v1e54ef.
+const testOpenOrder = "b69u9kp1t9d71z5"
+
+func saveInTransaction(app core.App, record *core.Record) error {
+	return app.RunInTransaction(func(txApp core.App) error {
+		return txApp.Save(record)
+	})
+}
+
+func assertStatus(tb testing.TB, app core.App, collection, id, expected string) {
+	tb.Helper()
+	record, err := app.FindRecordById(collection, id)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if status := record.GetString("status"); status != expected {
+		tb.Errorf("expected %s %s to be in status %s, got %s", collection, id, expected, status)
+	}
+}
+
+// countOrderItemsOfOrderQueries counts the queries for the order items of an order, which both cascades run.
+func countOrderItemsOfOrderQueries(tb testing.TB, app core.App) *atomic.Int64 {
+	tb.Helper()
+	db, ok := app.NonconcurrentDB().(*dbx.DB)
+	if !ok {
+		tb.Fatal("app.NonconcurrentDB() is not a *dbx.DB")
+	}
+	var count atomic.Int64
+	db.QueryLogFunc = func(ctx context.Context, t time.Duration, sql string, rows *sql.Rows, err error) {
+		if strings.Contains(sql, "[[order_item.order]] =") {
+			count.Add(1)
+		}
+	}
+	return &count
+}
+
+func TestOrderStatusCascadeIsAtomic(t *testing.T) {
+	app := newTestApp(t)
+
+	// the second order item of the order cannot be saved
+	app.OnRecordUpdate(orderItemTableName).BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.Id == "00g3b1m6v1e54ef" {
+			return errors.New("disk full")
+		}
+		return e.Next()
+	})
+
+	order, err := app.FindRecordById(model.OrderCollection, testOpenOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order.Set("status", "InArbeit")
+	if err := saveInTransaction(app, order); err == nil {
+		t.Fatal("expected the failing order item to fail the order update")
+	}
+
+	assertStatus(t, app, model.OrderCollection, testOpenOrder, "Aufgegeben")
+	assertStatus(t, app, model.OrderItemCollection, "wogjt47xn7ru29d", "Aufgegeben")
+	assertStatus(t, app, model.OrderItemCollection, "00g3b1m6v1e54ef", "Aufgegeben")
+}
+
+func TestOrderItemStatusCascadeIsAtomic(t *testing.T) {
+	app := newTestApp(t)
+
+	app.OnRecordUpdate(orderTableName).BindFunc(func(e *core.RecordEvent) error {
+		return errors.New("disk full")
+	})
+
+	for _, id := range []string{"wogjt47xn7ru29d", "00g3b1m6v1e54ef"} {
+		orderItem, err := app.FindRecordById(model.OrderItemCollection, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		orderItem.Set("status", "InArbeit")
+		err = saveInTransaction(app, orderItem)
+
+		// only the last order item rolls up to the order, which cannot be saved
+		if id == "00g3b1m6v1e54ef" && err == nil {
+			t.Fatal("expected the failing order to fail the order item update")
+		}
+		if id == "wogjt47xn7ru29d" && err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assertStatus(t, app, model.OrderCollection, testOpenOrder, "Aufgegeben")
+	assertStatus(t, app, model.OrderItemCollection, "00g3b1m6v1e54ef", "Aufgegeben")
+}
+
+func TestStatusCascadesDoNotTriggerEachOther(t *testing.T) {
+	app := newTestApp(t)
+
+	// order -> order items, the order items must not roll up to the order again
+	order, err := app.FindRecordById(model.OrderCollection, testOpenOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order.Set("status", "InArbeit")
+	app.ResetEventCalls()
+	queries := countOrderItemsOfOrderQueries(t, app)
+	if err := saveInTransaction(app, order); err != nil {
+		t.Fatal(err)
+	}
+	if got := app.EventCalls["OnRecordUpdateExecute"]; got != 3 {
+		t.Errorf("expected the order and its 2 order items to be saved once, got %d saves", got)
+	}
+	if got := queries.Load(); got != 1 {
+		t.Errorf("expected the order items to be queried once by the order cascade, got %d queries", got)
+	}
+	assertStatus(t, app, model.OrderItemCollection, "wogjt47xn7ru29d", "InArbeit")
+	assertStatus(t, app, model.OrderItemCollection, "00g3b1m6v1e54ef", "InArbeit")
+
+	// order items -> order, the order must not be applied to the order items again
+	for i, id := range []string{"wogjt47xn7ru29d", "00g3b1m6v1e54ef"} {
+		orderItem, err := app.FindRecordById(model.OrderItemCollection, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		orderItem.Set("status", "Abholbereit")
+		app.ResetEventCalls()
+		queries.Store(0)
+		if err := saveInTransaction(app, orderItem); err != nil {
+			t.Fatal(err)
+		}
+
+		expectedSaves := i + 1 // the last order item also updates the order
+		if got := app.EventCalls["OnRecordUpdateExecute"]; got != expectedSaves {
+			t.Errorf("%s: expected %d saves, got %d", id, expectedSaves, got)
+		}
+		if got := queries.Load(); got != 1 {
+			t.Errorf("%s: expected the order items to be queried once by the order item cascade, got %d queries", id, got)
+		}
+	}
+	assertStatus(t, app, model.OrderCollection, testOpenOrder, "Abholbereit")
+}
+
+func TestOrderStatusCascadeKeepsPaidOrderItems(t *testing.T) {
+	app := newTestApp(t)
+	paid := testDeliveredOrderItems[0]
+	if err := app.Save(newPayment(t, app, paid)); err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, app, model.OrderItemCollection, paid, "Bezahlt")
+
+	// a Kuechenchef step back and forward again must not unpay the paid order item
+	for _, status := range []string{"Abholbereit", "Geliefert"} {
+		order, err := app.FindRecordById(model.OrderCollection, testDeliveredOrder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		order.Set("status", status)
+		if err := saveInTransaction(app, order); err != nil {
+			t.Fatal(err)
+		}
+
+		assertStatus(t, app, model.OrderItemCollection, paid, "Bezahlt")
+		for _, orderItem := range testDeliveredOrderItems[1:] {
+			assertStatus(t, app, model.OrderItemCollection, orderItem, status)
+		}
+	}
+
+	payments, err := OrderItemPayments(app, testDeliveredOrderItems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payments) != 1 || payments[paid] == "" {
+		t.Errorf("expected only %s to be paid, got %v", paid, payments)
+	}
+}
+
+func TestOrderStatusCascadeFollowsTheOrderItemGraph(t *testing.T) {
+	app := newTestApp(t)
+	order, err := app.FindRecordById(model.OrderCollection, testOpenOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order.Set("status", "Abholbereit")
+	if err := saveInTransaction(app, order); err != nil {
+		t.Fatal(err)
+	}
+
+	// one order item is sent back to the kitchen without touching the order
+	_, err = app.DB().Update(model.OrderItemCollection, dbx.Params{"status": "Aufgegeben"}, dbx.HashExp{"id": "wogjt47xn7ru29d"}).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	order = reload(t, app, order)
+	order.Set("status", "Geliefert")
+	if err := saveInTransaction(app, order); err != nil {
+		t.Fatal(err)
+	}
+
+	// Aufgegeben -> Geliefert skips steps, which no role may do
+	assertStatus(t, app, model.OrderItemCollection, "wogjt47xn7ru29d", "Aufgegeben")
+	assertStatus(t, app, model.OrderItemCollection, "00g3b1m6v1e54ef", "Geliefert")
+}
@@ -0,0 +1,203 @@
+package hooks
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// statusGraph declares which status may follow which one.
+type statusGraph[S ~string] struct {
+	transitions map[S][]S
+	// roleTransitions are additional transitions for users of a role.
+	roleTransitions map[string]map[S][]S
+	// hints explain statuses which cannot be left by an update, instead of calling them final.
+	hints map[S]string
+}
+
+// orderItemStatusGraph moves order items forward from the kitchen to the payment.
+// Kitchen stations may skip "InArbeit" for things which are ready immediately (e.g. drinks).
+// The Kuechenchef may additionally move an order item back by one step, e.g. when it was marked
+// "Abholbereit" by mistake, but nobody can change a paid order item.
+// Only payments move order items to "Bezahlt" (see markOrderItemsPaid), so no update may set it.
+var orderItemStatusGraph = statusGraph[orderItemStatus]{
+	transitions: map[orderItemStatus][]orderItemStatus{
+		orderItemStatusAufgegeben:  {orderItemStatusInArbeit, orderItemStatusAbholbereit},
+		orderItemStatusInArbeit:    {orderItemStatusAbholbereit},
+		orderItemStatusAbholbereit: {orderItemStatusGeliefert},
+		orderItemStatusGeliefert:   {},
+		orderItemStatusBezahlt:     {},
+	},
+	hints: map[orderItemStatus]string{
+		orderItemStatusGeliefert: "Order items are paid by saving a payment covering them.",
+	},
+	roleTransitions: map[string]map[orderItemStatus][]orderItemStatus{
+		model.RoleKuechenchef: {
+			orderItemStatusInArbeit:    {orderItemStatusAufgegeben},
+			orderItemStatusAbholbereit: {orderItemStatusInArbeit},
+			orderItemStatusGeliefert:   {orderItemStatusAbholbereit},
+		},
+	},
+}
+
+// orderStatusGraph follows orderItemStatusGraph, as the status of an order is applied to all of its order items.
+// Only payments move an order to "Bezahlt" (see paymentSaveExecute), so no update may set it.
+var orderStatusGraph = statusGraph[orderStatus]{
+	transitions: map[orderStatus][]orderStatus{
+		orderStatusAufgegeben:  {orderStatusInArbeit, orderStatusAbholbereit},
+		orderStatusInArbeit:    {orderStatusAbholbereit},
+		orderStatusAbholbereit: {orderStatusGeliefert},
+		orderStatusGeliefert:   {},
+		orderStatusBezahlt:     {},
+	},
+	hints: map[orderStatus]string{
+		orderStatusGeliefert: "Orders are paid by paying their order items.",
+	},
+	roleTransitions: map[string]map[orderStatus][]orderStatus{
+		model.RoleKuechenchef: {
+			orderStatusInArbeit:    {orderStatusAufgegeben},
+			orderStatusAbholbereit: {orderStatusInArbeit},
+			orderStatusGeliefert:   {orderStatusAbholbereit},
+		},
+	},
+}
+
+// next returns the statuses which may follow the status for users of the role.
+func (g statusGraph[S]) next(from S, role string) []S {
+	next := slices.Clone(g.transitions[from])
+	return append(next, g.roleTransitions[role][from]...)
+}
+
+// allowsForAnyRole reports whether users of any role may change the status from 'from' to 'to'.
+func (g statusGraph[S]) allowsForAnyRole(from, to S) bool {
+	if slices.Contains(g.transitions[from], to) {
+		return true
+	}
+	for _, transitions := range g.roleTransitions {
+		if slices.Contains(transitions[from], to) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate returns a 400 error naming the allowed next statuses if the transition is not allowed.
+// Keeping the status is always allowed, changing an unknown status (e.g. an empty one) never is.
+func (g statusGraph[S]) validate(field string, from, to S, role string) error {
+	if from == to {
+		return nil
+	}
+	if _, known := g.transitions[from]; !known {
+		message := fmt.Sprintf("Status %q is unknown and cannot be changed to %s.", from, to)
+		return router.NewBadRequestError(message, validation.Errors{
+			field: validation.NewError("validation_invalid_status_transition", message),
+		})
+	}
+	next := g.next(from, role)
+	if slices.Contains(next, to) {
+		return nil
+	}
+
+	allowed := make([]string, len(next))
+	for i, status := range next {
+		allowed[i] = string(status)
+	}
+	message := fmt.Sprintf("Status %s cannot be changed to %s.", from, to)
+	switch {
+	case len(allowed) > 0:
+		message += fmt.Sprintf(" Allowed next states: %s.", strings.Join(allowed, ", "))
+	case g.hints[from] != "":
+		message += " " + g.hints[from]
+	default:
+		message += fmt.Sprintf(" %s is final.", from)
+	}
+
+	return router.NewBadRequestError(message, validation.Errors{
+		field: validation.NewError("validation_invalid_status_transition", message),
+	})
+}
+
+// ValidateOrderItemStatusTransition checks that the user may change the status of an order item (or of one of
+// its stations) from 'from' to 'to'. Superusers, e.g. in the admin UI, may change every status.
+func ValidateOrderItemStatusTransition(app core.App, auth *core.Record, field, from, to string) error {
+	role, superuser, err := AuthRole(app, auth)
+	if err != nil || superuser {
+		return err
+	}
+	return orderItemStatusGraph.validate(field, orderItemStatus(from), orderItemStatus(to), role)
+}
+
+// AuthRole returns the name of the role of the authenticated user, superusers have no role.
+func AuthRole(app core.App, auth *core.Record) (role string, superuser bool, err error) {
+	if auth == nil {
+		return "", false, nil
+	}
+	if auth.IsSuperuser() {
+		return "", true, nil
+	}
+
+	roleId := model.UserFromRecord(auth).Role
+	if roleId == "" {
+		return "", false, nil
+	}
+	roleRecord, err := app.FindRecordById(model.UserRoleCollection, roleId)
+	if err != nil {
+		return "", false, err
+	}
+	return model.UserRoleFromRecord(roleRecord).RoleName, false, nil
+}
+
+func orderUpdateRequest(e *core.RecordRequestEvent) error {
+	role, superuser, err := AuthRole(e.App, e.Auth)
+	if err != nil {
+		return err
+	}
+	if !superuser {
+		oldStatus := orderStatus(model.OrderFromRecord(e.Record.Original()).Status)
+		newStatus := orderStatus(model.OrderFromRecord(e.Record).Status)
+		if err := orderStatusGraph.validate("status", oldStatus, newStatus, role); err != nil {
+			return err
+		}
+	}
+	return runRequestInTransaction(e)
+}
+
+func orderItemUpdateRequest(e *core.RecordRequestEvent) error {
+	role, superuser, err := AuthRole(e.App, e.Auth)
+	if err != nil {
+		return err
+	}
+	if !superuser {
+		original := model.OrderItemFromRecord(e.Record.Original())
+		orderItem := model.OrderItemFromRecord(e.Record)
+		if err := orderItemStatusGraph.validate("status", orderItemStatus(original.Status), orderItemStatus(orderItem.Status), role); err != nil {
+			return err
+		}
+
+		// stations follow the same graph, new stations start from the status of the order item
+		for station, status := range orderItem.StationStatus {
+			oldStatus, ok := original.StationStatus[station]
+			if !ok {
+				oldStatus = original.Status
+			}
+			if err := orderItemStatusGraph.validate("station_status", orderItemStatus(oldStatus), orderItemStatus(status), role); err != nil {
+				return err
+			}
+		}
+	}
+	return runRequestInTransaction(e)
+}
+
+// runRequestInTransaction continues an update request in a transaction,
+// so the status cascades of the updated record are rolled back together with it.
+func runRequestInTransaction(e *core.RecordRequestEvent) error {
+	return e.App.RunInTransaction(func(txApp core.App) error {
+		e.App = txApp
+		return e.Next()
+	})
+}
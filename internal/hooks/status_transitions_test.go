@@ -0,0 +1,282 @@
+package hooks
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+type statusEdge struct {
+	from, to string
+}
+
+// expectedStatusEdges are all status changes allowed per role, the same for orders and order items.
+// None of them leads to "Bezahlt", only payments move order items and with them orders there.
+var expectedStatusEdges = map[string][]statusEdge{
+	model.RoleKellner: {
+		{"Aufgegeben", "InArbeit"},
+		{"Aufgegeben", "Abholbereit"},
+		{"InArbeit", "Abholbereit"},
+		{"Abholbereit", "Geliefert"},
+	},
+	model.RoleKueche: {
+		{"Aufgegeben", "InArbeit"},
+		{"Aufgegeben", "Abholbereit"},
+		{"InArbeit", "Abholbereit"},
+		{"Abholbereit", "Geliefert"},
+	},
+	model.RoleKuechenchef: {
+		{"Aufgegeben", "InArbeit"},
+		{"Aufgegeben", "Abholbereit"},
+		{"InArbeit", "Abholbereit"},
+		{"InArbeit", "Aufgegeben"},
+		{"Abholbereit", "Geliefert"},
+		{"Abholbereit", "InArbeit"},
+		{"Geliefert", "Abholbereit"},
+	},
+}
+
+var testStatuses = []string{"Aufgegeben", "InArbeit", "Abholbereit", "Geliefert", "Bezahlt"}
+
+func TestOrderItemStatusGraph(t *testing.T) {
+	for role, edges := range expectedStatusEdges {
+		for _, from := range testStatuses {
+			for _, to := range testStatuses {
+				expectAllowed := from == to || slices.Contains(edges, statusEdge{from, to})
+				err := orderItemStatusGraph.validate("status", orderItemStatus(from), orderItemStatus(to), role)
+				if expectAllowed && err != nil {
+					t.Errorf("%s: expected %s -> %s to be allowed, got %v", role, from, to, err)
+				}
+				if !expectAllowed && err == nil {
+					t.Errorf("%s: expected %s -> %s to be rejected", role, from, to)
+				}
+			}
+		}
+	}
+}
+
+func TestOrderStatusGraph(t *testing.T) {
+	for role, edges := range expectedStatusEdges {
+		for _, from := range testStatuses {
+			for _, to := range testStatuses {
+				expectAllowed := from == to || slices.Contains(edges, statusEdge{from, to})
+				err := orderStatusGraph.validate("status", orderStatus(from), orderStatus(to), role)
+				if expectAllowed && err != nil {
+					t.Errorf("%s: expected %s -> %s to be allowed, got %v", role, from, to, err)
+				}
+				if !expectAllowed && err == nil {
+					t.Errorf("%s: expected %s -> %s to be rejected", role, from, to)
+				}
+			}
+		}
+	}
+}
+
+func TestStatusTransitionErrorNamesAllowedStates(t *testing.T) {
+	scenarios := []struct {
+		from, to string
+		role     string
+		expected string
+	}{
+		{"Aufgegeben", "Bezahlt", model.RoleKellner, "Allowed next states: InArbeit, Abholbereit."},
+		{"Abholbereit", "Aufgegeben", model.RoleKuechenchef, "Allowed next states: Geliefert, InArbeit."},
+		{"Geliefert", "Bezahlt", model.RoleKellner, "Order items are paid by saving a payment covering them."},
+		{"Geliefert", "Bezahlt", model.RoleKuechenchef, "Allowed next states: Abholbereit."},
+		{"Bezahlt", "Aufgegeben", model.RoleKuechenchef, "Bezahlt is final."},
+		{"", "InArbeit", model.RoleKuechenchef, `Status "" is unknown`},
+	}
+
+	for _, s := range scenarios {
+		err := orderItemStatusGraph.validate("status", orderItemStatus(s.from), orderItemStatus(s.to), s.role)
+		if err == nil || !strings.Contains(err.Error(), s.expected) {
+			t.Errorf("%s -> %s: expected error containing %q, got %v", s.from, s.to, s.expected, err)
+		}
+	}
+
+	err := orderStatusGraph.validate("status", orderStatusGeliefert, orderStatusBezahlt, model.RoleKellner)
+	if err == nil || !strings.Contains(err.Error(), "Orders are paid by paying their order items.") {
+		t.Errorf("expected the payment hint, got %v", err)
+	}
+}
+
+// authHeader returns the Authorization header of the waiter of the test data.
+func authHeader(tb testing.TB) map[string]string {
+	tb.Helper()
+	app := newTestApp(tb)
+	user, err := app.FindRecordById(model.UserCollection, testWaiter)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	token, err := user.NewAuthToken()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return map[string]string{"Authorization": token}
+}
+
+// setWaiterRole changes the role of the waiter of the test data.
+func setWaiterRole(tb testing.TB, app core.App, roleName string) {
+	tb.Helper()
+	role, err := app.FindFirstRecordByData(model.UserRoleCollection, "role_name", roleName)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	user, err := app.FindRecordById(model.UserCollection, testWaiter)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	user.Set("role", role.Id)
+	if err := app.Save(user); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func TestStatusTransitionsAreEnforcedOnUpdateRequests(t *testing.T) {
+	headers := authHeader(t)
+	appFactory := func(role string) func(t testing.TB) *tests.TestApp {
+		return func(t testing.TB) *tests.TestApp {
+			app := newScenarioTestApp(t)
+			setWaiterRole(t, app, role)
+			return app
+		}
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:            "order item skipping to Bezahlt",
+			Method:          http.MethodPatch,
+			URL:             "/api/collections/order_item/records/" + testOpenOrderItem,
+			Body:            strings.NewReader(`{"status":"Bezahlt"}`),
+			Headers:         headers,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{"Allowed next states: InArbeit, Abholbereit.", "validation_invalid_status_transition"},
+			TestAppFactory:  appFactory(model.RoleKellner),
+		},
+		{
+			Name:            "order item to InArbeit",
+			Method:          http.MethodPatch,
+			URL:             "/api/collections/order_item/records/" + testOpenOrderItem,
+			Body:            strings.NewReader(`{"status":"InArbeit"}`),
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"status":"InArbeit"`},
+			ExpectedEvents:  map[string]int{"OnRecordUpdateRequest": 1},
+			TestAppFactory:  appFactory(model.RoleKellner),
+		},
+		{
+			Name:            "station skipping to Geliefert",
+			Method:          http.MethodPatch,
+			URL:             "/api/collections/order_item/records/" + testOpenOrderItem,
+			Body:            strings.NewReader(`{"station_status":{"` + testStationMochi + `":"Geliefert"}}`),
+			Headers:         headers,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{`"station_status"`},
+			TestAppFactory:  appFactory(model.RoleKellner),
+		},
+		{
+			Name:            "order back to Abholbereit by a waiter",
+			Method:          http.MethodPatch,
+			URL:             "/api/collections/order/records/hvfhh05zbr323h5",
+			Body:            strings.NewReader(`{"status":"Abholbereit"}`),
+			Headers:         headers,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{"Orders are paid by paying their order items."},
+			TestAppFactory:  appFactory(model.RoleKellner),
+		},
+		{
+			Name:            "order to Bezahlt without a payment",
+			Method:          http.MethodPatch,
+			URL:             "/api/collections/order/records/hvfhh05zbr323h5",
+			Body:            strings.NewReader(`{"status":"Bezahlt"}`),
+			Headers:         headers,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{"validation_invalid_status_transition"},
+			TestAppFactory:  appFactory(model.RoleKuechenchef),
+		},
+		{
+			Name:            "order back to Abholbereit by the Kuechenchef",
+			Method:          http.MethodPatch,
+			URL:             "/api/collections/order/records/hvfhh05zbr323h5",
+			Body:            strings.NewReader(`{"status":"Abholbereit"}`),
+			Headers:         headers,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"status":"Abholbereit"`},
+			ExpectedEvents:  map[string]int{"OnRecordUpdateRequest": 1},
+			TestAppFactory:  appFactory(model.RoleKuechenchef),
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
+
+func TestOrderItemUpdatesCannotPay(t *testing.T) {
+	headers := authHeader(t)
+	appFactory := func(role string) func(t testing.TB) *tests.TestApp {
+		return func(t testing.TB) *tests.TestApp {
+			app := newScenarioTestApp(t)
+			setWaiterRole(t, app, role)
+			return app
+		}
+	}
+
+	scenarios := []struct {
+		role string
+		body string
+	}{
+		{model.RoleKellner, `{"status":"Bezahlt"}`},
+		{model.RoleKueche, `{"status":"Bezahlt"}`},
+		{model.RoleKuechenchef, `{"status":"Bezahlt"}`},
+		{model.RoleKellner, `{"station_status":{"` + testStationMochi + `":"Bezahlt"}}`},
+		{model.RoleKueche, `{"station_status":{"` + testStationMochi + `":"Bezahlt"}}`},
+		{model.RoleKuechenchef, `{"station_status":{"` + testStationMochi + `":"Bezahlt"}}`},
+	}
+
+	for _, s := range scenarios {
+		scenario := tests.ApiScenario{
+			Name:            s.role + " " + s.body,
+			Method:          http.MethodPatch,
+			URL:             "/api/collections/order_item/records/" + testDeliveredOrderItems[0],
+			Body:            strings.NewReader(s.body),
+			Headers:         headers,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{"validation_invalid_status_transition"},
+			TestAppFactory:  appFactory(s.role),
+		}
+		scenario.Test(t)
+	}
+}
+
+func TestOnlyPaymentsSaveOrderItemsPaid(t *testing.T) {
+	app := newTestApp(t)
+
+	// e.g. a superuser in the admin UI, who may set any other status
+	orderItem, err := app.FindRecordById(model.OrderItemCollection, testDeliveredOrderItems[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	orderItem.Set("status", "Bezahlt")
+	assertValidationCode(t, app.Save(orderItem), "status", "validation_order_item_not_paid")
+
+	orderItem = reload(t, app, orderItem)
+	orderItem.Set("station_status", map[string]string{testStationMochi: "Bezahlt"})
+	assertValidationCode(t, app.Save(orderItem), "status", "validation_order_item_not_paid")
+
+	if err := app.Save(newPayment(t, app, testDeliveredOrderItems[0])); err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, app, model.OrderItemCollection, testDeliveredOrderItems[0], "Bezahlt")
+
+	// paid order items may still be saved, e.g. with new notes
+	orderItem = reload(t, app, orderItem)
+	orderItem.Set("notes", "bezahlt")
+	if err := app.Save(orderItem); err != nil {
+		t.Fatal(err)
+	}
+}
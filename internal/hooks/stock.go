@@ -0,0 +1,142 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// stockConsumerKey marks the context of saving a product whose stock is consumed by an order item,
+// so the product event can name the order item.
+type stockConsumerKey struct{}
+
+// withStockConsumer returns a context for saving a product whose stock the order item consumes.
+func withStockConsumer(ctx context.Context, orderItem string) context.Context {
+	return context.WithValue(ctx, stockConsumerKey{}, orderItem)
+}
+
+// stockConsumer returns the order item consuming the stock of the saved product, if any.
+func stockConsumer(ctx context.Context) string {
+	orderItem, _ := ctx.Value(stockConsumerKey{}).(string)
+	return orderItem
+}
+
+// RegisterStockHooks tracks the stock of the products with "track_stock": new order items consume one of
+// each of their products and products are unavailable while they are out of stock.
+func RegisterStockHooks(app core.App) {
+	app.OnRecordCreate(productTableName).BindFunc(productStockSave)
+	app.OnRecordUpdate(productTableName).BindFunc(productStockSave)
+	app.OnRecordCreateExecute(orderItemTableName).BindFunc(orderItemStockCreateExecute)
+}
+
+// productStockSave makes a product unavailable once it is out of stock, also when the stock is set by hand.
+// The change of the availability is recorded by productAfterUpdateSuccess.
+func productStockSave(productRecordEvent *core.RecordEvent) error {
+	product := model.ProductFromRecord(productRecordEvent.Record)
+	if product.TrackStock && product.Stock <= 0 {
+		productRecordEvent.Record.Set("is_available", false)
+	}
+	return productRecordEvent.Next()
+}
+
+// orderItemStockCreateExecute rejects order items with products out of stock before creating them
+// and consumes the stock after, in the transaction of the create like paymentSaveExecute.
+func orderItemStockCreateExecute(orderItemRecordEvent *core.RecordEvent) error {
+	orderItem := model.OrderItemFromRecord(orderItemRecordEvent.Record)
+	if _, err := findStockProducts(orderItemRecordEvent.App, orderItem); err != nil {
+		return err
+	}
+
+	if err := orderItemRecordEvent.Next(); err != nil {
+		return err
+	}
+
+	return orderItemRecordEvent.App.RunInTransaction(func(txApp core.App) error {
+		return consumeStock(txApp, orderItemRecordEvent.Context, orderItem)
+	})
+}
+
+// stockProduct is a product with stock tracking and the quantity an order item consumes of it.
+type stockProduct struct {
+	record   *core.Record
+	quantity int
+}
+
+// findStockProducts returns the products of the order item with stock tracking, or a validation error
+// if one of them has not enough stock left.
+func findStockProducts(app core.App, orderItem model.OrderItem) ([]stockProduct, error) {
+	quantities := map[string]int{}
+	for _, product := range orderItem.Products {
+		quantities[product]++
+	}
+	if len(quantities) == 0 {
+		return nil, nil
+	}
+
+	productRecords, err := app.FindRecordsByIds(productTableName, orderItem.Products)
+	if err != nil {
+		return nil, err
+	}
+	stockProducts := []stockProduct{}
+	for _, productRecord := range productRecords {
+		product := model.ProductFromRecord(productRecord)
+		if !product.TrackStock {
+			continue
+		}
+		quantity := quantities[product.Id]
+		if product.Stock < quantity {
+			return nil, validation.Errors{
+				"products": validation.NewError(
+					"validation_out_of_stock",
+					fmt.Sprintf("%s is out of stock", product.Name),
+				),
+			}
+		}
+		stockProducts = append(stockProducts, stockProduct{record: productRecord, quantity: quantity})
+	}
+	return stockProducts, nil
+}
+
+// consumeStock takes the products of the order item out of stock.
+func consumeStock(app core.App, ctx context.Context, orderItem model.OrderItem) error {
+	stockProducts, err := findStockProducts(app, orderItem)
+	if err != nil {
+		return err
+	}
+	for _, stockProduct := range stockProducts {
+		record := stockProduct.record
+		record.Set("stock", record.GetInt("stock")-stockProduct.quantity)
+		if err := app.SaveWithContext(withStockConsumer(ctx, orderItem.Id), record); err != nil {
+			return fmt.Errorf("failed to consume the stock of product %s: %w", record.Id, err)
+		}
+	}
+	return nil
+}
+
+// RestockProduct adds the quantity to the stock of the product and makes it available again.
+// The stock of the product is tracked from then on.
+func RestockProduct(app core.App, productId string, quantity int) (model.Product, error) {
+	var product model.Product
+	err := app.RunInTransaction(func(txApp core.App) error {
+		record, err := txApp.FindRecordById(productTableName, productId)
+		if err != nil {
+			return err
+		}
+
+		stock := record.GetInt("stock") + quantity
+		record.Set("track_stock", true)
+		record.Set("stock", stock)
+		if stock > 0 {
+			record.Set("is_available", true)
+		}
+		if err := txApp.Save(record); err != nil {
+			return err
+		}
+		product = model.ProductFromRecord(record)
+		return nil
+	})
+	return product, err
+}
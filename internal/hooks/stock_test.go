@@ -0,0 +1,139 @@
+package hooks
+
+import (
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// productEvents returns the content of the events of the product.
+func productEvents(tb testing.TB, app core.App, productId string) []map[string]any {
+	tb.Helper()
+	records, err := app.FindAllRecords(
+		eventTableName,
+		dbx.HashExp{"type": string(productEventType)},
+		dbx.NewExp("json_extract([[content]], '$.product_id') = {:id}", dbx.Params{"id": productId}),
+	)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	contents := make([]map[string]any, len(records))
+	for i, record := range records {
+		if err := record.UnmarshalJSONField("content", &contents[i]); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return contents
+}
+
+func findProduct(tb testing.TB, app core.App, id string) model.Product {
+	tb.Helper()
+	record, err := app.FindRecordById(model.ProductCollection, id)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return model.ProductFromRecord(record)
+}
+
+func TestOrderItemsConsumeStock(t *testing.T) {
+	app := newTestApp(t)
+
+	mochi, err := app.FindRecordById(model.ProductCollection, testProductMochi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mochi.Set("track_stock", true)
+	mochi.Set("stock", 2)
+	mochi.Set("is_available", true)
+	if err := app.Save(mochi); err != nil {
+		t.Fatal(err)
+	}
+
+	order := saveNewRecord(t, app, model.OrderCollection, map[string]any{
+		"table":  1,
+		"waiter": testWaiter,
+		"status": "Aufgegeben",
+		"person": 1,
+	})
+	newOrderItem := func() *core.Record {
+		collection, err := app.FindCollectionByNameOrId(model.OrderItemCollection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		record := core.NewRecord(collection)
+		record.Load(map[string]any{
+			"order":     order.Id,
+			"price":     5,
+			"status":    "Aufgegeben",
+			"menu_item": testMenuItemMochi,
+			"products":  []string{testProductMochi, testProductCrepe},
+		})
+		return record
+	}
+
+	first := newOrderItem()
+	if err := app.Save(first); err != nil {
+		t.Fatal(err)
+	}
+	if product := findProduct(t, app, testProductMochi); product.Stock != 1 || !product.IsAvailable {
+		t.Fatalf("expected 1 available mochi left, got %+v", product)
+	}
+	if err := app.Save(newOrderItem()); err != nil {
+		t.Fatal(err)
+	}
+	if product := findProduct(t, app, testProductMochi); product.Stock != 0 || product.IsAvailable {
+		t.Fatalf("expected the mochi to be out of stock and unavailable, got %+v", product)
+	}
+	// the crepe has no stock tracking
+	if events := productEvents(t, app, testProductCrepe); len(events) != 0 {
+		t.Errorf("expected the stock of the crepe to stay untracked, got the events %v", events)
+	}
+
+	rejected := newOrderItem()
+	err = app.RunInTransaction(func(txApp core.App) error {
+		return txApp.Save(rejected)
+	})
+	assertValidationCode(t, err, "products", "validation_out_of_stock")
+	if _, err := app.FindRecordById(model.OrderItemCollection, rejected.Id); err == nil {
+		t.Error("expected the order item to be rejected")
+	}
+
+	product, err := RestockProduct(app, testProductMochi, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.Stock != 5 || !product.IsAvailable {
+		t.Errorf("expected 5 available mochi after the restock, got %+v", product)
+	}
+
+	events := productEvents(t, app, testProductMochi)
+	expected := []struct {
+		stock       float64
+		change      float64
+		available   bool
+		orderItemId bool
+	}{
+		{2, 2, true, false},
+		{1, -1, true, true},
+		{0, -1, false, true},
+		{5, 5, true, false},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d product events, got %v", len(expected), events)
+	}
+	for i, e := range expected {
+		event := events[i]
+		if event["stock"] != e.stock || event["stock_change"] != e.change || event["is_available"] != e.available {
+			t.Errorf("unexpected product event %d: %v", i, event)
+		}
+		if _, ok := event["order_item_id"]; ok != e.orderItemId {
+			t.Errorf("unexpected order item of product event %d: %v", i, event)
+		}
+	}
+	if events[1]["order_item_id"] != first.Id {
+		t.Errorf("expected the stock to be consumed by %s, got %v", first.Id, events[1])
+	}
+}
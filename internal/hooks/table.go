@@ -0,0 +1,88 @@
+package hooks
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+const (
+	tableTableName string = model.TableCollection
+)
+
+// RegisterTableHooks links orders to their table and keeps tables with open orders from being deleted.
+// Clients may set either the "table" number or the "dining_table" relation of an order, the other one follows.
+func RegisterTableHooks(app core.App) {
+	app.OnRecordCreate(orderTableName).BindFunc(orderTableSave)
+	app.OnRecordUpdate(orderTableName).BindFunc(orderTableSave)
+	app.OnRecordDelete(tableTableName).BindFunc(tableDelete)
+}
+
+// orderTableSave sets the "dining_table" of a new order or an order whose table changed.
+// Numbers of unknown tables are rejected, failing lookups end the request with a 500 error.
+func orderTableSave(orderRecordEvent *core.RecordEvent) error {
+	record := orderRecordEvent.Record
+	original := record.Original()
+	tableChanged := record.GetString("dining_table") != original.GetString("dining_table")
+	numberChanged := record.GetFloat("table") != original.GetFloat("table")
+
+	switch {
+	case tableChanged && record.GetString("dining_table") != "":
+		tableRecord, err := orderRecordEvent.App.FindRecordById(tableTableName, record.GetString("dining_table"))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return router.NewInternalServerError("Failed to find the table.", err)
+		}
+		if err != nil {
+			return validation.Errors{
+				"dining_table": validation.NewError("validation_unknown_table", "The table does not exist"),
+			}
+		}
+		record.Set("table", model.TableFromRecord(tableRecord).Number)
+	case record.IsNew() || numberChanged || tableChanged:
+		tableRecord, err := FindTableByNumber(orderRecordEvent.App, record.GetFloat("table"))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return router.NewInternalServerError("Failed to find the table.", err)
+		}
+		if err != nil {
+			return validation.Errors{
+				"table": validation.NewError("validation_unknown_table", fmt.Sprintf("Table %v does not exist", record.GetFloat("table"))),
+			}
+		}
+		record.Set("dining_table", tableRecord.Id)
+	}
+	return orderRecordEvent.Next()
+}
+
+// tableDelete rejects deleting a table with unpaid orders.
+func tableDelete(tableRecordEvent *core.RecordEvent) error {
+	statuses := []any{}
+	for _, status := range UnpaidOrderStatuses() {
+		statuses = append(statuses, status)
+	}
+	var count int
+	err := tableRecordEvent.App.RecordQuery(orderTableName).
+		Select("count(*)").
+		AndWhere(dbx.HashExp{"dining_table": tableRecordEvent.Record.Id}).
+		AndWhere(dbx.In("status", statuses...)).
+		Row(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return validation.Errors{
+			"id": validation.NewError("validation_table_occupied", "The table has unpaid orders"),
+		}
+	}
+	return tableRecordEvent.Next()
+}
+
+// FindTableByNumber returns the table with the number.
+func FindTableByNumber(app core.App, number float64) (*core.Record, error) {
+	return app.FindFirstRecordByFilter(tableTableName, "number = {:number}", dbx.Params{"number": number})
+}
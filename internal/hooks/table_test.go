@@ -0,0 +1,124 @@
+package hooks
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// testTable is the table created for the orders of table 1 by the table migration.
+const testTable = "table0000000001"
+
+func TestOrdersAreLinkedToTheirTable(t *testing.T) {
+	app := newTestApp(t)
+	terrace := saveNewRecord(t, app, model.TableCollection, map[string]any{"number": 20, "area": "Terrasse", "seats": 4})
+
+	order := saveNewRecord(t, app, model.OrderCollection, map[string]any{
+		"table":  1,
+		"waiter": testWaiter,
+		"status": "Aufgegeben",
+		"person": 2,
+	})
+	if got := model.OrderFromRecord(order).DiningTable; got != testTable {
+		t.Errorf("expected the order to be linked to table 1, got %q", got)
+	}
+
+	// moving the order by its table record also changes the number
+	order = reload(t, app, order)
+	order.Set("dining_table", terrace.Id)
+	if err := app.Save(order); err != nil {
+		t.Fatal(err)
+	}
+	if got := model.OrderFromRecord(reload(t, app, order)).Table; got != 20 {
+		t.Errorf("expected the order to be at table 20, got %v", got)
+	}
+
+	// and the other way round
+	order = reload(t, app, order)
+	order.Set("table", 1)
+	if err := app.Save(order); err != nil {
+		t.Fatal(err)
+	}
+	if got := model.OrderFromRecord(reload(t, app, order)).DiningTable; got != testTable {
+		t.Errorf("expected the order to be linked to table 1 again, got %q", got)
+	}
+
+	collection, err := app.FindCollectionByNameOrId(model.OrderCollection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown := core.NewRecord(collection)
+	unknown.Load(map[string]any{
+		"table":  99,
+		"waiter": testWaiter,
+		"status": "Aufgegeben",
+		"person": 1,
+	})
+	assertValidationCode(t, app.Save(unknown), "table", "validation_unknown_table")
+}
+
+func TestTablesWithUnpaidOrdersCannotBeDeleted(t *testing.T) {
+	app := newTestApp(t)
+
+	table, err := app.FindRecordById(model.TableCollection, testTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertValidationCode(t, app.Delete(table), "id", "validation_table_occupied")
+
+	free := saveNewRecord(t, app, model.TableCollection, map[string]any{"number": 20})
+	if err := app.Delete(free); err != nil {
+		t.Errorf("expected a free table to be deleted, got %v", err)
+	}
+}
+
+func TestExistingOrdersGetTheirTables(t *testing.T) {
+	app := newTestApp(t)
+
+	orders, err := app.FindAllRecords(model.OrderCollection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range orders {
+		order := model.OrderFromRecord(record)
+		table, err := FindTableByNumber(app, order.Table)
+		if err != nil {
+			t.Fatalf("expected a table for the number %v of order %s, got %v", order.Table, order.Id, err)
+		}
+		if order.DiningTable != table.Id {
+			t.Errorf("expected order %s to be linked to table %s, got %q", order.Id, table.Id, order.DiningTable)
+		}
+
+		// the orders can be saved again
+		if err := app.Save(record); err != nil {
+			t.Errorf("expected order %s to be saved, got %v", order.Id, err)
+		}
+	}
+}
+
+func TestFailingTableLookupsAreNoValidationErrors(t *testing.T) {
+	app := newTestApp(t)
+	collection, err := app.FindCollectionByNameOrId(model.OrderCollection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.DB().NewQuery("ALTER TABLE {{table}} RENAME TO {{table_gone}}").Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	order := core.NewRecord(collection)
+	order.Load(map[string]any{
+		"table":  1,
+		"waiter": testWaiter,
+		"status": "Aufgegeben",
+		"person": 1,
+	})
+	var apiErr *router.ApiError
+	if err := app.Save(order); !errors.As(err, &apiErr) || apiErr.Status != http.StatusInternalServerError {
+		t.Errorf("expected an internal server error, got %v", err)
+	}
+}
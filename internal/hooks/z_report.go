@@ -0,0 +1,87 @@
+package hooks
+
+import (
+	"fmt"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+const (
+	zReportTableName string = model.ZReportCollection
+)
+
+func RegisterZReportHooks(app core.App) {
+	app.OnRecordCreate(zReportTableName).BindFunc(zReportCreate)
+	app.OnRecordUpdate(zReportTableName).BindFunc(zReportImmutable)
+	app.OnRecordDelete(zReportTableName).BindFunc(zReportImmutable)
+}
+
+// zReportCreate numbers the report after the last issued one. The periods of the reports must not overlap,
+// otherwise the same payments would be closed twice.
+func zReportCreate(zReportRecordEvent *core.RecordEvent) error {
+	record := zReportRecordEvent.Record
+	start := record.GetDateTime("start")
+	end := record.GetDateTime("end")
+	if !start.IsZero() && !end.IsZero() && !start.Before(end) {
+		return validation.Errors{
+			"end": validation.NewError("validation_z_report_invalid_period", "The end of the period has to be after its start"),
+		}
+	}
+
+	overlapping, err := FindOverlappingZReport(zReportRecordEvent.App, start, end)
+	if err != nil {
+		return err
+	}
+	if overlapping != nil {
+		return validation.Errors{
+			"start": validation.NewError(
+				"validation_z_report_overlap",
+				fmt.Sprintf("The period overlaps with Z-report %d", overlapping.GetInt("number")),
+			),
+		}
+	}
+
+	number, err := NextZReportNumber(zReportRecordEvent.App)
+	if err != nil {
+		return err
+	}
+	record.Set("number", number)
+	return zReportRecordEvent.Next()
+}
+
+// zReportImmutable rejects changing or deleting an issued report.
+func zReportImmutable(zReportRecordEvent *core.RecordEvent) error {
+	return ErrZReportImmutable
+}
+
+// NextZReportNumber returns the number of the next report, the reports are numbered without gaps starting with 1.
+func NextZReportNumber(app core.App) (int, error) {
+	records, err := app.FindRecordsByFilter(zReportTableName, "", "-number", 1, 0)
+	if err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 1, nil
+	}
+	return records[0].GetInt("number") + 1, nil
+}
+
+// FindOverlappingZReport returns an issued report whose period overlaps with the given one, or nil if there is none.
+func FindOverlappingZReport(app core.App, start, end types.DateTime) (*core.Record, error) {
+	records, err := app.FindRecordsByFilter(
+		zReportTableName,
+		"start < {:end} && end > {:start}",
+		"number",
+		1,
+		0,
+		dbx.Params{"start": start.String(), "end": end.String()},
+	)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return records[0], nil
+}
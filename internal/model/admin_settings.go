@@ -0,0 +1,58 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// AdminSettingsCollection is the name of the collection holding the settings of the admin UI.
+// Only its first record is used.
+const AdminSettingsCollection = "admin_settings"
+
+// AdminSettings holds the configuration of the restaurant as JSON, see AdminConfig.
+type AdminSettings struct {
+	Id      string         `json:"id"`
+	Config  types.JSONRaw  `json:"config"`
+	Created types.DateTime `json:"created"`
+	Updated types.DateTime `json:"updated"`
+}
+
+// AdminSettingsFromRecord converts an "admin_settings" record.
+func AdminSettingsFromRecord(record *core.Record) AdminSettings {
+	return AdminSettings{
+		Id:      record.Id,
+		Config:  jsonRaw(record, "config"),
+		Created: record.GetDateTime("created"),
+		Updated: record.GetDateTime("updated"),
+	}
+}
+
+// AdminConfig are the parts of the config of the admin settings used by the backend.
+// Other keys of the config belong to the frontends.
+type AdminConfig struct {
+	Receipt ReceiptConfig `json:"receipt"`
+}
+
+// ReceiptConfig configures the receipts of payments.
+type ReceiptConfig struct {
+	// Header and Footer are printed centered above and below the items, lines are separated by "\n".
+	Header string `json:"header"`
+	Footer string `json:"footer"`
+	// Columns is the number of characters per line of the receipt printer, printing.DefaultColumns if not set.
+	Columns int `json:"columns"`
+}
+
+// ParseConfig returns the config, an empty config is returned for settings without one.
+func (s AdminSettings) ParseConfig() (AdminConfig, error) {
+	var config AdminConfig
+	if len(s.Config) == 0 || string(s.Config) == "null" {
+		return config, nil
+	}
+	if err := json.Unmarshal(s.Config, &config); err != nil {
+		return config, fmt.Errorf("invalid admin settings config: %w", err)
+	}
+	return config, nil
+}
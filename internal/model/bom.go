@@ -0,0 +1,80 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Types of a BOM template and of its groups.
+const (
+	// BomFixed templates consist of their fixed products plus the products chosen in their groups.
+	BomFixed = "Fixed"
+	// BomChoice groups require choosing exactly Count of their options, e.g. one of the fillings.
+	BomChoice = "Choice"
+	// BomOptional groups are add-ons, any of their options may be chosen.
+	BomOptional = "Optional"
+)
+
+// BomTemplate describes the products a menu item is made of, e.g.
+//
+//	{"type": "Fixed", "products": ["dough"], "groups": [
+//		{"type": "Choice", "name": "Füllung", "count": 1, "options": [{"product": "nutella"}, {"product": "apple"}]},
+//		{"type": "Optional", "name": "Extras", "options": [{"product": "cream", "price_delta": 50}]}
+//	]}
+type BomTemplate struct {
+	Type string `json:"type"`
+	// Products are part of every order item of the menu item.
+	Products []string   `json:"products"`
+	Groups   []BomGroup `json:"groups,omitempty"`
+}
+
+// BomGroup is a choice or the add-ons of a BOM template.
+type BomGroup struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// Count is the number of options to choose in a BomChoice group, 1 if not set.
+	Count   int         `json:"count,omitempty"`
+	Options []BomOption `json:"options"`
+}
+
+// BomOption is a product which can be chosen in a BOM group.
+type BomOption struct {
+	Product string `json:"product"`
+	// PriceDelta is added to the price of the menu item when the option is chosen, in cents.
+	PriceDelta float64 `json:"price_delta,omitempty"`
+}
+
+// ChoiceCount returns the number of options to choose in a BomChoice group.
+func (g BomGroup) ChoiceCount() int {
+	if g.Count <= 0 {
+		return 1
+	}
+	return g.Count
+}
+
+// AllProducts returns the fixed products and the options of all groups.
+func (t BomTemplate) AllProducts() []string {
+	products := append([]string{}, t.Products...)
+	for _, group := range t.Groups {
+		for _, option := range group.Options {
+			products = append(products, option.Product)
+		}
+	}
+	return products
+}
+
+// ParseBomTemplate returns the BOM template of the menu item, an empty template is returned for menu items without one.
+// Unknown fields are rejected, so misspelled templates do not silently lose their groups.
+func (m MenuItem) ParseBomTemplate() (BomTemplate, error) {
+	var template BomTemplate
+	if len(m.BomTemplate) == 0 || string(m.BomTemplate) == "null" {
+		return template, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(m.BomTemplate))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&template); err != nil {
+		return template, fmt.Errorf("invalid bom template: %w", err)
+	}
+	return template, nil
+}
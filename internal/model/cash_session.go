@@ -0,0 +1,51 @@
+package model
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// CashSessionCollection is the name of the collection holding the cash drawer sessions of the waiters.
+const CashSessionCollection = "cash_session"
+
+// CashSession is the cash drawer of a waiter, from opening it with a float until counting it at the end of the shift.
+// The amounts are in cents like the payments.
+type CashSession struct {
+	Id           string  `json:"id"`
+	Waiter       string  `json:"waiter"`
+	OpeningFloat float64 `json:"opening_float"`
+	// Closed is empty while the session is open.
+	Closed types.DateTime `json:"closed"`
+	// CashTotal and CashTips are the totals and tips of the cash payments of the session, set when closing it.
+	CashTotal float64 `json:"cash_total"`
+	CashTips  float64 `json:"cash_tips"`
+	// ExpectedAmount is what should be in the drawer: the opening float, the cash totals and the tips.
+	ExpectedAmount float64 `json:"expected_amount"`
+	CountedAmount  float64 `json:"counted_amount"`
+	// Difference is the counted minus the expected amount, positive if the drawer is over, negative if it is short.
+	Difference float64        `json:"difference"`
+	Created    types.DateTime `json:"created"`
+	Updated    types.DateTime `json:"updated"`
+}
+
+// IsOpen reports whether the session was not closed yet.
+func (s CashSession) IsOpen() bool {
+	return s.Closed.IsZero()
+}
+
+// CashSessionFromRecord converts a "cash_session" record.
+func CashSessionFromRecord(record *core.Record) CashSession {
+	return CashSession{
+		Id:             record.Id,
+		Waiter:         record.GetString("waiter"),
+		OpeningFloat:   record.GetFloat("opening_float"),
+		Closed:         record.GetDateTime("closed"),
+		CashTotal:      record.GetFloat("cash_total"),
+		CashTips:       record.GetFloat("cash_tips"),
+		ExpectedAmount: record.GetFloat("expected_amount"),
+		CountedAmount:  record.GetFloat("counted_amount"),
+		Difference:     record.GetFloat("difference"),
+		Created:        record.GetDateTime("created"),
+		Updated:        record.GetDateTime("updated"),
+	}
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// EventCollection is the name of the collection holding the events.
+const EventCollection = "event"
+
+// Event records a change of an order, order item, payment or product.
+// Content holds the type specific payload, e.g. {"order_id": "...", "status": "..."}.
+type Event struct {
+	Id      string         `json:"id"`
+	Type    string         `json:"type"`
+	Content types.JSONRaw  `json:"content"`
+	Created types.DateTime `json:"created"`
+	Updated types.DateTime `json:"updated"`
+}
+
+// EventFromRecord converts an "event" record.
+func EventFromRecord(record *core.Record) Event {
+	return Event{
+		Id:      record.Id,
+		Type:    record.GetString("type"),
+		Content: jsonRaw(record, "content"),
+		Created: record.GetDateTime("created"),
+		Updated: record.GetDateTime("updated"),
+	}
+}
+
+// ContentString returns a string value of the content, e.g. ContentString("order_id").
+// An empty string is returned for missing keys and malformed content.
+func (e Event) ContentString(key string) string {
+	var content map[string]interface{}
+	if err := json.Unmarshal(e.Content, &content); err != nil {
+		return ""
+	}
+	s, _ := content[key].(string)
+	return s
+}
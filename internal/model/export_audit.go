@@ -0,0 +1,44 @@
+package model
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// ExportAuditCollection is the name of the collection recording who exported the sales data.
+const ExportAuditCollection = "export_audit"
+
+// Formats of an export.
+const (
+	ExportFormatJSON = "json"
+	ExportFormatCSV  = "csv"
+	ExportFormatXLSX = "xlsx"
+)
+
+// ExportAudit records a single export of the sales data.
+type ExportAudit struct {
+	Id string `json:"id"`
+	// User is the user who exported the data, empty for exports of superusers.
+	User string `json:"user"`
+	// Superuser is the email of the superuser who exported the data.
+	Superuser string         `json:"superuser"`
+	Format    string         `json:"format"`
+	Start     types.DateTime `json:"start"`
+	End       types.DateTime `json:"end"`
+	IP        string         `json:"ip"`
+	Created   types.DateTime `json:"created"`
+}
+
+// ExportAuditFromRecord converts an "export_audit" record.
+func ExportAuditFromRecord(record *core.Record) ExportAudit {
+	return ExportAudit{
+		Id:        record.Id,
+		User:      record.GetString("user"),
+		Superuser: record.GetString("superuser"),
+		Format:    record.GetString("format"),
+		Start:     record.GetDateTime("start"),
+		End:       record.GetDateTime("end"),
+		IP:        record.GetString("ip"),
+		Created:   record.GetDateTime("created"),
+	}
+}
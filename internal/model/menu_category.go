@@ -0,0 +1,31 @@
+package model
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// MenuCategoryCollection is the name of the collection holding the categories of the menu.
+const MenuCategoryCollection = "menu_categ"
+
+// MenuCategory groups menu items, e.g. "Crepes" below "Essen".
+type MenuCategory struct {
+	Id          string         `json:"id"`
+	Name        string         `json:"name"`
+	ParentCateg string         `json:"parent_categ"`
+	Icon        string         `json:"icon"`
+	Created     types.DateTime `json:"created"`
+	Updated     types.DateTime `json:"updated"`
+}
+
+// MenuCategoryFromRecord converts a "menu_categ" record.
+func MenuCategoryFromRecord(record *core.Record) MenuCategory {
+	return MenuCategory{
+		Id:          record.Id,
+		Name:        record.GetString("name"),
+		ParentCateg: record.GetString("parent_categ"),
+		Icon:        record.GetString("icon"),
+		Created:     record.GetDateTime("created"),
+		Updated:     record.GetDateTime("updated"),
+	}
+}
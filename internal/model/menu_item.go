@@ -0,0 +1,60 @@
+package model
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// MenuItemCollection is the name of the collection holding the menu items.
+const MenuItemCollection = "menu_item"
+
+// MenuItem is an orderable item of the menu.
+type MenuItem struct {
+	Id    string  `json:"id"`
+	Name  string  `json:"name"`
+	Price float64 `json:"price"`
+	// BomTemplate describes the products the menu item is made of.
+	BomTemplate types.JSONRaw `json:"bom_template"`
+	Category    string        `json:"category"`
+	Icon        string        `json:"icon"`
+	Station     string        `json:"station"`
+	Disabled    bool          `json:"disabled"`
+	// Available is false while the menu item is disabled or a product of its BOM template is unavailable,
+	// DisabledReason tells why. Both are maintained by the menu item hooks.
+	Available      bool           `json:"available"`
+	DisabledReason string         `json:"disabled_reason"`
+	Created        types.DateTime `json:"created"`
+	Updated        types.DateTime `json:"updated"`
+}
+
+// MenuItemFromRecord converts a "menu_item" record.
+func MenuItemFromRecord(record *core.Record) MenuItem {
+	return MenuItem{
+		Id:             record.Id,
+		Name:           record.GetString("name"),
+		Price:          record.GetFloat("price"),
+		BomTemplate:    jsonRaw(record, "bom_template"),
+		Category:       record.GetString("category"),
+		Icon:           record.GetString("icon"),
+		Station:        record.GetString("station"),
+		Disabled:       record.GetBool("disabled"),
+		Available:      record.GetBool("available"),
+		DisabledReason: record.GetString("disabled_reason"),
+		Created:        record.GetDateTime("created"),
+		Updated:        record.GetDateTime("updated"),
+	}
+}
+
+// jsonRaw returns the value of a json field.
+func jsonRaw(record *core.Record, field string) types.JSONRaw {
+	switch v := record.Get(field).(type) {
+	case types.JSONRaw:
+		return v
+	case []byte:
+		return types.JSONRaw(v)
+	case string:
+		return types.JSONRaw(v)
+	default:
+		return nil
+	}
+}
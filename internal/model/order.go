@@ -0,0 +1,37 @@
+package model
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// OrderCollection is the name of the collection holding orders.
+const OrderCollection = "order"
+
+// Order is an order placed by a waiter for a table.
+type Order struct {
+	Id    string  `json:"id"`
+	Table float64 `json:"table"`
+	// DiningTable is the table record with the number Table, kept in sync by the table hooks.
+	DiningTable string `json:"dining_table"`
+	Waiter      string `json:"waiter"`
+	Status      string `json:"status"`
+	// Person is the number of guests the order was placed for.
+	Person  int            `json:"person"`
+	Created types.DateTime `json:"created"`
+	Updated types.DateTime `json:"updated"`
+}
+
+// OrderFromRecord converts an "order" record.
+func OrderFromRecord(record *core.Record) Order {
+	return Order{
+		Id:          record.Id,
+		Table:       record.GetFloat("table"),
+		DiningTable: record.GetString("dining_table"),
+		Waiter:      record.GetString("waiter"),
+		Status:      record.GetString("status"),
+		Person:      record.GetInt("person"),
+		Created:     record.GetDateTime("created"),
+		Updated:     record.GetDateTime("updated"),
+	}
+}
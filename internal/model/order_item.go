@@ -0,0 +1,52 @@
+package model
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// OrderItemCollection is the name of the collection holding order items.
+const OrderItemCollection = "order_item"
+
+// OrderItem is a single ordered menu item of an order.
+type OrderItem struct {
+	Id       string  `json:"id"`
+	Order    string  `json:"order"`
+	MenuItem string  `json:"menu_item"`
+	Price    float64 `json:"price"`
+	Status   string  `json:"status"`
+	Notes    string  `json:"notes"`
+	// Products are the products (the BOM) the order item is made of.
+	Products []string `json:"products"`
+	// StationStatus is the progress of every station involved in the order item by station id.
+	// The status of the order item is the one of the slowest station.
+	StationStatus map[string]string `json:"station_status"`
+	Created       types.DateTime    `json:"created"`
+	Updated       types.DateTime    `json:"updated"`
+}
+
+// OrderItemFromRecord converts an "order_item" record.
+func OrderItemFromRecord(record *core.Record) OrderItem {
+	return OrderItem{
+		Id:            record.Id,
+		Order:         record.GetString("order"),
+		MenuItem:      record.GetString("menu_item"),
+		Price:         record.GetFloat("price"),
+		Status:        record.GetString("status"),
+		Notes:         record.GetString("notes"),
+		Products:      record.GetStringSlice("products"),
+		StationStatus: stationStatus(record),
+		Created:       record.GetDateTime("created"),
+		Updated:       record.GetDateTime("updated"),
+	}
+}
+
+// stationStatus returns the "station_status" of an order item record,
+// order items created before the field existed have none.
+func stationStatus(record *core.Record) map[string]string {
+	var stationStatus map[string]string
+	if err := record.UnmarshalJSONField("station_status", &stationStatus); err != nil {
+		return nil
+	}
+	return stationStatus
+}
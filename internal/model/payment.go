@@ -0,0 +1,74 @@
+package model
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// PaymentCollection is the name of the collection holding payments.
+	PaymentCollection = "payment"
+	// PaymentOptionCollection is the name of the collection holding the payment options (e.g. "Bar").
+	PaymentOptionCollection = "payment_option"
+)
+
+// PaymentOptionCash is the name of the payment option for cash payments, as created by the payment option migration.
+const PaymentOptionCash = "Bar"
+
+// Payment is a payment covering some order items.
+// The amounts are in cents, TotalAmount is SubtotalAmount (the sum of the order item prices) minus DiscountAmount,
+// TipAmount comes on top.
+type Payment struct {
+	Id              string   `json:"id"`
+	SubtotalAmount  float64  `json:"subtotal_amount"`
+	DiscountAmount  float64  `json:"discount_amount"`
+	TotalAmount     float64  `json:"total_amount"`
+	TipAmount       float64  `json:"tip_amount"`
+	DiscountPercent float64  `json:"discount_percent"`
+	PaymentOption   string   `json:"payment_option"`
+	OrderItems      []string `json:"order_items"`
+	// Person is the guest of the order the payment was made by.
+	Person int `json:"person"`
+	// CashSession is the cash drawer session of a cash payment.
+	CashSession string         `json:"cash_session"`
+	Created     types.DateTime `json:"created"`
+	Updated     types.DateTime `json:"updated"`
+}
+
+// PaymentFromRecord converts a "payment" record.
+func PaymentFromRecord(record *core.Record) Payment {
+	return Payment{
+		Id:              record.Id,
+		SubtotalAmount:  record.GetFloat("subtotal_amount"),
+		DiscountAmount:  record.GetFloat("discount_amount"),
+		TotalAmount:     record.GetFloat("total_amount"),
+		TipAmount:       record.GetFloat("tip_amount"),
+		DiscountPercent: record.GetFloat("discount_percent"),
+		PaymentOption:   record.GetString("payment_option"),
+		OrderItems:      record.GetStringSlice("order_items"),
+		Person:          record.GetInt("person"),
+		CashSession:     record.GetString("cash_session"),
+		Created:         record.GetDateTime("created"),
+		Updated:         record.GetDateTime("updated"),
+	}
+}
+
+// PaymentOption is a way of paying, e.g. cash ("Bar") or card ("Karte").
+type PaymentOption struct {
+	Id      string         `json:"id"`
+	Name    string         `json:"name"`
+	Details string         `json:"details"`
+	Created types.DateTime `json:"created"`
+	Updated types.DateTime `json:"updated"`
+}
+
+// PaymentOptionFromRecord converts a "payment_option" record.
+func PaymentOptionFromRecord(record *core.Record) PaymentOption {
+	return PaymentOption{
+		Id:      record.Id,
+		Name:    record.GetString("name"),
+		Details: record.GetString("details"),
+		Created: record.GetDateTime("created"),
+		Updated: record.GetDateTime("updated"),
+	}
+}
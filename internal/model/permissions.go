@@ -0,0 +1,133 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Capability is something the staff may do. Collection rules are generated from the capabilities
+// of the roles instead of naming the roles themselves, see CollectionRules.
+type Capability string
+
+const (
+	// CapViewMenu allows to read the menu, i.e. menu items, categories, products and stations.
+	CapViewMenu Capability = "view_menu"
+	// CapManageMenu allows to change the menu.
+	CapManageMenu Capability = "manage_menu"
+	// CapManageStaff allows to read the roles of the staff.
+	CapManageStaff Capability = "manage_staff"
+	// CapManageSettings allows to read and change the admin settings.
+	CapManageSettings Capability = "manage_settings"
+	// CapViewOrders allows to read orders and order items.
+	CapViewOrders Capability = "view_orders"
+	// CapTakeOrders allows to create orders and order items and to read their kitchen tickets.
+	CapTakeOrders Capability = "take_orders"
+	// CapUpdateOrders allows to update orders and order items, e.g. their status.
+	// Which status may be set is checked by the status hooks.
+	CapUpdateOrders Capability = "update_orders"
+	// CapDeleteOrders allows to delete orders and order items.
+	CapDeleteOrders Capability = "delete_orders"
+	// CapTakePayments allows to take payments and to read the cash sessions.
+	CapTakePayments Capability = "take_payments"
+	// CapViewReports allows to read the Z-reports.
+	CapViewReports Capability = "view_reports"
+	// CapIssueReports allows to issue a Z-report, which closes the reported period for good.
+	CapIssueReports Capability = "issue_reports"
+	// CapManageTables allows to change the tables and the floor plan.
+	CapManageTables Capability = "manage_tables"
+	// CapExportData allows to export the sales data and to read the export audit.
+	CapExportData Capability = "export_data"
+)
+
+// RoleCapabilities are the capabilities of the roles created by the user role migration.
+var RoleCapabilities = map[string][]Capability{
+	RoleKuechenchef: {
+		CapViewMenu, CapManageMenu, CapManageStaff, CapManageSettings,
+		CapViewOrders, CapTakeOrders, CapUpdateOrders, CapDeleteOrders,
+		CapTakePayments, CapViewReports, CapIssueReports, CapExportData, CapManageTables,
+	},
+	RoleKellner: {
+		CapViewMenu,
+		CapViewOrders, CapTakeOrders, CapUpdateOrders,
+		CapTakePayments, CapViewReports,
+	},
+	RoleKueche: {
+		CapViewMenu,
+		CapViewOrders, CapUpdateOrders,
+	},
+}
+
+// Roles returns the names of all roles, sorted.
+func Roles() []string {
+	roles := make([]string, 0, len(RoleCapabilities))
+	for role := range RoleCapabilities {
+		roles = append(roles, role)
+	}
+	slices.Sort(roles)
+	return roles
+}
+
+// RoleHas reports whether the role has the capability.
+func RoleHas(role string, capability Capability) bool {
+	return slices.Contains(RoleCapabilities[role], capability)
+}
+
+// RolesWith returns the names of the roles with the capability, sorted.
+func RolesWith(capability Capability) []string {
+	var roles []string
+	for _, role := range Roles() {
+		if RoleHas(role, capability) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// Rule returns the API rule allowing authenticated users with a role with the capability.
+// No capability returns nil, which only allows superusers.
+func Rule(capability Capability) *string {
+	if capability == "" {
+		return nil
+	}
+	roles := RolesWith(capability)
+	if len(roles) == 0 {
+		panic(fmt.Sprintf("no role has the capability %q", capability))
+	}
+
+	conditions := make([]string, len(roles))
+	for i, role := range roles {
+		conditions[i] = fmt.Sprintf("@request.auth.role.role_name = %q", role)
+	}
+	return types.Pointer(fmt.Sprintf(`@request.auth.id != "" && (%s)`, strings.Join(conditions, " || ")))
+}
+
+// CollectionRule are the capabilities required by the API rules of a collection.
+// An empty capability only allows superusers.
+type CollectionRule struct {
+	List, View, Create, Update, Delete Capability
+}
+
+// CollectionRules are the API rules of the collections used by the staff. Collections written only
+// by the hooks or the API (e.g. "cash_session") have no create, update or delete capabilities.
+var CollectionRules = map[string]CollectionRule{
+	UserRoleCollection:         {List: CapManageStaff, View: CapManageStaff},
+	AdminSettingsCollection:    {List: CapManageSettings, View: CapManageSettings, Create: CapManageSettings, Update: CapManageSettings, Delete: CapManageSettings},
+	MenuCategoryCollection:     {List: CapViewMenu, View: CapViewMenu, Create: CapManageMenu, Update: CapManageMenu, Delete: CapManageMenu},
+	MenuItemCollection:         {List: CapViewMenu, View: CapViewMenu, Create: CapManageMenu, Update: CapManageMenu, Delete: CapManageMenu},
+	ProductCollection:          {List: CapViewMenu, View: CapViewMenu, Create: CapManageMenu, Update: CapManageMenu, Delete: CapManageMenu},
+	ProductAttributeCollection: {List: CapViewMenu, View: CapViewMenu, Create: CapManageMenu, Update: CapManageMenu, Delete: CapManageMenu},
+	ProductTypeCollection:      {List: CapViewMenu, View: CapViewMenu, Create: CapManageMenu, Update: CapManageMenu, Delete: CapManageMenu},
+	StationCollection:          {List: CapViewMenu, View: CapViewMenu, Create: CapManageMenu, Update: CapManageMenu, Delete: CapManageMenu},
+	OrderCollection:            {List: CapViewOrders, View: CapViewOrders, Create: CapTakeOrders, Update: CapUpdateOrders, Delete: CapDeleteOrders},
+	OrderItemCollection:        {List: CapViewOrders, View: CapViewOrders, Create: CapTakeOrders, Update: CapUpdateOrders, Delete: CapDeleteOrders},
+	PrintJobCollection:         {List: CapTakeOrders, View: CapTakeOrders},
+	PaymentCollection:          {List: CapTakePayments, View: CapTakePayments, Create: CapTakePayments, Update: CapTakePayments, Delete: CapTakePayments},
+	PaymentOptionCollection:    {List: CapTakePayments, View: CapTakePayments},
+	CashSessionCollection:      {List: CapTakePayments, View: CapTakePayments},
+	ZReportCollection:          {List: CapViewReports, View: CapViewReports},
+	ExportAuditCollection:      {List: CapExportData, View: CapExportData},
+	TableCollection:            {List: CapViewOrders, View: CapViewOrders, Create: CapManageTables, Update: CapManageTables, Delete: CapManageTables},
+}
@@ -0,0 +1,154 @@
+package model_test
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+	_ "github.com/supotsu-no-ochaya/backend/migrations"
+)
+
+const (
+	testDataDir = "../../testdata/v5/pb_data"
+	testUser    = "1p1725ql8j7u632"
+)
+
+func newTestApp(tb testing.TB) *tests.TestApp {
+	tb.Helper()
+	app, err := tests.NewTestApp(testDataDir)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(app.Cleanup)
+	return app
+}
+
+var roleNameRule = regexp.MustCompile(`role_name\s*(?:!?[=~]|\?=)\s*"([^"]*)"`)
+
+func TestCollectionRulesReferenceExistingRoles(t *testing.T) {
+	app := newTestApp(t)
+
+	var roles []string
+	records, err := app.FindAllRecords(model.UserRoleCollection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		roles = append(roles, model.UserRoleFromRecord(record).RoleName)
+	}
+	for _, role := range model.Roles() {
+		if !slices.Contains(roles, role) {
+			t.Errorf("the role %q of the permission model does not exist", role)
+		}
+	}
+
+	collections, err := app.FindAllCollections()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, collection := range collections {
+		rules := map[string]*string{
+			"listRule":   collection.ListRule,
+			"viewRule":   collection.ViewRule,
+			"createRule": collection.CreateRule,
+			"updateRule": collection.UpdateRule,
+			"deleteRule": collection.DeleteRule,
+		}
+		for name, rule := range rules {
+			if rule == nil {
+				continue
+			}
+			for _, match := range roleNameRule.FindAllStringSubmatch(*rule, -1) {
+				if !slices.Contains(roles, match[1]) {
+					t.Errorf("%s.%s references the unknown role %q", collection.Name, name, match[1])
+				}
+			}
+		}
+	}
+}
+
+// The migrations keep copies of the generated rules, which have to follow the model.
+func TestCollectionRulesAreGenerated(t *testing.T) {
+	app := newTestApp(t)
+
+	for name, rule := range model.CollectionRules {
+		collection, err := app.FindCollectionByNameOrId(name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		assertRule(t, name+".listRule", collection.ListRule, model.Rule(rule.List))
+		assertRule(t, name+".viewRule", collection.ViewRule, model.Rule(rule.View))
+		assertRule(t, name+".createRule", collection.CreateRule, model.Rule(rule.Create))
+		assertRule(t, name+".updateRule", collection.UpdateRule, model.Rule(rule.Update))
+		assertRule(t, name+".deleteRule", collection.DeleteRule, model.Rule(rule.Delete))
+	}
+}
+
+func assertRule(tb testing.TB, name string, got, want *string) {
+	tb.Helper()
+	switch {
+	case got == nil && want == nil:
+	case got == nil || want == nil:
+		tb.Errorf("%s: got %v, want %v", name, got, want)
+	case *got != *want:
+		tb.Errorf("%s: got %q, want %q", name, *got, *want)
+	}
+}
+
+func TestKuechenchefCanManageSettings(t *testing.T) {
+	app := newTestApp(t)
+
+	settings := core.NewRecord(mustFindCollection(t, app, model.AdminSettingsCollection))
+	settings.Set("config", map[string]any{"receipt": map[string]any{}})
+	if err := app.Save(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []struct {
+		role string
+		want bool
+	}{
+		{model.RoleKuechenchef, true},
+		{model.RoleKellner, false},
+		{model.RoleKueche, false},
+	}
+	for _, s := range scenarios {
+		t.Run(s.role, func(t *testing.T) {
+			role, err := app.FindFirstRecordByData(model.UserRoleCollection, "role_name", s.role)
+			if err != nil {
+				t.Fatal(err)
+			}
+			user, err := app.FindRecordById(model.UserCollection, testUser)
+			if err != nil {
+				t.Fatal(err)
+			}
+			user.Set("role", role.Id)
+			if err := app.Save(user); err != nil {
+				t.Fatal(err)
+			}
+
+			info := &core.RequestInfo{Auth: user}
+			for _, rule := range []*string{settings.Collection().ViewRule, settings.Collection().UpdateRule} {
+				ok, err := app.CanAccessRecord(settings, info, rule)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok != s.want {
+					t.Errorf("expected access %v for %q, got %v", s.want, *rule, ok)
+				}
+			}
+		})
+	}
+}
+
+func mustFindCollection(tb testing.TB, app core.App, name string) *core.Collection {
+	tb.Helper()
+	collection, err := app.FindCollectionByNameOrId(name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return collection
+}
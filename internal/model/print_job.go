@@ -0,0 +1,53 @@
+package model
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// PrintJobCollection is the name of the collection holding the queued kitchen tickets.
+const PrintJobCollection = "print_job"
+
+// Statuses of a print job.
+const (
+	PrintJobPending = "pending"
+	PrintJobPrinted = "printed"
+	// PrintJobFailed jobs gave up after too many attempts, they are printed again with a reprint.
+	PrintJobFailed = "failed"
+)
+
+// PrintJob is a kitchen ticket with order items of an order for a station.
+type PrintJob struct {
+	Id         string   `json:"id"`
+	Station    string   `json:"station"`
+	Order      string   `json:"order"`
+	OrderItems []string `json:"order_items"`
+	// Reprint is set for tickets printed again on request, they are marked as such.
+	Reprint  bool   `json:"reprint"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	// NextAttempt is when the spooler prints the job (again).
+	NextAttempt types.DateTime `json:"next_attempt"`
+	LastError   string         `json:"last_error"`
+	Printed     types.DateTime `json:"printed"`
+	Created     types.DateTime `json:"created"`
+	Updated     types.DateTime `json:"updated"`
+}
+
+// PrintJobFromRecord converts a "print_job" record.
+func PrintJobFromRecord(record *core.Record) PrintJob {
+	return PrintJob{
+		Id:          record.Id,
+		Station:     record.GetString("station"),
+		Order:       record.GetString("order"),
+		OrderItems:  record.GetStringSlice("order_items"),
+		Reprint:     record.GetBool("reprint"),
+		Status:      record.GetString("status"),
+		Attempts:    record.GetInt("attempts"),
+		NextAttempt: record.GetDateTime("next_attempt"),
+		LastError:   record.GetString("last_error"),
+		Printed:     record.GetDateTime("printed"),
+		Created:     record.GetDateTime("created"),
+		Updated:     record.GetDateTime("updated"),
+	}
+}
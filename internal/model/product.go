@@ -0,0 +1,66 @@
+package model
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// ProductCollection is the name of the collection holding the products.
+	ProductCollection = "product"
+	// ProductAttributeCollection is the name of the collection holding product attributes (e.g. "vegan").
+	ProductAttributeCollection = "product_attribute"
+	// ProductTypeCollection is the name of the collection holding product types (e.g. "Mochi").
+	ProductTypeCollection = "product_type"
+)
+
+// Product is a single product menu items are made of.
+type Product struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	IsAvailable bool   `json:"is_available"`
+	// Station is the station preparing the product, see ProductStation.
+	Station   string   `json:"station"`
+	Attribute []string `json:"attribute"`
+	Type      string   `json:"type"`
+	// TrackStock enables the stock of the product, order items consume one of each of their products.
+	TrackStock bool `json:"track_stock"`
+	// Stock is the remaining quantity, the product becomes unavailable once it is used up.
+	Stock   int            `json:"stock"`
+	Created types.DateTime `json:"created"`
+	Updated types.DateTime `json:"updated"`
+}
+
+// ProductFromRecord converts a "product" record.
+func ProductFromRecord(record *core.Record) Product {
+	return Product{
+		Id:          record.Id,
+		Name:        record.GetString("name"),
+		IsAvailable: record.GetBool("is_available"),
+		Station:     record.GetString("station"),
+		Attribute:   record.GetStringSlice("attribute"),
+		Type:        record.GetString("type"),
+		TrackStock:  record.GetBool("track_stock"),
+		Stock:       record.GetInt("stock"),
+		Created:     record.GetDateTime("created"),
+		Updated:     record.GetDateTime("updated"),
+	}
+}
+
+// ProductAttribute is an attribute of a product, e.g. "vegan".
+type ProductAttribute struct {
+	Id      string         `json:"id"`
+	Name    string         `json:"name"`
+	Created types.DateTime `json:"created"`
+	Updated types.DateTime `json:"updated"`
+}
+
+// ProductAttributeFromRecord converts a "product_attribute" record.
+func ProductAttributeFromRecord(record *core.Record) ProductAttribute {
+	return ProductAttribute{
+		Id:      record.Id,
+		Name:    record.GetString("name"),
+		Created: record.GetDateTime("created"),
+		Updated: record.GetDateTime("updated"),
+	}
+}
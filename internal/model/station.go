@@ -0,0 +1,39 @@
+package model
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// StationCollection is the name of the collection holding the kitchen stations.
+const StationCollection = "station"
+
+// Station is a place in the kitchen preparing products, e.g. the grill.
+type Station struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	// Printer is the address of the kitchen printer of the station ("host" or "host:port"), empty without printer.
+	Printer string         `json:"printer"`
+	Created types.DateTime `json:"created"`
+	Updated types.DateTime `json:"updated"`
+}
+
+// StationFromRecord converts a "station" record.
+func StationFromRecord(record *core.Record) Station {
+	return Station{
+		Id:      record.Id,
+		Name:    record.GetString("name"),
+		Printer: record.GetString("printer"),
+		Created: record.GetDateTime("created"),
+		Updated: record.GetDateTime("updated"),
+	}
+}
+
+// ProductStation returns the station preparing the product as part of the menu item:
+// the station of the product itself or, for products without one, the station of the menu item.
+func ProductStation(product Product, menuItem MenuItem) string {
+	if product.Station != "" {
+		return product.Station
+	}
+	return menuItem.Station
+}
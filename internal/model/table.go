@@ -0,0 +1,37 @@
+package model
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// TableCollection is the name of the collection holding the tables of the restaurant.
+const TableCollection = "table"
+
+// Table is a table guests are seated at. Orders reference it by its number, see Order.
+type Table struct {
+	Id     string `json:"id"`
+	Number int    `json:"number"`
+	// Area is the part of the restaurant the table is in, e.g. "Terrasse".
+	Area  string `json:"area"`
+	Seats int    `json:"seats"`
+	// PositionX and PositionY place the table on the floor plan of its area.
+	PositionX float64        `json:"position_x"`
+	PositionY float64        `json:"position_y"`
+	Created   types.DateTime `json:"created"`
+	Updated   types.DateTime `json:"updated"`
+}
+
+// TableFromRecord converts a "table" record.
+func TableFromRecord(record *core.Record) Table {
+	return Table{
+		Id:        record.Id,
+		Number:    record.GetInt("number"),
+		Area:      record.GetString("area"),
+		Seats:     record.GetInt("seats"),
+		PositionX: record.GetFloat("position_x"),
+		PositionY: record.GetFloat("position_y"),
+		Created:   record.GetDateTime("created"),
+		Updated:   record.GetDateTime("updated"),
+	}
+}
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// UserCollection is the name of the auth collection holding the staff (waiters, kitchen, ...).
+const UserCollection = "users"
+
+// User is a member of the staff.
+// Only the public profile is part of it, auth fields like email are left out on purpose.
+type User struct {
+	Id       string `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	// Station is the station kitchen staff works at, empty for everybody else.
+	Station string `json:"station"`
+}
+
+// UserFromRecord converts a "users" record.
+func UserFromRecord(record *core.Record) User {
+	return User{
+		Id:       record.Id,
+		Username: record.GetString("username"),
+		Name:     record.GetString("name"),
+		Role:     record.GetString("role"),
+		Station:  record.GetString("station"),
+	}
+}
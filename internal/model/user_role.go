@@ -0,0 +1,29 @@
+package model
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// UserRoleCollection is the name of the collection holding the roles of the staff.
+const UserRoleCollection = "user_role"
+
+// Role names as created by the user role migration.
+const (
+	RoleKuechenchef = "Kuechenchef"
+	RoleKellner     = "Kellner"
+	RoleKueche      = "Kueche"
+)
+
+// UserRole is the role of a member of the staff, e.g. "Kellner".
+type UserRole struct {
+	Id       string `json:"id"`
+	RoleName string `json:"role_name"`
+}
+
+// UserRoleFromRecord converts a "user_role" record.
+func UserRoleFromRecord(record *core.Record) UserRole {
+	return UserRole{
+		Id:       record.Id,
+		RoleName: record.GetString("role_name"),
+	}
+}
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// ZReportCollection is the name of the collection holding the issued Z-reports.
+const ZReportCollection = "z_report"
+
+// ZReport is an issued daily closing report. Content holds the figures calculated when it was issued,
+// they are not recalculated afterwards.
+type ZReport struct {
+	Id string `json:"id"`
+	// Number is assigned sequentially when the report is issued, starting with 1.
+	Number  int            `json:"number"`
+	Start   types.DateTime `json:"start"`
+	End     types.DateTime `json:"end"`
+	Content types.JSONRaw  `json:"content"`
+	Created types.DateTime `json:"created"`
+}
+
+// ZReportFromRecord converts a "z_report" record.
+func ZReportFromRecord(record *core.Record) ZReport {
+	return ZReport{
+		Id:      record.Id,
+		Number:  record.GetInt("number"),
+		Start:   record.GetDateTime("start"),
+		End:     record.GetDateTime("end"),
+		Content: jsonRaw(record, "content"),
+		Created: record.GetDateTime("created"),
+	}
+}
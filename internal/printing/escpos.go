@@ -0,0 +1,38 @@
+package printing
+
+import (
+	"bytes"
+)
+
+// DefaultColumns fits 80 mm paper with the default font of most receipt printers.
+const DefaultColumns = 42
+
+// ESC/POS commands, see the Epson ESC/POS command reference.
+var (
+	escposInit = []byte{0x1b, '@'}
+	// code page 16 is Windows-1252, see EncodeWinAnsi
+	escposCodePageWinAnsi = []byte{0x1b, 't', 16}
+	escposBoldOn          = []byte{0x1b, 'E', 1}
+	escposBoldOff         = []byte{0x1b, 'E', 0}
+	// feed 4 lines, so the end of the text is above the cutter, then cut partially
+	escposFeedAndCut = []byte{0x1b, 'd', 4, 0x1d, 'V', 66, 0}
+)
+
+// ESCPOS encodes the text as ESC/POS print job for thermal printers, ending with a cut of the paper.
+func ESCPOS(text *Text) []byte {
+	var job bytes.Buffer
+	job.Write(escposInit)
+	job.Write(escposCodePageWinAnsi)
+	for _, line := range text.lines {
+		if line.Bold {
+			job.Write(escposBoldOn)
+		}
+		job.Write(EncodeWinAnsi(line.Text))
+		if line.Bold {
+			job.Write(escposBoldOff)
+		}
+		job.WriteByte('\n')
+	}
+	job.Write(escposFeedAndCut)
+	return job.Bytes()
+}
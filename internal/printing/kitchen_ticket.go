@@ -0,0 +1,72 @@
+package printing
+
+import (
+	"slices"
+	"strconv"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+// LayoutKitchenTicket lays out the ticket of the print job for its station: the table, the waiter and
+// the order items with the products the station prepares and their notes.
+// Order items deleted after the job was queued are left out.
+func LayoutKitchenTicket(app core.App, job model.PrintJob) (*Text, error) {
+	ticket := NewText(DefaultColumns)
+
+	stationRecord, err := app.FindRecordById(model.StationCollection, job.Station)
+	if err != nil {
+		return nil, err
+	}
+	station := model.StationFromRecord(stationRecord)
+	orderRecord, err := app.FindRecordById(model.OrderCollection, job.Order)
+	if err != nil {
+		return nil, err
+	}
+	order := model.OrderFromRecord(orderRecord)
+
+	ticket.BoldLine(station.Name)
+	if job.Reprint {
+		ticket.BoldLine("NACHDRUCK")
+	}
+	ticket.ColumnsLine("Tisch "+strconv.FormatFloat(order.Table, 'f', -1, 64), FormatTime(order.Created))
+	if waiterRecord, err := app.FindRecordById(model.UserCollection, order.Waiter); err == nil {
+		ticket.Line("Kellner: " + model.UserFromRecord(waiterRecord).Name)
+	}
+	ticket.Line("Bestellung " + order.Id)
+	ticket.Separator()
+
+	orderItemRecords, err := app.FindRecordsByIds(model.OrderItemCollection, job.OrderItems)
+	if err != nil {
+		return nil, err
+	}
+	// in the order the order items were queued
+	slices.SortFunc(orderItemRecords, func(a, b *core.Record) int {
+		return slices.Index(job.OrderItems, a.Id) - slices.Index(job.OrderItems, b.Id)
+	})
+	for _, orderItemRecord := range orderItemRecords {
+		orderItem := model.OrderItemFromRecord(orderItemRecord)
+		var menuItem model.MenuItem
+		if menuItemRecord, err := app.FindRecordById(model.MenuItemCollection, orderItem.MenuItem); err == nil {
+			menuItem = model.MenuItemFromRecord(menuItemRecord)
+		}
+
+		ticket.BoldLine(menuItem.Name)
+		productRecords, err := app.FindRecordsByIds(model.ProductCollection, orderItem.Products)
+		if err != nil {
+			return nil, err
+		}
+		for _, productRecord := range productRecords {
+			product := model.ProductFromRecord(productRecord)
+			if model.ProductStation(product, menuItem) == station.Id {
+				ticket.Line("  + " + product.Name)
+			}
+		}
+		if orderItem.Notes != "" {
+			ticket.Line("  ! " + orderItem.Notes)
+		}
+	}
+	ticket.Separator()
+
+	return ticket, nil
+}
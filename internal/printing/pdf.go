@@ -0,0 +1,163 @@
+package printing
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 in PDF points (1/72 inch).
+const (
+	A4Width  = 595.0
+	A4Height = 842.0
+)
+
+// PDFDocument is a minimal PDF writer for text documents like the Z-report. Lines are set in the standard
+// Courier fonts, so no font has to be embedded and columns can be aligned with spaces.
+// Text is encoded as WinAnsi, see EncodeWinAnsi.
+type PDFDocument struct {
+	*Text
+	title      string
+	pageWidth  float64
+	pageHeight float64
+	margin     float64
+	fontSize   float64
+}
+
+// NewPDFDocument returns an empty document with pages of the size, the lines fill the page between the margins.
+func NewPDFDocument(title string, pageWidth, pageHeight, margin, fontSize float64) *PDFDocument {
+	return &PDFDocument{
+		// Courier glyphs are 0.6 em wide
+		Text:       NewText(int((pageWidth - 2*margin) / (fontSize * 0.6))),
+		title:      title,
+		pageWidth:  pageWidth,
+		pageHeight: pageHeight,
+		margin:     margin,
+		fontSize:   fontSize,
+	}
+}
+
+// NewPDFRoll returns a document for the lines on a single page just wide and high enough for them,
+// like the paper roll of a receipt printer.
+func NewPDFRoll(title string, text *Text, margin, fontSize float64) *PDFDocument {
+	doc := &PDFDocument{
+		Text:     text,
+		title:    title,
+		margin:   margin,
+		fontSize: fontSize,
+	}
+	doc.pageWidth = float64(text.columns)*fontSize*0.6 + 2*margin
+	// one more line than needed, so rounding cannot push the last line to a second page
+	doc.pageHeight = float64(len(text.lines)+1)*doc.leading() + 2*margin
+	return doc
+}
+
+func (d *PDFDocument) leading() float64 {
+	return d.fontSize * 1.2
+}
+
+func (d *PDFDocument) linesPerPage() int {
+	return max(1, int((d.pageHeight-2*d.margin)/d.leading()))
+}
+
+// Write writes the document as PDF 1.4 with uncompressed content streams.
+func (d *PDFDocument) Write(w io.Writer) error {
+	var buf bytes.Buffer
+	var offsets []int
+	// objects are numbered in the order they are written, starting with 1
+	object := func(content string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), content)
+	}
+
+	pages := d.pages()
+	// 1 catalog, 2 page tree, 3 and 4 fonts, 5 info, then a page and its content stream per page
+	const firstPageObject = 6
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPageObject+2*i)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+	object(fmt.Sprintf("<< /Title (%s) /Producer (supotsu-no-ochaya) >>", pdfEscape(d.title)))
+
+	for i, lines := range pages {
+		object(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfNumber(d.pageWidth), pdfNumber(d.pageHeight), firstPageObject+2*i+1,
+		))
+		stream := d.contentStream(lines)
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// pages splits the lines into pages, a document always has at least one page.
+func (d *PDFDocument) pages() [][]Line {
+	perPage := d.linesPerPage()
+	pages := [][]Line{}
+	for start := 0; start < len(d.lines); start += perPage {
+		pages = append(pages, d.lines[start:min(start+perPage, len(d.lines))])
+	}
+	if len(pages) == 0 {
+		pages = append(pages, nil)
+	}
+	return pages
+}
+
+func (d *PDFDocument) contentStream(lines []Line) string {
+	var stream strings.Builder
+	// the first baseline is one font size below the top margin
+	fmt.Fprintf(&stream, "BT\n%s TL\n%s %s Td\n",
+		pdfNumber(d.leading()), pdfNumber(d.margin), pdfNumber(d.pageHeight-d.margin-d.fontSize))
+	font := ""
+	for _, line := range lines {
+		lineFont := "/F1"
+		if line.Bold {
+			lineFont = "/F2"
+		}
+		if lineFont != font {
+			fmt.Fprintf(&stream, "%s %s Tf\n", lineFont, pdfNumber(d.fontSize))
+			font = lineFont
+		}
+		fmt.Fprintf(&stream, "(%s) Tj T*\n", pdfEscape(line.Text))
+	}
+	stream.WriteString("ET")
+	return stream.String()
+}
+
+func pdfNumber(f float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.2f", f), "0"), ".")
+}
+
+// pdfEscape encodes the text as content of a PDF string literal, see EncodeWinAnsi.
+// Bytes outside of ASCII are written as octal escapes, so the content streams stay ASCII.
+func pdfEscape(text string) string {
+	var escaped strings.Builder
+	for _, b := range EncodeWinAnsi(text) {
+		switch {
+		case b == '\\' || b == '(' || b == ')':
+			escaped.WriteByte('\\')
+			escaped.WriteByte(b)
+		case b >= 0x20 && b < 0x7f:
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "\\%03o", b)
+		}
+	}
+	return escaped.String()
+}
@@ -0,0 +1,41 @@
+package printing
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// DefaultPrinterPort is the port of raw printing ("JetDirect"), which network thermal printers listen on.
+	DefaultPrinterPort = "9100"
+
+	printerTimeout = 10 * time.Second
+)
+
+// Send sends the print job to the printer at the address ("host" or "host:port") over raw TCP.
+func Send(ctx context.Context, address string, job []byte) error {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, DefaultPrinterPort)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, printerTimeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("cannot connect to printer %s: %w", address, err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetWriteDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	if _, err := conn.Write(job); err != nil {
+		return fmt.Errorf("cannot send print job to printer %s: %w", address, err)
+	}
+	return conn.Close()
+}
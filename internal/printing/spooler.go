@@ -0,0 +1,159 @@
+package printing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+)
+
+const (
+	spoolerInterval  = time.Second
+	spoolerBatchSize = 50
+
+	// a job is given up after maxPrintAttempts, the delay between the attempts doubles up to maxRetryDelay
+	maxPrintAttempts = 10
+	firstRetryDelay  = 5 * time.Second
+	maxRetryDelay    = 5 * time.Minute
+)
+
+// Spooler prints the queued print jobs on the printers of their stations and retries failed attempts
+// with a growing delay. The queue is the "print_job" collection, so it survives restarts.
+type Spooler struct {
+	app core.App
+}
+
+func NewSpooler(app core.App) *Spooler {
+	return &Spooler{app: app}
+}
+
+// RegisterSpooler runs a spooler while the app is serving.
+func RegisterSpooler(app core.App) {
+	app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		app.OnTerminate().BindFunc(func(e *core.TerminateEvent) error {
+			cancel()
+			return e.Next()
+		})
+		go NewSpooler(e.App).Run(ctx)
+		return e.Next()
+	})
+}
+
+// Run prints the due jobs every second until the context is done.
+func (s *Spooler) Run(ctx context.Context) {
+	ticker := time.NewTicker(spoolerInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.PrintDue(ctx, time.Now()); err != nil {
+				s.app.Logger().Error("Failed to print the due print jobs", "error", err)
+			}
+		}
+	}
+}
+
+// PrintDue prints the pending jobs which are due at now, oldest first.
+// Printer errors are stored with the jobs, only errors of the database are returned.
+func (s *Spooler) PrintDue(ctx context.Context, now time.Time) error {
+	nowDateTime, err := types.ParseDateTime(now)
+	if err != nil {
+		return err
+	}
+	records, err := s.app.FindRecordsByFilter(
+		model.PrintJobCollection,
+		"status = {:pending} && next_attempt <= {:now}",
+		"next_attempt,created",
+		spoolerBatchSize,
+		0,
+		dbx.Params{"pending": model.PrintJobPending, "now": nowDateTime.String()},
+	)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := s.print(ctx, record.Id, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// print claims the job by counting the attempt and moving the next attempt ahead before printing it.
+// From then on the kitchen ticket hooks no longer add order items to it, and if the backend stops
+// while printing the job is printed again after the retry delay.
+func (s *Spooler) print(ctx context.Context, jobId string, now time.Time) error {
+	var job model.PrintJob
+	claimed := false
+	err := s.app.RunInTransaction(func(txApp core.App) error {
+		record, err := txApp.FindRecordById(model.PrintJobCollection, jobId)
+		if err != nil {
+			return err
+		}
+		job = model.PrintJobFromRecord(record)
+		if job.Status != model.PrintJobPending || job.NextAttempt.Time().After(now) {
+			return nil
+		}
+
+		job.Attempts++
+		record.Set("attempts", job.Attempts)
+		record.Set("next_attempt", now.Add(retryDelay(job.Attempts)))
+		claimed = true
+		return txApp.Save(record)
+	})
+	if err != nil || !claimed {
+		return err
+	}
+
+	printErr := s.send(ctx, job)
+
+	record, err := s.app.FindRecordById(model.PrintJobCollection, jobId)
+	if err != nil {
+		return err
+	}
+	if printErr == nil {
+		record.Set("status", model.PrintJobPrinted)
+		record.Set("printed", now)
+		record.Set("last_error", "")
+	} else {
+		s.app.Logger().Warn("Failed to print kitchen ticket", "printJob", jobId, "attempt", job.Attempts, "error", printErr)
+		record.Set("last_error", printErr.Error())
+		if job.Attempts >= maxPrintAttempts {
+			record.Set("status", model.PrintJobFailed)
+		}
+	}
+	return s.app.Save(record)
+}
+
+func (s *Spooler) send(ctx context.Context, job model.PrintJob) error {
+	stationRecord, err := s.app.FindRecordById(model.StationCollection, job.Station)
+	if err != nil {
+		return err
+	}
+	station := model.StationFromRecord(stationRecord)
+	if station.Printer == "" {
+		return fmt.Errorf("station %s has no printer", station.Name)
+	}
+
+	ticket, err := LayoutKitchenTicket(s.app, job)
+	if err != nil {
+		return err
+	}
+	return Send(ctx, station.Printer, ESCPOS(ticket))
+}
+
+// retryDelay returns the delay after the attempt, doubling from firstRetryDelay up to maxRetryDelay.
+func retryDelay(attempts int) time.Duration {
+	delay := firstRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
@@ -0,0 +1,239 @@
+package printing
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/supotsu-no-ochaya/backend/internal/hooks"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
+	_ "github.com/supotsu-no-ochaya/backend/migrations"
+)
+
+const testDataDir = "../../testdata/v5/pb_data"
+
+const (
+	testStationCrepes = "7kbm0uq66x72736"
+	testOrder         = "hvfhh05zbr323h5"
+	testMenuItemCrepe = "o0u30w3s7f74aa5"
+	testProductCrepe  = "40q2m010uf0uoy8"
+)
+
+// fakePrinter is a network printer on a local port, it hands out what it received per connection.
+type fakePrinter struct {
+	listener net.Listener
+	jobs     chan []byte
+}
+
+func newFakePrinter(tb testing.TB) *fakePrinter {
+	tb.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	printer := &fakePrinter{listener: listener, jobs: make(chan []byte, 10)}
+	tb.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			job, _ := io.ReadAll(conn)
+			conn.Close()
+			printer.jobs <- job
+		}
+	}()
+	return printer
+}
+
+func (p *fakePrinter) address() string {
+	return p.listener.Addr().String()
+}
+
+func (p *fakePrinter) receive(tb testing.TB) []byte {
+	tb.Helper()
+	select {
+	case job := <-p.jobs:
+		return job
+	case <-time.After(5 * time.Second):
+		tb.Fatal("the printer received no print job")
+		return nil
+	}
+}
+
+// closedAddress returns a local address nothing listens on.
+func closedAddress(tb testing.TB) string {
+	tb.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+func newTestApp(tb testing.TB) *tests.TestApp {
+	tb.Helper()
+	app, err := tests.NewTestApp(testDataDir)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(app.Cleanup)
+	hooks.RegisterOrderItemHooks(app)
+	hooks.RegisterKitchenTicketHooks(app)
+	return app
+}
+
+func setStationPrinter(tb testing.TB, app core.App, printer string) {
+	tb.Helper()
+	record, err := app.FindRecordById(model.StationCollection, testStationCrepes)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	record.Set("printer", printer)
+	if err := app.Save(record); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// newCrepe creates an order item of a crepe, which queues a kitchen ticket for the crepes station.
+func newCrepe(tb testing.TB, app core.App, notes string) *core.Record {
+	tb.Helper()
+	collection, err := app.FindCollectionByNameOrId(model.OrderItemCollection)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	record := core.NewRecord(collection)
+	record.Load(map[string]any{
+		"order":     testOrder,
+		"price":     321,
+		"status":    "Aufgegeben",
+		"menu_item": testMenuItemCrepe,
+		"products":  []string{testProductCrepe},
+		"notes":     notes,
+	})
+	if err := app.Save(record); err != nil {
+		tb.Fatal(err)
+	}
+	return record
+}
+
+func findPrintJob(tb testing.TB, app core.App) model.PrintJob {
+	tb.Helper()
+	records, err := app.FindAllRecords(model.PrintJobCollection)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if len(records) != 1 {
+		tb.Fatalf("expected 1 print job, got %d", len(records))
+	}
+	return model.PrintJobFromRecord(records[0])
+}
+
+func TestSpoolerPrintsKitchenTickets(t *testing.T) {
+	app := newTestApp(t)
+	printer := newFakePrinter(t)
+	setStationPrinter(t, app, printer.address())
+
+	newCrepe(t, app, "ohne Sahne")
+	newCrepe(t, app, "")
+	spooler := NewSpooler(app)
+
+	// the ticket waits for further order items of the order
+	if err := spooler.PrintDue(context.Background(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if job := findPrintJob(t, app); job.Attempts != 0 {
+		t.Fatalf("expected the print job not to be due yet, got %d attempts", job.Attempts)
+	}
+
+	if err := spooler.PrintDue(context.Background(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	received := printer.receive(t)
+	for _, expected := range []string{"Crepes", "Tisch 1", "Kellner: Test", "  ! ohne Sahne", "\x1dVB\x00"} {
+		if !bytes.Contains(received, []byte(expected)) {
+			t.Errorf("expected the ticket to contain %q, got %q", expected, received)
+		}
+	}
+	if count := bytes.Count(received, []byte("  + ")); count != 2 {
+		t.Errorf("expected the products of 2 order items, got %d in %q", count, received)
+	}
+
+	job := findPrintJob(t, app)
+	if job.Status != model.PrintJobPrinted || job.Attempts != 1 || job.Printed.IsZero() {
+		t.Errorf("expected the print job to be printed at the first attempt, got %+v", job)
+	}
+}
+
+func TestSpoolerRetriesFailedPrintJobs(t *testing.T) {
+	app := newTestApp(t)
+	setStationPrinter(t, app, closedAddress(t))
+	newCrepe(t, app, "")
+	spooler := NewSpooler(app)
+
+	now := time.Now().Add(time.Minute)
+	if err := spooler.PrintDue(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	job := findPrintJob(t, app)
+	if job.Status != model.PrintJobPending || job.Attempts != 1 || !strings.Contains(job.LastError, "cannot connect") {
+		t.Fatalf("expected the print job to be retried, got %+v", job)
+	}
+	if !job.NextAttempt.Time().Equal(now.Add(firstRetryDelay).Truncate(time.Millisecond)) {
+		t.Errorf("expected the next attempt at %s, got %s", now.Add(firstRetryDelay), job.NextAttempt)
+	}
+
+	// the printer is back before the retry
+	printer := newFakePrinter(t)
+	setStationPrinter(t, app, printer.address())
+	if err := spooler.PrintDue(context.Background(), now.Add(firstRetryDelay)); err != nil {
+		t.Fatal(err)
+	}
+	printer.receive(t)
+	job = findPrintJob(t, app)
+	if job.Status != model.PrintJobPrinted || job.Attempts != 2 || job.LastError != "" {
+		t.Errorf("expected the print job to be printed at the second attempt, got %+v", job)
+	}
+}
+
+func TestSpoolerGivesUpAfterMaxAttempts(t *testing.T) {
+	app := newTestApp(t)
+	setStationPrinter(t, app, closedAddress(t))
+	newCrepe(t, app, "")
+	spooler := NewSpooler(app)
+
+	now := time.Now()
+	for range maxPrintAttempts + 1 {
+		now = now.Add(maxRetryDelay)
+		if err := spooler.PrintDue(context.Background(), now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	job := findPrintJob(t, app)
+	if job.Status != model.PrintJobFailed || job.Attempts != maxPrintAttempts {
+		t.Errorf("expected the print job to fail after %d attempts, got %+v", maxPrintAttempts, job)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempts, expected := range map[int]time.Duration{
+		1:  5 * time.Second,
+		2:  10 * time.Second,
+		4:  40 * time.Second,
+		7:  maxRetryDelay,
+		10: maxRetryDelay,
+	} {
+		if got := retryDelay(attempts); got != expected {
+			t.Errorf("expected a delay of %s after %d attempts, got %s", expected, attempts, got)
+		}
+	}
+}
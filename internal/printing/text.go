@@ -0,0 +1,128 @@
+package printing
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Text lays out monospaced text with a fixed number of columns,
+// for PDF documents as well as for receipt and kitchen printers.
+type Text struct {
+	columns int
+	lines   []Line
+}
+
+// Line is a line of a Text.
+type Line struct {
+	Text string
+	Bold bool
+}
+
+// NewText returns an empty text with the number of characters per line.
+func NewText(columns int) *Text {
+	return &Text{columns: columns}
+}
+
+// Columns returns the number of characters per line.
+func (t *Text) Columns() int {
+	return t.columns
+}
+
+// Lines returns the lines of the text.
+func (t *Text) Lines() []Line {
+	return t.lines
+}
+
+// Line adds a line of text, text longer than the line is wide is wrapped.
+func (t *Text) Line(text string) {
+	t.addLine(text, false)
+}
+
+// BoldLine adds a line of bold text, e.g. a heading.
+func (t *Text) BoldLine(text string) {
+	t.addLine(text, true)
+}
+
+// CenteredLine adds a line with the text in the middle.
+func (t *Text) CenteredLine(text string) {
+	padding := (t.columns - len([]rune(text))) / 2
+	if padding < 0 {
+		padding = 0
+	}
+	t.Line(strings.Repeat(" ", padding) + text)
+}
+
+// ColumnsLine adds a line with the left text left aligned and the right text right aligned.
+func (t *Text) ColumnsLine(left, right string) {
+	t.Line(alignColumns(t.columns, left, right))
+}
+
+// BoldColumnsLine is like ColumnsLine with bold text, e.g. for a total.
+func (t *Text) BoldColumnsLine(left, right string) {
+	t.BoldLine(alignColumns(t.columns, left, right))
+}
+
+// Separator adds a line of dashes across the width.
+func (t *Text) Separator() {
+	t.Line(strings.Repeat("-", t.columns))
+}
+
+func (t *Text) addLine(text string, bold bool) {
+	runes := []rune(text)
+	for t.columns > 0 && len(runes) > t.columns {
+		t.lines = append(t.lines, Line{Text: string(runes[:t.columns]), Bold: bold})
+		runes = runes[t.columns:]
+	}
+	t.lines = append(t.lines, Line{Text: string(runes), Bold: bold})
+}
+
+// alignColumns pads the space between left and right to the width of the columns.
+func alignColumns(columns int, left, right string) string {
+	padding := columns - len([]rune(left)) - len([]rune(right))
+	if padding < 1 {
+		padding = 1
+	}
+	return left + strings.Repeat(" ", padding) + right
+}
+
+// FormatTime formats a datetime in the local time zone of the server, e.g. "23.01.2025 21:56".
+func FormatTime(dateTime types.DateTime) string {
+	return dateTime.Time().Local().Format("02.01.2006 15:04")
+}
+
+// FormatEuro formats an amount in cents, e.g. 1234 as "12,34 €".
+func FormatEuro(cents float64) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	c := int64(math.Round(cents))
+	return fmt.Sprintf("%s%d,%02d €", sign, c/100, c%100)
+}
+
+// winAnsi maps the characters of the Windows-1252 code page outside of Latin-1 to their codes.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94,
+	'•': 0x95, '–': 0x96, '—': 0x97,
+}
+
+// EncodeWinAnsi encodes the text as Windows-1252 (WinAnsi), which is understood by the standard PDF fonts and
+// by receipt printers. German umlauts and "€" are part of it, other characters are replaced with "?".
+func EncodeWinAnsi(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r < 0x80 || (r >= 0xa0 && r <= 0xff):
+			encoded = append(encoded, byte(r))
+		case winAnsi[r] != 0:
+			encoded = append(encoded, winAnsi[r])
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
@@ -1,14 +1,37 @@
 package routes
 
 import (
+	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/supotsu-no-ochaya/backend/internal/api"
+	"github.com/supotsu-no-ochaya/backend/internal/model"
 )
 
 func RegisterAPIRoutes(e *core.ServeEvent, app core.App) {
 	apiGroup := e.Router.Group("/api")
 
-	apiGroup.GET("/test", api.TestHandler(app))
-	apiGroup.GET("/export-json", api.ExportJSONHandler(app))
-	// apiGroup.GET("/export-json", api.ExportJSONHandler(app)).Bind(apis.RequireAuth())
+	apiGroup.GET("/test", api.TestHandler(app)).Bind(apis.RequireSuperuserAuth())
+	apiGroup.GET("/export-json", api.ExportJSONHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapExportData))
+	apiGroup.GET("/export-csv", api.ExportCSVHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapExportData))
+	apiGroup.GET("/export-xlsx", api.ExportXLSXHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapExportData))
+	apiGroup.GET("/stations/{id}/queue", api.StationQueueHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapViewOrders))
+	apiGroup.PATCH("/stations/{id}/order-items/{orderItemId}", api.StationOrderItemStatusHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapUpdateOrders))
+	apiGroup.GET("/orders/{id}/bill", api.OrderBillHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapViewOrders))
+	apiGroup.GET("/orders/{id}/split", api.OrderSplitHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapViewOrders))
+	apiGroup.POST("/orders/{id}/split", api.OrderSplitPaymentHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapTakePayments))
+	apiGroup.POST("/orders/{id}/transfer", api.TransferOrderHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapTakeOrders))
+	apiGroup.POST("/orders/{id}/merge", api.MergeOrderHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapTakeOrders))
+	apiGroup.POST("/orders/{id}/split-off", api.SplitOffOrderHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapTakeOrders))
+	apiGroup.GET("/tables", api.TablesHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapViewOrders))
+	apiGroup.GET("/stream/orders", api.OrderStreamHandler(app)).Bind(apis.RequireAuth())
+	apiGroup.POST("/orders/{id}/reprint", api.ReprintKitchenTicketsHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapTakeOrders))
+	apiGroup.POST("/products/{id}/restock", api.RestockProductHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapManageMenu))
+	apiGroup.GET("/payments/{id}/receipt", api.PaymentReceiptHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapTakePayments))
+	apiGroup.POST("/cash-sessions", api.OpenCashSessionHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapTakePayments))
+	apiGroup.GET("/cash-sessions/{id}", api.CashSessionHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapTakePayments))
+	apiGroup.POST("/cash-sessions/{id}/close", api.CloseCashSessionHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapTakePayments))
+	apiGroup.GET("/z-reports/preview", api.ZReportPreviewHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapViewReports))
+	apiGroup.POST("/z-reports", api.IssueZReportHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapIssueReports))
+	apiGroup.GET("/z-reports/{number}", api.ZReportHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapViewReports))
+	apiGroup.GET("/z-reports/{number}/pdf", api.ZReportPDFHandler(app)).Bind(apis.RequireAuth(), api.RequireCapability(model.CapViewReports))
 }
@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Products of a combined menu item can be prepared at different stations (e.g. grill and drinks),
+// so products get their own optional station. Products without one use the station of their menu item.
+func init() {
+	m.Register(func(app core.App) error {
+		products, err := app.FindCollectionByNameOrId("product")
+		if err != nil {
+			return err
+		}
+		stations, err := app.FindCollectionByNameOrId("station")
+		if err != nil {
+			return err
+		}
+
+		products.Fields.Add(&core.RelationField{
+			Name:         "station",
+			CollectionId: stations.Id,
+			MaxSelect:    1,
+		})
+
+		return app.Save(products)
+	}, func(app core.App) error {
+		products, err := app.FindCollectionByNameOrId("product")
+		if err != nil {
+			return err
+		}
+
+		products.Fields.RemoveByName("station")
+
+		return app.Save(products)
+	})
+}
@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// An order item can contain products of several stations, so every station tracks its
+// own progress in "station_status" (station id -> order item status).
+// The status of the order item is derived from the slowest station by the order item hooks.
+func init() {
+	m.Register(func(app core.App) error {
+		orderItems, err := app.FindCollectionByNameOrId("order_item")
+		if err != nil {
+			return err
+		}
+
+		orderItems.Fields.Add(&core.JSONField{
+			Name: "station_status",
+		})
+
+		return app.Save(orderItems)
+	}, func(app core.App) error {
+		orderItems, err := app.FindCollectionByNameOrId("order_item")
+		if err != nil {
+			return err
+		}
+
+		orderItems.Fields.RemoveByName("station_status")
+
+		return app.Save(orderItems)
+	})
+}
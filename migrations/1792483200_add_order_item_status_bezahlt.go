@@ -0,0 +1,42 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Databases created from the former schema.json import have no "Bezahlt" order item status, so paying an order failed
+// to cascade onto its order items. Add the missing statuses to both status fields,
+// databases created by the snapshot migration already have them.
+func init() {
+	statuses := []string{"Aufgegeben", "InArbeit", "Abholbereit", "Geliefert", "Bezahlt"}
+
+	m.Register(func(app core.App) error {
+		for _, name := range []string{"order", "order_item"} {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+
+			field, ok := collection.Fields.GetByName("status").(*core.SelectField)
+			if !ok {
+				continue
+			}
+			for _, status := range statuses {
+				if !slices.Contains(field.Values, status) {
+					field.Values = append(field.Values, status)
+				}
+			}
+
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		// removing "Bezahlt" again would bring back the failing cascade
+		return nil
+	})
+}
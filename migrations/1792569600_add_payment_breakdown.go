@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// The payment hooks compute the total of a payment from the prices of its order items and the discount.
+// The breakdown is stored in "subtotal_amount" and "discount_amount". "total_amount" is no longer required,
+// as it is filled in when missing and a total of 0 is valid for a fully discounted payment.
+func init() {
+	m.Register(func(app core.App) error {
+		payments, err := app.FindCollectionByNameOrId("payment")
+		if err != nil {
+			return err
+		}
+
+		payments.Fields.Add(&core.NumberField{
+			Name:    "subtotal_amount",
+			OnlyInt: true,
+		})
+		payments.Fields.Add(&core.NumberField{
+			Name:    "discount_amount",
+			OnlyInt: true,
+		})
+		if total, ok := payments.Fields.GetByName("total_amount").(*core.NumberField); ok {
+			total.Required = false
+		}
+
+		return app.Save(payments)
+	}, func(app core.App) error {
+		payments, err := app.FindCollectionByNameOrId("payment")
+		if err != nil {
+			return err
+		}
+
+		payments.Fields.RemoveByName("subtotal_amount")
+		payments.Fields.RemoveByName("discount_amount")
+		if total, ok := payments.Fields.GetByName("total_amount").(*core.NumberField); ok {
+			total.Required = true
+		}
+
+		return app.Save(payments)
+	})
+}
@@ -0,0 +1,73 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// A "cash_session" is the cash drawer of a waiter for a shift. It is opened with a float, cash payments are
+// attached to it by the payment hooks and it is closed with the counted amount, see the cash session API.
+// Sessions are only written through the API, so there are no create, update or delete rules.
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		cashSessions := core.NewBaseCollection("cash_session")
+		cashSessions.ListRule = types.Pointer(`@request.auth.id != "" && (@request.auth.role.role_name = "Kuechenchef" || @request.auth.role.role_name = "Kellner")`)
+		cashSessions.ViewRule = cashSessions.ListRule
+		cashSessions.Fields.Add(
+			&core.RelationField{
+				Name:         "waiter",
+				CollectionId: users.Id,
+				MaxSelect:    1,
+				Required:     true,
+			},
+			&core.NumberField{Name: "opening_float", OnlyInt: true, Min: types.Pointer(0.0)},
+			// empty while the session is open
+			&core.DateField{Name: "closed"},
+			&core.NumberField{Name: "cash_total", OnlyInt: true},
+			&core.NumberField{Name: "cash_tips", OnlyInt: true},
+			&core.NumberField{Name: "expected_amount", OnlyInt: true},
+			&core.NumberField{Name: "counted_amount", OnlyInt: true},
+			&core.NumberField{Name: "difference", OnlyInt: true},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		cashSessions.AddIndex("idx_cash_session_waiter", false, "`waiter`, `closed`", "")
+		if err := app.Save(cashSessions); err != nil {
+			return err
+		}
+
+		payments, err := app.FindCollectionByNameOrId("payment")
+		if err != nil {
+			return err
+		}
+		payments.Fields.Add(&core.RelationField{
+			Name:         "cash_session",
+			CollectionId: cashSessions.Id,
+			MaxSelect:    1,
+		})
+
+		return app.Save(payments)
+	}, func(app core.App) error {
+		payments, err := app.FindCollectionByNameOrId("payment")
+		if err != nil {
+			return err
+		}
+		payments.Fields.RemoveByName("cash_session")
+		if err := app.Save(payments); err != nil {
+			return err
+		}
+
+		cashSessions, err := app.FindCollectionByNameOrId("cash_session")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(cashSessions)
+	})
+}
@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// A "z_report" is an issued daily closing report. Reports are numbered sequentially and cannot be changed
+// or deleted once issued, see the Z-report hooks. They are only issued through the API,
+// so there are no create, update or delete rules.
+func init() {
+	m.Register(func(app core.App) error {
+		zReports := core.NewBaseCollection("z_report")
+		zReports.ListRule = types.Pointer(`@request.auth.id != "" && (@request.auth.role.role_name = "Kuechenchef" || @request.auth.role.role_name = "Kellner")`)
+		zReports.ViewRule = zReports.ListRule
+		zReports.Fields.Add(
+			&core.NumberField{Name: "number", OnlyInt: true, Min: types.Pointer(1.0), Required: true},
+			&core.DateField{Name: "start", Required: true},
+			&core.DateField{Name: "end", Required: true},
+			&core.JSONField{Name: "content", MaxSize: 5 << 20},
+			&core.AutodateField{Name: "created", OnCreate: true},
+		)
+		zReports.AddIndex("idx_z_report_number", true, "`number`", "")
+
+		return app.Save(zReports)
+	}, func(app core.App) error {
+		zReports, err := app.FindCollectionByNameOrId("z_report")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(zReports)
+	})
+}
@@ -0,0 +1,90 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Stations get the address of their network thermal printer ("host" or "host:port", port 9100 by default).
+// A "print_job" is a kitchen ticket of order items for a station with a printer. Jobs are queued by the
+// kitchen ticket hooks and the reprint API and printed by the print spooler, which retries failed attempts.
+// Jobs are only written by the backend, so there are no create, update or delete rules.
+func init() {
+	m.Register(func(app core.App) error {
+		stations, err := app.FindCollectionByNameOrId("station")
+		if err != nil {
+			return err
+		}
+		stations.Fields.Add(&core.TextField{Name: "printer", Max: 255})
+		if err := app.Save(stations); err != nil {
+			return err
+		}
+
+		orders, err := app.FindCollectionByNameOrId("order")
+		if err != nil {
+			return err
+		}
+		orderItems, err := app.FindCollectionByNameOrId("order_item")
+		if err != nil {
+			return err
+		}
+
+		printJobs := core.NewBaseCollection("print_job")
+		printJobs.ListRule = types.Pointer(`@request.auth.id != "" && (@request.auth.role.role_name = "Kuechenchef" || @request.auth.role.role_name = "Kellner")`)
+		printJobs.ViewRule = printJobs.ListRule
+		printJobs.Fields.Add(
+			&core.RelationField{
+				Name:          "station",
+				CollectionId:  stations.Id,
+				MaxSelect:     1,
+				Required:      true,
+				CascadeDelete: true,
+			},
+			&core.RelationField{
+				Name:          "order",
+				CollectionId:  orders.Id,
+				MaxSelect:     1,
+				Required:      true,
+				CascadeDelete: true,
+			},
+			&core.RelationField{
+				Name:         "order_items",
+				CollectionId: orderItems.Id,
+				MaxSelect:    999,
+			},
+			&core.BoolField{Name: "reprint"},
+			&core.SelectField{
+				Name:      "status",
+				Values:    []string{"pending", "printed", "failed"},
+				MaxSelect: 1,
+				Required:  true,
+			},
+			&core.NumberField{Name: "attempts", OnlyInt: true, Min: types.Pointer(0.0)},
+			&core.DateField{Name: "next_attempt"},
+			&core.TextField{Name: "last_error"},
+			&core.DateField{Name: "printed"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		printJobs.AddIndex("idx_print_job_status", false, "`status`, `next_attempt`", "")
+
+		return app.Save(printJobs)
+	}, func(app core.App) error {
+		printJobs, err := app.FindCollectionByNameOrId("print_job")
+		if err != nil {
+			return err
+		}
+		if err := app.Delete(printJobs); err != nil {
+			return err
+		}
+
+		stations, err := app.FindCollectionByNameOrId("station")
+		if err != nil {
+			return err
+		}
+		stations.Fields.RemoveByName("printer")
+
+		return app.Save(stations)
+	})
+}
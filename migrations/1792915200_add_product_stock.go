@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Products get a stock, which is only tracked for products with "track_stock": order items consume one
+// of each of their products and products running out of stock become unavailable.
+// Changes of the availability and the stock are recorded as "product" events, which the "type" of the
+// events did not allow so far.
+func init() {
+	m.Register(func(app core.App) error {
+		products, err := app.FindCollectionByNameOrId("product")
+		if err != nil {
+			return err
+		}
+		products.Fields.Add(
+			&core.BoolField{Name: "track_stock"},
+			&core.NumberField{Name: "stock", OnlyInt: true, Min: types.Pointer(0.0)},
+		)
+		if err := app.Save(products); err != nil {
+			return err
+		}
+
+		events, err := app.FindCollectionByNameOrId("event")
+		if err != nil {
+			return err
+		}
+		eventType, ok := events.Fields.GetByName("type").(*core.SelectField)
+		if !ok {
+			return nil
+		}
+		if !slices.Contains(eventType.Values, "product") {
+			eventType.Values = append(eventType.Values, "product")
+		}
+		return app.Save(events)
+	}, func(app core.App) error {
+		products, err := app.FindCollectionByNameOrId("product")
+		if err != nil {
+			return err
+		}
+		products.Fields.RemoveByName("track_stock")
+		products.Fields.RemoveByName("stock")
+		if err := app.Save(products); err != nil {
+			return err
+		}
+
+		events, err := app.FindCollectionByNameOrId("event")
+		if err != nil {
+			return err
+		}
+		if eventType, ok := events.Fields.GetByName("type").(*core.SelectField); ok {
+			eventType.Values = slices.DeleteFunc(eventType.Values, func(value string) bool { return value == "product" })
+		}
+		return app.Save(events)
+	})
+}
@@ -0,0 +1,89 @@
+package migrations
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Menu items get their availability: "available" is false while the menu item is disabled or a product
+// of its BOM template is unavailable, "disabled_reason" tells why. Both are maintained by the menu item
+// hooks, the existing menu items are calculated here.
+func init() {
+	m.Register(func(app core.App) error {
+		menuItems, err := app.FindCollectionByNameOrId("menu_item")
+		if err != nil {
+			return err
+		}
+		menuItems.Fields.Add(
+			&core.BoolField{Name: "available"},
+			&core.TextField{Name: "disabled_reason", Max: 1000},
+		)
+		if err := app.Save(menuItems); err != nil {
+			return err
+		}
+
+		records, err := app.FindAllRecords(menuItems)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			available, reason, err := menuItemAvailability(app, record)
+			if err != nil {
+				return err
+			}
+			// without saving the record, which would touch "updated"
+			_, err = app.DB().Update(
+				menuItems.Name,
+				dbx.Params{"available": available, "disabled_reason": reason},
+				dbx.HashExp{"id": record.Id},
+			).Execute()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		menuItems, err := app.FindCollectionByNameOrId("menu_item")
+		if err != nil {
+			return err
+		}
+
+		menuItems.Fields.RemoveByName("available")
+		menuItems.Fields.RemoveByName("disabled_reason")
+
+		return app.Save(menuItems)
+	})
+}
+
+// menuItemAvailability is hooks.MenuItemAvailability at the time of the migration.
+func menuItemAvailability(app core.App, menuItem *core.Record) (bool, string, error) {
+	if menuItem.GetBool("disabled") {
+		return false, "The menu item is disabled", nil
+	}
+
+	var bom struct {
+		Products []string `json:"products"`
+	}
+	if err := json.Unmarshal([]byte(menuItem.GetString("bom_template")), &bom); err != nil || len(bom.Products) == 0 {
+		return true, "", nil
+	}
+	unavailable := []string{}
+	for _, productId := range bom.Products {
+		product, err := app.FindRecordById("product", productId)
+		if err != nil {
+			unavailable = append(unavailable, productId)
+			continue
+		}
+		if !product.GetBool("is_available") {
+			unavailable = append(unavailable, product.GetString("name"))
+		}
+	}
+	if len(unavailable) > 0 {
+		return false, "Unavailable products: " + strings.Join(unavailable, ", "), nil
+	}
+	return true, "", nil
+}
@@ -0,0 +1,77 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// The rules generated by model.Rule at the time of the migration, by the roles they allow.
+const (
+	ruleAllRoles        = `@request.auth.id != "" && (@request.auth.role.role_name = "Kellner" || @request.auth.role.role_name = "Kueche" || @request.auth.role.role_name = "Kuechenchef")`
+	ruleKellnerOrChef   = `@request.auth.id != "" && (@request.auth.role.role_name = "Kellner" || @request.auth.role.role_name = "Kuechenchef")`
+	ruleKuechenchefOnly = `@request.auth.id != "" && (@request.auth.role.role_name = "Kuechenchef")`
+	ruleSuperusersOnly  = ""
+)
+
+// collectionRules are the list, view, create, update and delete rules of a collection.
+// ruleSuperusersOnly stands for a nil rule.
+type collectionRules [5]string
+
+// regeneratedCollectionRules is model.CollectionRules at the time of the migration.
+var regeneratedCollectionRules = map[string]collectionRules{
+	"user_role":         {ruleKuechenchefOnly, ruleKuechenchefOnly, ruleSuperusersOnly, ruleSuperusersOnly, ruleSuperusersOnly},
+	"admin_settings":    {ruleKuechenchefOnly, ruleKuechenchefOnly, ruleKuechenchefOnly, ruleKuechenchefOnly, ruleKuechenchefOnly},
+	"menu_categ":        {ruleAllRoles, ruleAllRoles, ruleKuechenchefOnly, ruleKuechenchefOnly, ruleKuechenchefOnly},
+	"menu_item":         {ruleAllRoles, ruleAllRoles, ruleKuechenchefOnly, ruleKuechenchefOnly, ruleKuechenchefOnly},
+	"product":           {ruleAllRoles, ruleAllRoles, ruleKuechenchefOnly, ruleKuechenchefOnly, ruleKuechenchefOnly},
+	"product_attribute": {ruleAllRoles, ruleAllRoles, ruleKuechenchefOnly, ruleKuechenchefOnly, ruleKuechenchefOnly},
+	"product_type":      {ruleAllRoles, ruleAllRoles, ruleKuechenchefOnly, ruleKuechenchefOnly, ruleKuechenchefOnly},
+	"station":           {ruleAllRoles, ruleAllRoles, ruleKuechenchefOnly, ruleKuechenchefOnly, ruleKuechenchefOnly},
+	"order":             {ruleAllRoles, ruleAllRoles, ruleKellnerOrChef, ruleAllRoles, ruleKuechenchefOnly},
+	"order_item":        {ruleAllRoles, ruleAllRoles, ruleKellnerOrChef, ruleAllRoles, ruleKuechenchefOnly},
+	"print_job":         {ruleKellnerOrChef, ruleKellnerOrChef, ruleSuperusersOnly, ruleSuperusersOnly, ruleSuperusersOnly},
+	"payment":           {ruleKellnerOrChef, ruleKellnerOrChef, ruleKellnerOrChef, ruleKellnerOrChef, ruleKellnerOrChef},
+	"payment_option":    {ruleKellnerOrChef, ruleKellnerOrChef, ruleSuperusersOnly, ruleSuperusersOnly, ruleSuperusersOnly},
+	"cash_session":      {ruleKellnerOrChef, ruleKellnerOrChef, ruleSuperusersOnly, ruleSuperusersOnly, ruleSuperusersOnly},
+	"z_report":          {ruleKellnerOrChef, ruleKellnerOrChef, ruleSuperusersOnly, ruleSuperusersOnly, ruleSuperusersOnly},
+}
+
+// setCollectionRules sets the rules of the collection, the way the model set them at the time.
+func setCollectionRules(collection *core.Collection, rules collectionRules) {
+	pointers := make([]*string, len(rules))
+	for i, rule := range rules {
+		if rule != ruleSuperusersOnly {
+			pointers[i] = &rule
+		}
+	}
+	collection.ListRule = pointers[0]
+	collection.ViewRule = pointers[1]
+	collection.CreateRule = pointers[2]
+	collection.UpdateRule = pointers[3]
+	collection.DeleteRule = pointers[4]
+}
+
+// Regenerates the API rules of the collections from the capabilities of the roles, see model.CollectionRules.
+// The "admin_settings" rules checked for a "Küchenchef" role, which does not exist, so the Kuechenchef
+// could not manage the settings. The rules are a frozen copy of what the model generated at the time,
+// so later changes of the permission model need a migration of their own.
+// The inconsistent rules are not restored on down.
+func init() {
+	m.Register(func(app core.App) error {
+		for name, rules := range regeneratedCollectionRules {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			setCollectionRules(collection, rules)
+			if err := app.Save(collection); err != nil {
+				return fmt.Errorf("failed to save the rules of %q: %w", name, err)
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		return nil
+	})
+}
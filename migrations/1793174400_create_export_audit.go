@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// An "export_audit" records every export of the sales data, see the export API.
+// Audit entries are only written by the API, so there are no create, update or delete rules.
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		exportAudits := core.NewBaseCollection("export_audit")
+		// the rules of the export_data capability at the time of the migration
+		setCollectionRules(exportAudits, collectionRules{ruleKuechenchefOnly, ruleKuechenchefOnly, ruleSuperusersOnly, ruleSuperusersOnly, ruleSuperusersOnly})
+		exportAudits.Fields.Add(
+			// empty for exports of superusers, which are recorded by their email
+			&core.RelationField{
+				Name:         "user",
+				CollectionId: users.Id,
+				MaxSelect:    1,
+			},
+			&core.EmailField{Name: "superuser"},
+			&core.SelectField{
+				Name:      "format",
+				Values:    []string{"json", "csv", "xlsx"},
+				MaxSelect: 1,
+				Required:  true,
+			},
+			&core.DateField{Name: "start", Required: true},
+			&core.DateField{Name: "end", Required: true},
+			&core.TextField{Name: "ip"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+		)
+		exportAudits.AddIndex("idx_export_audit_created", false, "`created`", "")
+
+		return app.Save(exportAudits)
+	}, func(app core.App) error {
+		exportAudits, err := app.FindCollectionByNameOrId("export_audit")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(exportAudits)
+	})
+}
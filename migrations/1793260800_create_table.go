@@ -0,0 +1,89 @@
+package migrations
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// A "table" is a table of the restaurant with its place on the floor plan. Orders keep their "table" number
+// and additionally reference the table record in "dining_table", which the table hooks keep in sync.
+// A table is created for every number used by existing orders, with a predictable id, so copies of the data
+// get the same tables.
+func init() {
+	m.Register(func(app core.App) error {
+		tables := core.NewBaseCollection("table")
+		// the rules of the view_orders and manage_tables capabilities at the time of the migration
+		setCollectionRules(tables, collectionRules{ruleAllRoles, ruleAllRoles, ruleKuechenchefOnly, ruleKuechenchefOnly, ruleKuechenchefOnly})
+		tables.Fields.Add(
+			&core.NumberField{Name: "number", OnlyInt: true, Min: types.Pointer(1.0), Required: true},
+			&core.TextField{Name: "area", Max: 100},
+			&core.NumberField{Name: "seats", OnlyInt: true, Min: types.Pointer(0.0)},
+			&core.NumberField{Name: "position_x"},
+			&core.NumberField{Name: "position_y"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		tables.AddIndex("idx_table_number", true, "`number`", "")
+		if err := app.Save(tables); err != nil {
+			return err
+		}
+
+		orders, err := app.FindCollectionByNameOrId("order")
+		if err != nil {
+			return err
+		}
+		orders.Fields.Add(&core.RelationField{
+			Name:         "dining_table",
+			CollectionId: tables.Id,
+			MaxSelect:    1,
+		})
+		if err := app.Save(orders); err != nil {
+			return err
+		}
+
+		var numbers []float64
+		err = app.DB().Select("table").Distinct(true).From("order").Column(&numbers)
+		if err != nil {
+			return err
+		}
+		for _, number := range numbers {
+			if number < 1 || number != math.Trunc(number) {
+				continue
+			}
+			table := core.NewRecord(tables)
+			table.Id = fmt.Sprintf("table%010d", int(number))
+			table.Set("number", number)
+			if err := app.Save(table); err != nil {
+				return err
+			}
+
+			// without saving the orders, so "updated" keeps telling when they were changed
+			_, err := app.DB().Update("order", dbx.Params{"dining_table": table.Id}, dbx.HashExp{"table": number}).Execute()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		orders, err := app.FindCollectionByNameOrId("order")
+		if err != nil {
+			return err
+		}
+		orders.Fields.RemoveByName("dining_table")
+		if err := app.Save(orders); err != nil {
+			return err
+		}
+
+		tables, err := app.FindCollectionByNameOrId("table")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(tables)
+	})
+}
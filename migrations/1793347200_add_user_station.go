@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Kitchen staff works at one station, which decides what the order stream shows them.
+// Users may still update their own record, but only superusers assign the station.
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		stations, err := app.FindCollectionByNameOrId("station")
+		if err != nil {
+			return err
+		}
+
+		users.Fields.Add(&core.RelationField{
+			Name:         "station",
+			CollectionId: stations.Id,
+			MaxSelect:    1,
+		})
+		users.UpdateRule = types.Pointer("id = @request.auth.id && @request.body.station:isset = false")
+
+		return app.Save(users)
+	}, func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		users.Fields.RemoveByName("station")
+		users.UpdateRule = types.Pointer("id = @request.auth.id")
+
+		return app.Save(users)
+	})
+}